@@ -0,0 +1,232 @@
+package dropboxclient_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/koofr/go-dropboxclient"
+	"github.com/koofr/go-dropboxclient/mockdropbox"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("MockDropbox admin API", func() {
+	var mock *mockdropbox.MockDropbox
+	var server *httptest.Server
+	var client *Dropbox
+
+	BeforeEach(func() {
+		mock = mockdropbox.New()
+		server = httptest.NewServer(mock)
+
+		var err error
+		client, err = New(WithAccessToken("mock"), WithBaseURL(server.URL))
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	admin := func(method string, path string, body io.Reader) *http.Response {
+		req, err := http.NewRequest(method, server.URL+"/_mock/"+path, body)
+		Expect(err).NotTo(HaveOccurred())
+		req.Header.Set("Authorization", "Bearer mock")
+		res, err := http.DefaultClient.Do(req)
+		Expect(err).NotTo(HaveOccurred())
+		return res
+	}
+
+	buildTar := func(files map[string]string, dirs ...string) *bytes.Buffer {
+		buf := &bytes.Buffer{}
+		tw := tar.NewWriter(buf)
+		for _, dir := range dirs {
+			Expect(tw.WriteHeader(&tar.Header{Typeflag: tar.TypeDir, Name: dir + "/", Mode: 0755})).To(Succeed())
+		}
+		for name, content := range files {
+			Expect(tw.WriteHeader(&tar.Header{
+				Typeflag: tar.TypeReg,
+				Name:     name,
+				Mode:     0644,
+				Size:     int64(len(content)),
+				ModTime:  time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+			})).To(Succeed())
+			_, err := tw.Write([]byte(content))
+			Expect(err).NotTo(HaveOccurred())
+		}
+		Expect(tw.Close()).To(Succeed())
+		return buf
+	}
+
+	readTar := func(r io.Reader) map[string]string {
+		files := map[string]string{}
+		tr := tar.NewReader(r)
+		for {
+			header, err := tr.Next()
+			if err == io.EOF {
+				return files
+			}
+			Expect(err).NotTo(HaveOccurred())
+			data, err := io.ReadAll(tr)
+			Expect(err).NotTo(HaveOccurred())
+			files[header.Name] = string(data)
+		}
+	}
+
+	It("should import and export a tree", func() {
+		res := admin("POST", "import?path=/seed", buildTar(map[string]string{
+			"a.txt":       "a",
+			"Dir/b.txt":   "bb",
+			"Dir/c/d.txt": "ddd",
+		}, "empty"))
+		res.Body.Close()
+		Expect(res.StatusCode).To(Equal(http.StatusNoContent))
+
+		md, err := client.GetMetadata(context.Background(), &GetMetadataArg{Path: "/seed/dir/c/d.txt"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(md.Size).To(Equal(int64(3)))
+		Expect(md.ClientModified).To(Equal(time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)))
+
+		md, err = client.GetMetadata(context.Background(), &GetMetadataArg{Path: "/seed/empty"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(md.Tag).To(Equal(MetadataFolder))
+
+		res = admin("GET", "export?path=/seed", nil)
+		defer res.Body.Close()
+		Expect(res.StatusCode).To(Equal(http.StatusOK))
+		Expect(res.Header.Get("Content-Type")).To(Equal("application/x-tar"))
+		Expect(readTar(res.Body)).To(Equal(map[string]string{
+			"Dir/":        "",
+			"Dir/b.txt":   "bb",
+			"Dir/c/":      "",
+			"Dir/c/d.txt": "ddd",
+			"a.txt":       "a",
+			"empty/":      "",
+		}))
+	})
+
+	It("should reject an import over a file", func() {
+		uploadFile(client, "/file", []byte("x"))
+
+		res := admin("POST", "import?path=/file", buildTar(map[string]string{"a.txt": "a"}))
+		res.Body.Close()
+		Expect(res.StatusCode).To(Equal(http.StatusBadRequest))
+	})
+
+	It("should keep imported entries inside the import folder", func() {
+		res := admin("POST", "import?path=/a/b", buildTar(map[string]string{
+			"../../x.txt":   "x",
+			"c/../../y.txt": "y",
+		}, "../../dir"))
+		res.Body.Close()
+		Expect(res.StatusCode).To(Equal(http.StatusNoContent))
+
+		for _, path := range []string{"/a/b/x.txt", "/a/b/y.txt", "/a/b/dir"} {
+			_, err := client.GetMetadata(context.Background(), &GetMetadataArg{Path: path})
+			Expect(err).NotTo(HaveOccurred())
+		}
+		for _, path := range []string{"/x.txt", "/a/y.txt", "/dir"} {
+			_, err := client.GetMetadata(context.Background(), &GetMetadataArg{Path: path})
+			Expect(err).To(HaveOccurred())
+		}
+	})
+
+	It("should reject relative and unclean import paths", func() {
+		for _, path := range []string{"foo", "/a/..", "/a/../b"} {
+			res := admin("POST", "import?path="+path, buildTar(map[string]string{"a.txt": "a"}))
+			res.Body.Close()
+			Expect(res.StatusCode).To(Equal(http.StatusBadRequest), path)
+		}
+
+		res, err := client.ListFolder(context.Background(), &ListFolderArg{Path: "", Recursive: true})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(res.Entries).To(BeEmpty())
+	})
+
+	It("should list upload sessions", func() {
+		session, err := client.UploadSessionStart(context.Background(), bytes.NewReader([]byte("hello")))
+		Expect(err).NotTo(HaveOccurred())
+
+		res := admin("GET", "upload_sessions", nil)
+		defer res.Body.Close()
+
+		sessions := []*mockdropbox.UploadSessionInfo{}
+		Expect(json.NewDecoder(res.Body).Decode(&sessions)).To(Succeed())
+		Expect(sessions).To(Equal([]*mockdropbox.UploadSessionInfo{
+			{Id: session.SessionId, Offset: 5},
+		}))
+	})
+
+	It("should read the change log", func() {
+		uploadFile(client, "/a.txt", []byte("a"))
+		since := mock.TokenStore("mock").GetCurrentChangeID()
+		uploadFile(client, "/b.txt", []byte("b"))
+		_, err := client.Delete(context.Background(), &DeleteArg{Path: "/a.txt"})
+		Expect(err).NotTo(HaveOccurred())
+
+		res := admin("GET", "changes?since="+fmt.Sprint(since), nil)
+		defer res.Body.Close()
+
+		result := &mockdropbox.ChangesResult{}
+		Expect(json.NewDecoder(res.Body).Decode(result)).To(Succeed())
+		Expect(result.CurrentChangeID).To(Equal(since + 2))
+		Expect(result.Changes).To(HaveLen(2))
+		Expect(result.Changes[0].Metadata.PathLower).To(Equal("/b.txt"))
+		Expect(result.Changes[1].Metadata.PathLower).To(Equal("/a.txt"))
+		Expect(result.Changes[1].Metadata.Tag).To(Equal(MetadataDeleted))
+	})
+
+	It("should reset the store of the access token", func() {
+		uploadFile(client, "/a.txt", []byte("a"))
+		_, err := client.UploadSessionStart(context.Background(), bytes.NewReader([]byte("hello")))
+		Expect(err).NotTo(HaveOccurred())
+		other := mock.TokenStore("other")
+		otherClient := mockdropbox.NewMemoryClientWithStore(other)
+		_, err = otherClient.CreateFolder(context.Background(), &CreateFolderArg{Path: "/kept"})
+		Expect(err).NotTo(HaveOccurred())
+
+		res := admin("POST", "reset", nil)
+		res.Body.Close()
+		Expect(res.StatusCode).To(Equal(http.StatusNoContent))
+
+		_, err = client.GetMetadata(context.Background(), &GetMetadataArg{Path: "/a.txt"})
+		Expect(err).To(HaveOccurred())
+		Expect(mock.TokenStore("mock").UploadSessions()).To(BeEmpty())
+
+		_, err = otherClient.GetMetadata(context.Background(), &GetMetadataArg{Path: "/kept"})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("should keep a reset after a restart", func() {
+		dir := GinkgoT().TempDir()
+
+		disk := mockdropbox.NewWithBackends(mockdropbox.DiskBackends(dir))
+		store := disk.TokenStore("mock")
+		diskClient := mockdropbox.NewMemoryClientWithStore(store)
+		_, err := diskClient.CreateFolder(context.Background(), &CreateFolderArg{Path: "/old"})
+		Expect(err).NotTo(HaveOccurred())
+		store.Reset()
+		_, err = diskClient.CreateFolder(context.Background(), &CreateFolderArg{Path: "/new"})
+		Expect(err).NotTo(HaveOccurred())
+		changeID := store.GetCurrentChangeID()
+		Expect(disk.Close()).To(Succeed())
+
+		disk = mockdropbox.NewWithBackends(mockdropbox.DiskBackends(dir))
+		defer disk.Close()
+		store = disk.TokenStore("mock")
+
+		Expect(store.GetCurrentChangeID()).To(Equal(changeID))
+		_, ok := store.GetItemByPath("/old")
+		Expect(ok).To(BeFalse())
+		_, ok = store.GetItemByPath("/new")
+		Expect(ok).To(BeTrue())
+	})
+})
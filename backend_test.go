@@ -0,0 +1,153 @@
+package dropboxclient_test
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "github.com/koofr/go-dropboxclient"
+	"github.com/koofr/go-dropboxclient/mockdropbox"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("MockDropbox backends", func() {
+	ctx := context.Background()
+
+	blobHash := func(data string) string {
+		sum := md5.Sum([]byte(data))
+		return hex.EncodeToString(sum[:])
+	}
+
+	hasBlob := func(backend mockdropbox.Backend, data string) bool {
+		blob, err := backend.OpenBlob(blobHash(data))
+		if errors.Is(err, fs.ErrNotExist) {
+			return false
+		}
+		Expect(err).NotTo(HaveOccurred())
+		blob.Close()
+		return true
+	}
+
+	It("should remove blobs that are no longer referenced", func() {
+		backend := mockdropbox.NewMemoryBackend()
+		store, err := mockdropbox.NewStoreWithBackend(backend)
+		Expect(err).NotTo(HaveOccurred())
+		client := mockdropbox.NewMemoryClientWithStore(store)
+
+		uploadMemoryFile(client, "/a.txt", "one")
+		_, err = client.Copy(ctx, &RelocationArg{FromPath: "/a.txt", ToPath: "/b.txt"})
+		Expect(err).NotTo(HaveOccurred())
+
+		session, err := client.UploadSessionStart(ctx, strings.NewReader("two"))
+		Expect(err).NotTo(HaveOccurred())
+		_, err = client.UploadSessionFinish(ctx, &UploadSessionFinishArg{
+			Cursor: &UploadSessionCursor{SessionId: session.SessionId, Offset: 3},
+			Commit: &CommitInfo{Path: "/a.txt", Mode: &WriteMode{Tag: WriteModeOverwrite}},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(hasBlob(backend, "one")).To(BeTrue())
+
+		_, err = client.Delete(ctx, &DeleteArg{Path: "/b.txt"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(hasBlob(backend, "one")).To(BeFalse())
+		Expect(hasBlob(backend, "two")).To(BeTrue())
+
+		_, err = client.CreateFolder(ctx, &CreateFolderArg{Path: "/folder"})
+		Expect(err).NotTo(HaveOccurred())
+		session, err = client.UploadSessionStart(ctx, strings.NewReader("three"))
+		Expect(err).NotTo(HaveOccurred())
+		_, err = client.UploadSessionFinish(ctx, &UploadSessionFinishArg{
+			Cursor: &UploadSessionCursor{SessionId: session.SessionId, Offset: 5},
+			Commit: &CommitInfo{Path: "/folder", Mode: &WriteMode{Tag: WriteModeAdd}},
+		})
+		Expect(err).To(HaveOccurred())
+		Expect(hasBlob(backend, "three")).To(BeFalse())
+
+		store.Reset()
+		Expect(hasBlob(backend, "two")).To(BeFalse())
+	})
+
+	It("should keep the blobs of snapshots", func() {
+		backend := mockdropbox.NewMemoryBackend()
+		store, err := mockdropbox.NewStoreWithBackend(backend)
+		Expect(err).NotTo(HaveOccurred())
+		client := mockdropbox.NewMemoryClientWithStore(store)
+
+		uploadMemoryFile(client, "/a.txt", "one")
+		snapshot, err := store.Snapshot()
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = client.Delete(ctx, &DeleteArg{Path: "/a.txt"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(hasBlob(backend, "one")).To(BeTrue())
+
+		Expect(store.Restore(snapshot)).To(Succeed())
+		_, err = client.Delete(ctx, &DeleteArg{Path: "/a.txt"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(store.Restore(snapshot)).To(Succeed())
+	})
+
+	It("should drop a torn final journal entry", func() {
+		dir := GinkgoT().TempDir()
+
+		open := func() (*mockdropbox.Store, *mockdropbox.MemoryClient) {
+			backend, err := mockdropbox.NewDiskBackend(dir)
+			Expect(err).NotTo(HaveOccurred())
+			store, err := mockdropbox.NewStoreWithBackend(backend)
+			Expect(err).NotTo(HaveOccurred())
+			return store, mockdropbox.NewMemoryClientWithStore(store)
+		}
+
+		store, client := open()
+		_, err := client.CreateFolder(ctx, &CreateFolderArg{Path: "/a"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(store.Close()).To(Succeed())
+
+		journal, err := os.OpenFile(filepath.Join(dir, "journal.jsonl"), os.O_WRONLY|os.O_APPEND, 0644)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = journal.WriteString(`{"put":{"metadata":{".tag":"fol`)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(journal.Close()).To(Succeed())
+
+		store, client = open()
+		_, err = client.CreateFolder(ctx, &CreateFolderArg{Path: "/b"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(store.Close()).To(Succeed())
+
+		store, client = open()
+		defer store.Close()
+		for _, path := range []string{"/a", "/b"} {
+			_, err = client.GetMetadata(ctx, &GetMetadataArg{Path: path})
+			Expect(err).NotTo(HaveOccurred())
+		}
+	})
+
+	It("should answer 500 if the store cannot be opened", func() {
+		openErr := errors.New("backend unavailable")
+		mock := mockdropbox.NewWithBackends(func(token string) (mockdropbox.Backend, error) {
+			return nil, openErr
+		})
+		mockServer := httptest.NewServer(mock)
+		defer mockServer.Close()
+
+		_, err := mock.OpenStore("mock")
+		Expect(errors.Is(err, openErr)).To(BeTrue())
+
+		client, err := New(WithAccessToken("mock"), WithBaseURL(mockServer.URL))
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = client.GetMetadata(ctx, &GetMetadataArg{Path: "/a"})
+		dropboxErr, ok := IsDropboxError(err)
+		Expect(ok).To(BeTrue())
+		Expect(dropboxErr.HttpClientError.Got).To(Equal(http.StatusInternalServerError))
+	})
+})
@@ -0,0 +1,136 @@
+package dropboxclient
+
+import (
+	"context"
+	"time"
+)
+
+// ChangeBatch is one page of changes delivered by a ChangeFeed.
+type ChangeBatch struct {
+	Entries []*Metadata
+	// Reset is set for every page of a full listing. The consumer should
+	// treat the entries as the complete state of the folder and drop
+	// anything it knows about that is not listed before the page with
+	// HasMore unset.
+	Reset   bool
+	HasMore bool
+}
+
+// ChangeHandler processes a batch. If it returns an error the cursor is not
+// committed and the batch is delivered again by the next Poll.
+type ChangeHandler func(ctx context.Context, batch *ChangeBatch) error
+
+// ChangeFeed consumes the list folder changes of a folder, resuming from
+// the cursor in Cursors. Delivery is at-least-once: the cursor is committed
+// only after the handler succeeds. While a full listing is in progress the
+// cursor is committed only after its last page, so an interrupted listing
+// starts again from scratch.
+type ChangeFeed struct {
+	Client  Client
+	Arg     *ListFolderArg
+	Cursors CursorStore
+}
+
+func NewChangeFeed(client Client, arg *ListFolderArg, cursors CursorStore) *ChangeFeed {
+	if cursors == nil {
+		cursors = NewMemoryCursorStore()
+	}
+
+	return &ChangeFeed{
+		Client:  client,
+		Arg:     arg,
+		Cursors: cursors,
+	}
+}
+
+// isCursorResetError returns true for list folder continue errors after
+// which the cursor can not be used any more: the cursor was reset or the
+// listed folder no longer exists.
+func isCursorResetError(err error) bool {
+	dropboxErr, ok := IsDropboxError(err)
+	if !ok {
+		return false
+	}
+
+	switch dropboxErr.Err.Tag {
+	case "reset":
+		return true
+	case "path":
+		return dropboxErr.Err.Path != nil && dropboxErr.Err.Path.Tag == "not_found"
+	}
+
+	return false
+}
+
+// Poll delivers all pending changes to handler and returns once there are
+// no more changes. If the stored cursor is missing or no longer valid the
+// folder is listed from scratch and the batches are marked with Reset.
+func (f *ChangeFeed) Poll(ctx context.Context, handler ChangeHandler) error {
+	cursor, err := f.Cursors.Load(ctx)
+	if err != nil {
+		return err
+	}
+
+	reset := cursor == ""
+
+	var result *ListFolderResult
+
+	if reset {
+		result, err = f.Client.ListFolder(ctx, f.Arg)
+	} else {
+		result, err = f.Client.ListFolderContinue(ctx, &ListFolderContinueArg{Cursor: cursor})
+		if err != nil && isCursorResetError(err) {
+			if err := f.Cursors.Save(ctx, ""); err != nil {
+				return err
+			}
+			reset = true
+			result, err = f.Client.ListFolder(ctx, f.Arg)
+		}
+	}
+
+	for {
+		if err != nil {
+			return err
+		}
+
+		batch := &ChangeBatch{
+			Entries: result.Entries,
+			Reset:   reset,
+			HasMore: result.HasMore,
+		}
+
+		if err := handler(ctx, batch); err != nil {
+			return err
+		}
+
+		if !reset || !result.HasMore {
+			if err := f.Cursors.Save(ctx, result.Cursor); err != nil {
+				return err
+			}
+		}
+
+		if !result.HasMore {
+			return nil
+		}
+
+		result, err = f.Client.ListFolderContinue(ctx, &ListFolderContinueArg{Cursor: result.Cursor})
+	}
+}
+
+// Run calls Poll every interval until ctx is done or Poll fails.
+func (f *ChangeFeed) Run(ctx context.Context, handler ChangeHandler, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := f.Poll(ctx, handler); err != nil {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
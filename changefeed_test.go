@@ -0,0 +1,123 @@
+package dropboxclient_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+
+	. "github.com/koofr/go-dropboxclient"
+	"github.com/koofr/go-dropboxclient/mockdropbox"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ChangeFeed", func() {
+	var client *Dropbox
+	var mock *mockdropbox.MockDropbox
+	var stop func()
+	var cursors CursorStore
+	var feed *ChangeFeed
+
+	BeforeEach(func() {
+		client, mock, stop = startMockClient()
+
+		_, err := client.CreateFolder(context.Background(), &CreateFolderArg{Path: "/feed"})
+		Expect(err).NotTo(HaveOccurred())
+
+		cursors = NewMemoryCursorStore()
+		feed = NewChangeFeed(client, &ListFolderArg{Path: "/feed", Recursive: true}, cursors)
+	})
+
+	AfterEach(func() {
+		stop()
+	})
+
+	type received struct {
+		names []string
+		reset bool
+	}
+
+	poll := func() (batches []received) {
+		err := feed.Poll(context.Background(), func(ctx context.Context, batch *ChangeBatch) error {
+			names := []string{}
+			for _, md := range batch.Entries {
+				names = append(names, md.Tag+":"+md.PathLower)
+			}
+			batches = append(batches, received{names: names, reset: batch.Reset})
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+		return batches
+	}
+
+	It("should list the folder and then deliver changes", func() {
+		uploadFile(client, "/feed/a.txt", []byte("a"))
+
+		Expect(poll()).To(Equal([]received{{names: []string{"folder:/feed", "file:/feed/a.txt"}, reset: true}}))
+
+		cursor, err := cursors.Load(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cursor).NotTo(BeEmpty())
+
+		uploadFile(client, "/feed/b.txt", []byte("b"))
+
+		Expect(poll()).To(Equal([]received{{names: []string{"file:/feed/b.txt"}, reset: false}}))
+		Expect(poll()).To(Equal([]received{{names: []string{}, reset: false}}))
+	})
+
+	It("should deliver a batch again if the handler fails", func() {
+		poll()
+
+		uploadFile(client, "/feed/a.txt", []byte("a"))
+
+		handlerErr := errors.New("handler failed")
+		err := feed.Poll(context.Background(), func(ctx context.Context, batch *ChangeBatch) error {
+			return handlerErr
+		})
+		Expect(err).To(Equal(handlerErr))
+
+		Expect(poll()).To(Equal([]received{{names: []string{"file:/feed/a.txt"}, reset: false}}))
+	})
+
+	It("should recover when the listed folder was deleted", func() {
+		poll()
+
+		_, err := client.Delete(context.Background(), &DeleteArg{Path: "/feed"})
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = client.CreateFolder(context.Background(), &CreateFolderArg{Path: "/feed"})
+		Expect(err).NotTo(HaveOccurred())
+		uploadFile(client, "/feed/new.txt", []byte("new"))
+
+		Expect(poll()).To(Equal([]received{{names: []string{"folder:/feed", "file:/feed/new.txt"}, reset: true}}))
+		Expect(poll()).To(Equal([]received{{names: []string{}, reset: false}}))
+	})
+
+	It("should list the folder again when the deleted entries were compacted", func() {
+		poll()
+
+		uploadFile(client, "/feed/a.txt", []byte("a"))
+		mock.TokenStore("mock").CompactDeleted(0)
+
+		Expect(poll()).To(Equal([]received{{names: []string{"folder:/feed", "file:/feed/a.txt"}, reset: true}}))
+		Expect(poll()).To(Equal([]received{{names: []string{}, reset: false}}))
+	})
+
+	It("should resume from a file cursor store", func() {
+		cursorPath := filepath.Join(GinkgoT().TempDir(), "cursor")
+
+		feed = NewChangeFeed(client, &ListFolderArg{Path: "/feed", Recursive: true}, NewFileCursorStore(cursorPath))
+		poll()
+
+		uploadFile(client, "/feed/a.txt", []byte("a"))
+
+		feed = NewChangeFeed(client, &ListFolderArg{Path: "/feed", Recursive: true}, NewFileCursorStore(cursorPath))
+		Expect(poll()).To(Equal([]received{{names: []string{"file:/feed/a.txt"}, reset: false}}))
+
+		Expect(NewFileCursorStore(cursorPath).Save(context.Background(), "")).To(Succeed())
+		cursor, err := NewFileCursorStore(cursorPath).Load(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cursor).To(BeEmpty())
+	})
+})
@@ -0,0 +1,27 @@
+package dropboxclient
+
+import (
+	"context"
+	"io"
+
+	"github.com/koofr/go-ioutils"
+)
+
+// Client is the Dropbox API implemented by Dropbox. Code that only calls the
+// endpoints can accept a Client and be tested with mockdropbox.MemoryClient.
+type Client interface {
+	GetSpaceUsage(ctx context.Context) (*SpaceUsage, error)
+	GetMetadata(ctx context.Context, arg *GetMetadataArg) (*Metadata, error)
+	ListFolder(ctx context.Context, arg *ListFolderArg) (*ListFolderResult, error)
+	ListFolderContinue(ctx context.Context, arg *ListFolderContinueArg) (*ListFolderResult, error)
+	CreateFolder(ctx context.Context, arg *CreateFolderArg) (*Metadata, error)
+	Delete(ctx context.Context, arg *DeleteArg) (*Metadata, error)
+	Copy(ctx context.Context, arg *RelocationArg) (*Metadata, error)
+	Move(ctx context.Context, arg *RelocationArg) (*Metadata, error)
+	Download(ctx context.Context, arg *DownloadArg, span *ioutils.FileSpan) (io.ReadCloser, *Metadata, error)
+	UploadSessionStart(ctx context.Context, reader io.Reader) (*UploadSessionStartResult, error)
+	UploadSessionAppend(ctx context.Context, arg *UploadSessionCursor, reader io.Reader) error
+	UploadSessionFinish(ctx context.Context, arg *UploadSessionFinishArg) (*Metadata, error)
+}
+
+var _ Client = (*Dropbox)(nil)
@@ -0,0 +1,74 @@
+package dropboxclient
+
+import (
+	"crypto/sha256"
+	"hash"
+)
+
+// ContentHashBlockSize is the block size used by the Dropbox content hash.
+const ContentHashBlockSize = 4 * 1024 * 1024
+
+// ContentHash implements the Dropbox content hash: the data is split into
+// 4 MiB blocks, every block is hashed with SHA-256 and the final hash is the
+// SHA-256 of the concatenated block hashes.
+//
+// https://www.dropbox.com/developers/reference/content-hash
+type ContentHash struct {
+	blockSums []byte
+	block     hash.Hash
+	blockLen  int
+}
+
+func NewContentHash() *ContentHash {
+	return &ContentHash{
+		block: sha256.New(),
+	}
+}
+
+func (h *ContentHash) Write(p []byte) (n int, err error) {
+	n = len(p)
+
+	for len(p) > 0 {
+		chunk := ContentHashBlockSize - h.blockLen
+		if chunk > len(p) {
+			chunk = len(p)
+		}
+
+		h.block.Write(p[:chunk])
+		h.blockLen += chunk
+		p = p[chunk:]
+
+		if h.blockLen == ContentHashBlockSize {
+			h.blockSums = h.block.Sum(h.blockSums)
+			h.block.Reset()
+			h.blockLen = 0
+		}
+	}
+
+	return n, nil
+}
+
+func (h *ContentHash) Sum(b []byte) []byte {
+	overall := sha256.New()
+	overall.Write(h.blockSums)
+
+	if h.blockLen > 0 {
+		overall.Write(h.block.Sum(nil))
+	}
+
+	return overall.Sum(b)
+}
+
+func (h *ContentHash) Reset() {
+	h.blockSums = nil
+	h.block.Reset()
+	h.blockLen = 0
+}
+
+func (h *ContentHash) Size() int {
+	return sha256.Size
+}
+
+func (h *ContentHash) BlockSize() int {
+	return sha256.BlockSize
+}
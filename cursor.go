@@ -0,0 +1,94 @@
+package dropboxclient
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// CursorStore persists a list folder cursor. Load returns an empty cursor if
+// none was saved yet. Saving an empty cursor forgets the saved one.
+type CursorStore interface {
+	Load(ctx context.Context) (cursor string, err error)
+	Save(ctx context.Context, cursor string) error
+}
+
+// MemoryCursorStore keeps the cursor in memory.
+type MemoryCursorStore struct {
+	mutex  sync.Mutex
+	cursor string
+}
+
+func NewMemoryCursorStore() *MemoryCursorStore {
+	return &MemoryCursorStore{}
+}
+
+func (s *MemoryCursorStore) Load(ctx context.Context) (string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.cursor, nil
+}
+
+func (s *MemoryCursorStore) Save(ctx context.Context, cursor string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.cursor = cursor
+
+	return nil
+}
+
+// FileCursorStore keeps the cursor in a file. The file is replaced
+// atomically so a crash never leaves a partially written cursor behind.
+type FileCursorStore struct {
+	Path string
+}
+
+func NewFileCursorStore(path string) *FileCursorStore {
+	return &FileCursorStore{Path: path}
+}
+
+func (s *FileCursorStore) Load(ctx context.Context) (string, error) {
+	data, err := os.ReadFile(s.Path)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(data)), nil
+}
+
+func (s *FileCursorStore) Save(ctx context.Context, cursor string) error {
+	if cursor == "" {
+		err := os.Remove(s.Path)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(s.Path), "."+filepath.Base(s.Path)+"-*")
+	if err != nil {
+		return err
+	}
+	tmpPath := f.Name()
+
+	_, err = f.WriteString(cursor)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, s.Path)
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,170 @@
+package dropboxclient_test
+
+import (
+	"context"
+
+	. "github.com/koofr/go-dropboxclient"
+	"github.com/koofr/go-dropboxclient/mockdropbox"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("MockDropbox deleted entries", func() {
+	ctx := context.Background()
+
+	var store *mockdropbox.Store
+	var client *mockdropbox.MemoryClient
+
+	BeforeEach(func() {
+		store = mockdropbox.NewStore()
+		client = mockdropbox.NewMemoryClientWithStore(store)
+	})
+
+	createFolder := func(path string) {
+		_, err := client.CreateFolder(ctx, &CreateFolderArg{Path: path})
+		Expect(err).NotTo(HaveOccurred())
+	}
+
+	deletePath := func(path string) {
+		_, err := client.Delete(ctx, &DeleteArg{Path: path})
+		Expect(err).NotTo(HaveOccurred())
+	}
+
+	cursor := func(path string, recursive bool) string {
+		res, err := client.ListFolder(ctx, &ListFolderArg{Path: path, Recursive: recursive})
+		Expect(err).NotTo(HaveOccurred())
+		return res.Cursor
+	}
+
+	changes := func(cursor string) []string {
+		res, err := client.ListFolderContinue(ctx, &ListFolderContinueArg{Cursor: cursor})
+		Expect(err).NotTo(HaveOccurred())
+		entries := []string{}
+		for _, md := range res.Entries {
+			entries = append(entries, md.Tag+" "+md.PathLower)
+		}
+		return entries
+	}
+
+	expectReset := func(cursor string) {
+		_, err := client.ListFolderContinue(ctx, &ListFolderContinueArg{Cursor: cursor})
+		dropboxErr, ok := IsDropboxError(err)
+		Expect(ok).To(BeTrue())
+		Expect(dropboxErr.Err.Tag).To(Equal("reset"))
+	}
+
+	It("should only list deleted entries of the listed folder", func() {
+		createFolder("/a")
+		createFolder("/a/b")
+		createFolder("/a/b/c")
+		createFolder("/ab")
+
+		root := cursor("", false)
+		children := cursor("/a", false)
+		recursive := cursor("/a", true)
+
+		deletePath("/a/b/c")
+		deletePath("/ab")
+
+		Expect(changes(root)).To(Equal([]string{"deleted /ab"}))
+		Expect(changes(children)).To(Equal([]string{}))
+		Expect(changes(recursive)).To(Equal([]string{"deleted /a/b/c"}))
+	})
+
+	It("should list deleted entries on the initial listing with include_deleted", func() {
+		createFolder("/a")
+		createFolder("/a/gone")
+		createFolder("/a/gone/nested")
+		createFolder("/a/back")
+		createFolder("/other")
+		deletePath("/a/gone")
+		deletePath("/a/back")
+		deletePath("/other")
+		createFolder("/a/back")
+
+		res, err := client.ListFolder(ctx, &ListFolderArg{Path: "/a", IncludeDeleted: true})
+		Expect(err).NotTo(HaveOccurred())
+		entries := []string{}
+		for _, md := range res.Entries {
+			entries = append(entries, md.Tag+" "+md.PathLower)
+		}
+		Expect(entries).To(ConsistOf("deleted /a/gone", "folder /a/back"))
+
+		res, err = client.ListFolder(ctx, &ListFolderArg{Path: "/a", Recursive: true})
+		Expect(err).NotTo(HaveOccurred())
+		for _, md := range res.Entries {
+			Expect(md.Tag).NotTo(Equal(MetadataDeleted))
+		}
+	})
+
+	It("should reset cursors from before compacted deleted entries", func() {
+		createFolder("/a")
+		createFolder("/b")
+		old := cursor("", true)
+		deletePath("/a")
+
+		store.CompactDeleted(0)
+		Expect(store.GetDeletedItems()).To(BeEmpty())
+		expectReset(old)
+
+		current := cursor("", true)
+		deletePath("/b")
+		Expect(changes(current)).To(Equal([]string{"deleted /b"}))
+	})
+
+	It("should keep the newest deleted entries up to the limit", func() {
+		store = mockdropbox.NewStore(mockdropbox.WithDeletedLimit(2))
+		client = mockdropbox.NewMemoryClientWithStore(store)
+
+		createFolder("/a")
+		createFolder("/b")
+		createFolder("/c")
+		old := cursor("", true)
+		deletePath("/a")
+		recent := cursor("", true)
+		deletePath("/b")
+		deletePath("/c")
+
+		Expect(store.GetDeletedItems()).To(HaveLen(2))
+		expectReset(old)
+		Expect(changes(recent)).To(Equal([]string{"deleted /b", "deleted /c"}))
+	})
+
+	It("should reset cursors from before a store reset", func() {
+		createFolder("/a")
+		old := cursor("", true)
+
+		store.Reset()
+
+		expectReset(old)
+	})
+
+	It("should keep the compaction after a restart", func() {
+		dir := GinkgoT().TempDir()
+
+		backend, err := mockdropbox.NewDiskBackend(dir)
+		Expect(err).NotTo(HaveOccurred())
+		store, err = mockdropbox.NewStoreWithBackend(backend)
+		Expect(err).NotTo(HaveOccurred())
+		client = mockdropbox.NewMemoryClientWithStore(store)
+
+		createFolder("/a")
+		createFolder("/b")
+		old := cursor("", true)
+		deletePath("/a")
+		store.CompactDeleted(0)
+		deletePath("/b")
+		Expect(store.Close()).To(Succeed())
+
+		backend, err = mockdropbox.NewDiskBackend(dir)
+		Expect(err).NotTo(HaveOccurred())
+		store, err = mockdropbox.NewStoreWithBackend(backend)
+		Expect(err).NotTo(HaveOccurred())
+		defer store.Close()
+		client = mockdropbox.NewMemoryClientWithStore(store)
+
+		Expect(store.GetDeletedItems()).To(HaveLen(1))
+		expectReset(old)
+	})
+})
@@ -0,0 +1,99 @@
+package dropboxclient_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/koofr/go-dropboxclient/mockdropbox"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Deterministic MockDropbox", func() {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// transcript runs the same operations against mock and returns the raw
+	// responses.
+	transcript := func(mock *mockdropbox.MockDropbox) string {
+		client := &http.Client{Transport: mock.Transport()}
+		out := &bytes.Buffer{}
+		var last map[string]interface{}
+
+		call := func(route string, arg string, body []byte) {
+			var req *http.Request
+			var err error
+			if body != nil {
+				req, err = http.NewRequest("POST", "http://mockdropbox.test/2/"+route, bytes.NewReader(body))
+				Expect(err).NotTo(HaveOccurred())
+				req.Header.Set("Dropbox-API-Arg", arg)
+				req.Header.Set("Content-Type", "application/octet-stream")
+			} else {
+				req, err = http.NewRequest("POST", "http://mockdropbox.test/2/"+route, bytes.NewReader([]byte(arg)))
+				Expect(err).NotTo(HaveOccurred())
+				req.Header.Set("Content-Type", "application/json")
+			}
+			req.Header.Set("Authorization", "Bearer mock")
+
+			res, err := client.Do(req)
+			Expect(err).NotTo(HaveOccurred())
+			defer res.Body.Close()
+			data, err := io.ReadAll(res.Body)
+			Expect(err).NotTo(HaveOccurred())
+
+			fmt.Fprintf(out, "%s %d %s %s\n", route, res.StatusCode, res.Header.Get("Dropbox-Api-Result"), data)
+
+			last = nil
+			json.Unmarshal(data, &last)
+		}
+
+		call("files/create_folder", `{"path": "/dir"}`, nil)
+		call("files/upload_session/start", `{}`, []byte("hello"))
+		sessionID := last["session_id"]
+		call("files/upload_session/finish", fmt.Sprintf(`{"cursor": {"session_id": %q, "offset": 5}, "commit": {"path": "/dir/a.txt", "mode": {".tag": "add"}}}`, sessionID), []byte{})
+		call("files/list_folder", `{"path": "", "recursive": true}`, nil)
+		cursor := last["cursor"]
+		call("files/copy", `{"from_path": "/dir", "to_path": "/copy"}`, nil)
+		call("files/move", `{"from_path": "/copy/a.txt", "to_path": "/b.txt"}`, nil)
+		call("files/delete", `{"path": "/dir"}`, nil)
+		call("files/list_folder/continue", fmt.Sprintf(`{"cursor": %q}`, cursor), nil)
+		call("files/get_metadata", `{"path": "/b.txt"}`, nil)
+		call("files/download", `{"path": "/b.txt"}`, []byte{})
+
+		return out.String()
+	}
+
+	newMock := func(seed int64) *mockdropbox.MockDropbox {
+		return mockdropbox.New(
+			mockdropbox.WithSeed(seed),
+			mockdropbox.WithClock(mockdropbox.NewFakeClock(start, time.Second)),
+		)
+	}
+
+	It("should give identical responses for identical operations", func() {
+		first := transcript(newMock(7))
+		Expect(first).To(ContainSubstring(`"server_modified":"2020-01-01T00:00:`))
+		Expect(transcript(newMock(7))).To(Equal(first))
+		Expect(transcript(newMock(8))).NotTo(Equal(first))
+	})
+
+	It("should generate different account IDs for different access tokens", func() {
+		mock := newMock(7)
+		Expect(mock.TokenStore("a").AccountID()).NotTo(Equal(mock.TokenStore("b").AccountID()))
+		Expect(newMock(7).TokenStore("a").AccountID()).To(Equal(mock.TokenStore("a").AccountID()))
+	})
+
+	It("should only move the fake clock when asked", func() {
+		clock := mockdropbox.NewFakeClock(start, 0)
+		Expect(clock.Now()).To(Equal(start))
+		Expect(clock.Now()).To(Equal(start))
+		clock.Advance(time.Minute)
+		Expect(clock.Now()).To(Equal(start.Add(time.Minute)))
+		clock.Set(start)
+		Expect(clock.Now()).To(Equal(start))
+	})
+})
@@ -0,0 +1,96 @@
+package dropboxclient_test
+
+import (
+	"context"
+	"io"
+
+	. "github.com/koofr/go-dropboxclient"
+	"github.com/koofr/go-dropboxclient/mockdropbox"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("DiskBackend", func() {
+	var dir string
+
+	BeforeEach(func() {
+		dir = GinkgoT().TempDir()
+	})
+
+	openMock := func() (*Dropbox, *mockdropbox.MockDropbox) {
+		mock := mockdropbox.NewWithBackends(mockdropbox.DiskBackends(dir))
+
+		client, err := New(
+			WithAccessToken("mock"),
+			WithBaseURL("http://mockdropbox.test"),
+			WithTransport(mock.Transport()),
+		)
+		Expect(err).NotTo(HaveOccurred())
+
+		return client, mock
+	}
+
+	describeConformance(func() (Client, error) {
+		backend, err := mockdropbox.NewDiskBackend(GinkgoT().TempDir())
+		if err != nil {
+			return nil, err
+		}
+		store, err := mockdropbox.NewStoreWithBackend(backend)
+		if err != nil {
+			return nil, err
+		}
+		DeferCleanup(store.Close)
+		return mockdropbox.NewMemoryClientWithStore(store), nil
+	}, mockDivergences)
+
+	It("should restore the store after a restart", func() {
+		ctx := context.Background()
+
+		client, mock := openMock()
+		accountID := mock.TokenStore("mock").AccountID()
+
+		_, err := client.CreateFolder(ctx, &CreateFolderArg{Path: "/dir"})
+		Expect(err).NotTo(HaveOccurred())
+		uploadFile(client, "/dir/file.txt", []byte("hello"))
+		_, err = client.CreateFolder(ctx, &CreateFolderArg{Path: "/dir/sub"})
+		Expect(err).NotTo(HaveOccurred())
+		_, err = client.Move(ctx, &RelocationArg{FromPath: "/dir/sub", ToPath: "/moved"})
+		Expect(err).NotTo(HaveOccurred())
+
+		listing, err := client.ListFolder(ctx, &ListFolderArg{Path: "/dir"})
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = client.Delete(ctx, &DeleteArg{Path: "/dir/file.txt"})
+		Expect(err).NotTo(HaveOccurred())
+		uploadFile(client, "/moved/file.txt", []byte("world"))
+
+		Expect(mock.Close()).To(Succeed())
+
+		client, mock = openMock()
+		defer mock.Close()
+
+		Expect(mock.TokenStore("mock").AccountID()).To(Equal(accountID))
+
+		md, err := client.GetMetadata(ctx, &GetMetadataArg{Path: "/moved"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(md.Tag).To(Equal(MetadataFolder))
+
+		_, err = client.GetMetadata(ctx, &GetMetadataArg{Path: "/dir/sub"})
+		Expect(err).To(HaveOccurred())
+
+		changes, err := client.ListFolderContinue(ctx, &ListFolderContinueArg{Cursor: listing.Cursor})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(changes.Entries).To(HaveLen(1))
+		Expect(changes.Entries[0].Tag).To(Equal(MetadataDeleted))
+		Expect(changes.Entries[0].PathLower).To(Equal("/dir/file.txt"))
+
+		reader, md, err := client.Download(ctx, &DownloadArg{Path: "/moved/file.txt"}, nil)
+		Expect(err).NotTo(HaveOccurred())
+		defer reader.Close()
+		Expect(md.Size).To(Equal(int64(5)))
+		data, err := io.ReadAll(reader)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(data)).To(Equal("world"))
+	})
+})
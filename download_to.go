@@ -0,0 +1,296 @@
+package dropboxclient
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/koofr/go-ioutils"
+)
+
+var ErrContentHashMismatch = errors.New("dropboxclient: downloaded content hash mismatch")
+
+// writeAtError wraps an error returned by the destination so that it is not
+// retried like a failed request.
+type writeAtError struct {
+	err error
+}
+
+func (e *writeAtError) Error() string {
+	return e.err.Error()
+}
+
+func (e *writeAtError) Unwrap() error {
+	return e.err
+}
+
+const DefaultDownloadToSegmentSize = 4 * ContentHashBlockSize
+const DefaultDownloadToConcurrency = 4
+const DefaultDownloadToMaxRetries = 5
+const DefaultDownloadToRetryDelay = 1 * time.Second
+
+type DownloadToOptions struct {
+	// SegmentSize is the size of a single range request. It is rounded up to
+	// a multiple of ContentHashBlockSize so that segments can be hashed
+	// independently. Defaults to DefaultDownloadToSegmentSize.
+	SegmentSize int64
+	// Concurrency is the number of segments downloaded at the same time.
+	// Defaults to DefaultDownloadToConcurrency.
+	Concurrency int
+	// MaxRetries is the number of consecutive failed attempts without
+	// progress allowed per segment. Defaults to DefaultDownloadToMaxRetries.
+	MaxRetries int
+	// RetryDelay is multiplied by the attempt number before retrying a
+	// segment. Defaults to DefaultDownloadToRetryDelay.
+	RetryDelay time.Duration
+	// OnProgress is called with the total number of bytes written so far.
+	// It may be called concurrently from multiple goroutines.
+	OnProgress func(bytesWritten int64, total int64)
+}
+
+type downloadSegment struct {
+	start  int64
+	length int64
+	// firstBlock is the index of the first content hash block in the segment
+	firstBlock int
+}
+
+// DownloadTo downloads the file at path into w using concurrent range
+// requests and verifies the content hash of the result. It returns ErrIsDir
+// without writing to w if path is a folder.
+func (c *Dropbox) DownloadTo(ctx context.Context, path string, w io.WriterAt, opts *DownloadToOptions) (result *Metadata, err error) {
+	o := DownloadToOptions{}
+	if opts != nil {
+		o = *opts
+	}
+	if o.SegmentSize <= 0 {
+		o.SegmentSize = DefaultDownloadToSegmentSize
+	}
+	if rem := o.SegmentSize % ContentHashBlockSize; rem != 0 {
+		o.SegmentSize += ContentHashBlockSize - rem
+	}
+	if o.Concurrency <= 0 {
+		o.Concurrency = DefaultDownloadToConcurrency
+	}
+	if o.MaxRetries <= 0 {
+		o.MaxRetries = DefaultDownloadToMaxRetries
+	}
+	if o.RetryDelay <= 0 {
+		o.RetryDelay = DefaultDownloadToRetryDelay
+	}
+
+	result, err = c.GetMetadata(ctx, &GetMetadataArg{Path: path})
+	if err != nil {
+		return nil, err
+	}
+	if result.Tag != MetadataFile {
+		return nil, ErrIsDir
+	}
+
+	size := result.Size
+
+	segments := []*downloadSegment{}
+	for start := int64(0); start < size; start += o.SegmentSize {
+		length := o.SegmentSize
+		if start+length > size {
+			length = size - start
+		}
+		segments = append(segments, &downloadSegment{
+			start:      start,
+			length:     length,
+			firstBlock: int(start / ContentHashBlockSize),
+		})
+	}
+
+	numBlocks := int((size + ContentHashBlockSize - 1) / ContentHashBlockSize)
+	blockSums := make([][]byte, numBlocks)
+
+	segmentsCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var written int64
+	onWrite := func(n int) {
+		total := atomic.AddInt64(&written, int64(n))
+		if o.OnProgress != nil {
+			o.OnProgress(total, size)
+		}
+	}
+
+	jobs := make(chan *downloadSegment)
+	errs := make(chan error, len(segments))
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < o.Concurrency && i < len(segments); i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for seg := range jobs {
+				err := c.downloadSegment(segmentsCtx, path, result.Rev, w, seg, blockSums, &o, onWrite)
+				if err != nil {
+					errs <- err
+					cancel()
+				}
+			}
+		}()
+	}
+
+	for _, seg := range segments {
+		select {
+		case jobs <- seg:
+		case <-segmentsCtx.Done():
+		}
+	}
+
+	close(jobs)
+	wg.Wait()
+	close(errs)
+
+	if err, ok := <-errs; ok {
+		return nil, err
+	}
+
+	// segments are no longer dispatched once ctx is done
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	overall := sha256.New()
+	for _, sum := range blockSums {
+		overall.Write(sum)
+	}
+
+	if result.ContentHash != "" && hex.EncodeToString(overall.Sum(nil)) != result.ContentHash {
+		return nil, ErrContentHashMismatch
+	}
+
+	return result, nil
+}
+
+func (c *Dropbox) downloadSegment(ctx context.Context, path string, rev string, w io.WriterAt, seg *downloadSegment, blockSums [][]byte, opts *DownloadToOptions, onWrite func(n int)) error {
+	sw := &segmentWriter{
+		w:         w,
+		seg:       seg,
+		blockSums: blockSums,
+		block:     sha256.New(),
+		onWrite:   onWrite,
+	}
+
+	failures := 0
+
+	for sw.done < seg.length {
+		doneBefore := sw.done
+
+		err := c.downloadSegmentAttempt(withRetry(ctx, failures), path, rev, sw)
+		if err == nil {
+			continue
+		}
+
+		if sw.done > doneBefore {
+			failures = 0
+		}
+
+		var writeErr *writeAtError
+		if errors.As(err, &writeErr) {
+			return writeErr.err
+		}
+
+		failures++
+		if !isRetryableError(err) || failures > opts.MaxRetries {
+			return err
+		}
+
+		select {
+		case <-time.After(opts.RetryDelay * time.Duration(failures)):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	return nil
+}
+
+func (c *Dropbox) downloadSegmentAttempt(ctx context.Context, path string, rev string, sw *segmentWriter) error {
+	span := &ioutils.FileSpan{
+		Start: sw.seg.start + sw.done,
+		End:   sw.seg.start + sw.seg.length - 1,
+	}
+
+	reader, result, err := c.Download(ctx, &DownloadArg{Path: path}, span)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	if result.Rev != rev {
+		return ErrDownloadChanged
+	}
+
+	remaining := sw.seg.length - sw.done
+
+	n, err := io.Copy(sw, io.LimitReader(reader, remaining))
+	if err != nil {
+		return err
+	}
+	if n < remaining {
+		return io.ErrUnexpectedEOF
+	}
+
+	return nil
+}
+
+// segmentWriter writes a segment into the destination at the right offset
+// and hashes its content hash blocks as they complete. Its state survives
+// failed attempts so that a retry continues where the last one stopped.
+type segmentWriter struct {
+	w         io.WriterAt
+	seg       *downloadSegment
+	blockSums [][]byte
+	block     hash.Hash
+	blockLen  int64
+	done      int64
+	onWrite   func(n int)
+}
+
+func (sw *segmentWriter) Write(p []byte) (n int, err error) {
+	n, err = sw.w.WriteAt(p, sw.seg.start+sw.done)
+
+	written := p[:n]
+
+	for len(written) > 0 {
+		chunk := int64(len(written))
+		if chunk > ContentHashBlockSize-sw.blockLen {
+			chunk = ContentHashBlockSize - sw.blockLen
+		}
+
+		sw.block.Write(written[:chunk])
+		sw.blockLen += chunk
+		sw.done += chunk
+		written = written[chunk:]
+
+		if sw.blockLen == ContentHashBlockSize || sw.done == sw.seg.length {
+			blockIndex := sw.seg.firstBlock + int((sw.done-1)/ContentHashBlockSize)
+			sw.blockSums[blockIndex] = sw.block.Sum(nil)
+			sw.block.Reset()
+			sw.blockLen = 0
+		}
+	}
+
+	if n > 0 {
+		sw.onWrite(n)
+	}
+
+	if err != nil {
+		return n, &writeAtError{err: err}
+	}
+
+	return n, nil
+}
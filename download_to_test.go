@@ -0,0 +1,198 @@
+package dropboxclient_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	. "github.com/koofr/go-dropboxclient"
+	"github.com/koofr/go-dropboxclient/mockdropbox"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+type memWriterAt struct {
+	data  []byte
+	mutex sync.Mutex
+}
+
+func (w *memWriterAt) WriteAt(p []byte, off int64) (n int, err error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if end := off + int64(len(p)); end > int64(len(w.data)) {
+		w.data = append(w.data, make([]byte, end-int64(len(w.data)))...)
+	}
+
+	return copy(w.data[off:], p), nil
+}
+
+type failingWriterAt struct {
+	err   error
+	calls int32
+}
+
+func (w *failingWriterAt) WriteAt(p []byte, off int64) (n int, err error) {
+	atomic.AddInt32(&w.calls, 1)
+	return 0, w.err
+}
+
+var _ = Describe("ContentHash", func() {
+	It("should hash empty content", func() {
+		h := NewContentHash()
+		Expect(hex.EncodeToString(h.Sum(nil))).To(Equal("e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"))
+	})
+
+	It("should hash content in blocks", func() {
+		data := make([]byte, ContentHashBlockSize+100)
+		rand.Read(data)
+
+		block1 := sha256.Sum256(data[:ContentHashBlockSize])
+		block2 := sha256.Sum256(data[ContentHashBlockSize:])
+		expected := sha256.Sum256(append(block1[:], block2[:]...))
+
+		h := NewContentHash()
+		h.Write(data[:10])
+		h.Write(data[10:])
+		Expect(h.Sum(nil)).To(Equal(expected[:]))
+	})
+})
+
+var _ = Describe("DownloadTo", func() {
+	var mock *mockdropbox.MockDropbox
+	var client *Dropbox
+	var stop func()
+
+	BeforeEach(func() {
+		client, mock, stop = startMockClient()
+	})
+
+	AfterEach(func() {
+		stop()
+	})
+
+	upload := func(name string, data []byte) *Metadata {
+		return uploadFile(client, "/"+name, data)
+	}
+
+	It("should download a file in segments", func() {
+		name := fmt.Sprintf("new-file-%d", rand.Int())
+		data := make([]byte, 2*ContentHashBlockSize+12345)
+		rand.Read(data)
+		uploaded := upload(name, data)
+
+		var mutex sync.Mutex
+		var lastProgress int64
+		w := &memWriterAt{}
+
+		md, err := client.DownloadTo(context.Background(), "/"+name, w, &DownloadToOptions{
+			SegmentSize: 1,
+			Concurrency: 2,
+			OnProgress: func(bytesWritten int64, total int64) {
+				mutex.Lock()
+				defer mutex.Unlock()
+				if bytesWritten > lastProgress {
+					lastProgress = bytesWritten
+				}
+			},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(md.Rev).To(Equal(uploaded.Rev))
+		Expect(md.ContentHash).NotTo(BeEmpty())
+		Expect(w.data).To(Equal(data))
+		Expect(lastProgress).To(Equal(int64(len(data))))
+	})
+
+	It("should download an empty file", func() {
+		name := fmt.Sprintf("new-file-%d", rand.Int())
+		upload(name, []byte{})
+
+		w := &memWriterAt{}
+
+		_, err := client.DownloadTo(context.Background(), "/"+name, w, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(w.data).To(BeEmpty())
+	})
+
+	It("should retry segments when connections drop", func() {
+		name := fmt.Sprintf("new-file-%d", rand.Int())
+		data := make([]byte, 2*ContentHashBlockSize+12345)
+		rand.Read(data)
+		upload(name, data)
+
+		mock.CutDownloadsAfter(1024 * 1024)
+
+		w := &memWriterAt{}
+
+		_, err := client.DownloadTo(context.Background(), "/"+name, w, &DownloadToOptions{
+			SegmentSize: ContentHashBlockSize,
+			Concurrency: 3,
+			MaxRetries:  2,
+			RetryDelay:  time.Millisecond,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(w.data).To(Equal(data))
+	})
+
+	It("should stop when the context is cancelled", func() {
+		name := fmt.Sprintf("new-file-%d", rand.Int())
+		data := make([]byte, 2*ContentHashBlockSize)
+		rand.Read(data)
+		upload(name, data)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		_, err := client.DownloadTo(ctx, "/"+name, &memWriterAt{}, &DownloadToOptions{
+			SegmentSize: ContentHashBlockSize,
+			Concurrency: 1,
+			OnProgress: func(bytesWritten int64, total int64) {
+				if bytesWritten == ContentHashBlockSize {
+					cancel()
+				}
+			},
+		})
+		Expect(err).To(Equal(context.Canceled))
+	})
+
+	It("should not retry destination write errors", func() {
+		name := fmt.Sprintf("new-file-%d", rand.Int())
+		upload(name, []byte("12345"))
+
+		writeErr := errors.New("disk full")
+		w := &failingWriterAt{err: writeErr}
+
+		_, err := client.DownloadTo(context.Background(), "/"+name, w, &DownloadToOptions{
+			MaxRetries: 2,
+			RetryDelay: time.Millisecond,
+		})
+		Expect(err).To(Equal(writeErr))
+		Expect(w.calls).To(Equal(int32(1)))
+	})
+
+	It("should fail for a folder without writing", func() {
+		_, err := client.CreateFolder(context.Background(), &CreateFolderArg{Path: "/folder"})
+		Expect(err).NotTo(HaveOccurred())
+
+		w := &memWriterAt{data: []byte("existing")}
+		_, err = client.DownloadTo(context.Background(), "/folder", w, nil)
+		Expect(err).To(Equal(ErrIsDir))
+		Expect(string(w.data)).To(Equal("existing"))
+	})
+
+	It("should fail for a missing file", func() {
+		_, err := client.DownloadTo(context.Background(), "/missing", &memWriterAt{}, nil)
+		Expect(err).To(HaveOccurred())
+
+		dropboxErr, ok := IsDropboxError(err)
+		Expect(ok).To(BeTrue())
+		Expect(dropboxErr.Err.Tag).To(Equal("path"))
+	})
+})
@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"net/url"
 	"strconv"
+	"time"
 
 	"github.com/koofr/go-httpclient"
 	"github.com/koofr/go-ioutils"
@@ -20,11 +21,23 @@ const (
 type Dropbox struct {
 	ApiHTTPClient     *httpclient.HTTPClient
 	ContentHTTPClient *httpclient.HTTPClient
+
+	// ApiTimeout and ContentTimeout limit requests of each endpoint class
+	// until the response is received. The body of a download is not
+	// limited. Zero means no limit.
+	ApiTimeout     time.Duration
+	ContentTimeout time.Duration
+
+	// TokenSource provides the access token of API and content requests. If
+	// nil the Authorization header of the HTTP clients is used.
+	TokenSource TokenSource
+
+	middlewares []Middleware
 }
 
 func NewDropbox(accessToken string) (dropbox *Dropbox) {
-	apiBaseUrl, _ := url.Parse("https://api.dropboxapi.com")
-	contentBaseUrl, _ := url.Parse("https://content.dropboxapi.com")
+	apiBaseUrl, _ := url.Parse(DefaultApiBaseURL)
+	contentBaseUrl, _ := url.Parse(DefaultContentBaseURL)
 
 	apiHttpClient := httpclient.New()
 	apiHttpClient.BaseURL = apiBaseUrl
@@ -91,13 +104,13 @@ func (c *Dropbox) HandleError(err error) error {
 }
 
 func (c *Dropbox) Request(client *httpclient.HTTPClient, req *httpclient.RequestData) (res *http.Response, err error) {
-	res, err = client.Request(req)
+	handler := c.doCall
 
-	if err != nil {
-		return res, c.HandleError(err)
+	for i := len(c.middlewares) - 1; i >= 0; i-- {
+		handler = c.middlewares[i](handler)
 	}
 
-	return res, nil
+	return handler(newCall(client, req))
 }
 
 func (c *Dropbox) ApiRequest(req *httpclient.RequestData) (res *http.Response, err error) {
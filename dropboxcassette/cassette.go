@@ -0,0 +1,127 @@
+// Package dropboxcassette records the HTTP interactions of a Dropbox client
+// to a cassette file and replays them, so tests recorded once against the
+// real API can run without an access token.
+package dropboxcassette
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+// Redacted replaces the values of redacted headers.
+const Redacted = "REDACTED"
+
+// RedactedHeaders are not stored in cassettes.
+var RedactedHeaders = []string{"Authorization"}
+
+// Body is a request or response body. It is stored as a string if it is
+// valid UTF-8 and base64 encoded otherwise.
+type Body []byte
+
+type bodyJSON struct {
+	Text   *string `json:"text,omitempty"`
+	Base64 *string `json:"base64,omitempty"`
+}
+
+func (b Body) MarshalJSON() ([]byte, error) {
+	if utf8.Valid(b) {
+		s := string(b)
+		return json.Marshal(bodyJSON{Text: &s})
+	}
+	s := base64.StdEncoding.EncodeToString(b)
+	return json.Marshal(bodyJSON{Base64: &s})
+}
+
+func (b *Body) UnmarshalJSON(data []byte) error {
+	v := bodyJSON{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	switch {
+	case v.Text != nil:
+		*b = Body(*v.Text)
+	case v.Base64 != nil:
+		data, err := base64.StdEncoding.DecodeString(*v.Base64)
+		if err != nil {
+			return err
+		}
+		*b = data
+	default:
+		*b = nil
+	}
+	return nil
+}
+
+type Request struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Header http.Header `json:"header"`
+	Body   Body        `json:"body"`
+}
+
+// Route returns the path of the request, e.g. "/2/files/list_folder".
+func (r *Request) Route() string {
+	u, err := url.Parse(r.URL)
+	if err != nil {
+		return ""
+	}
+	return u.Path
+}
+
+// Arg returns the JSON argument of the request, from the Dropbox-API-Arg
+// header for content requests and from the body for RPC requests.
+func (r *Request) Arg() []byte {
+	if arg := r.Header.Get("Dropbox-API-Arg"); arg != "" {
+		return []byte(arg)
+	}
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		return r.Body
+	}
+	return nil
+}
+
+type Response struct {
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header"`
+	Body       Body        `json:"body"`
+}
+
+type Interaction struct {
+	Request  *Request  `json:"request"`
+	Response *Response `json:"response"`
+}
+
+// Cassette is a list of recorded interactions.
+type Cassette struct {
+	Interactions []*Interaction `json:"interactions"`
+}
+
+// Load reads a cassette file.
+func Load(path string) (*Cassette, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	cassette := &Cassette{}
+	if err := json.Unmarshal(data, cassette); err != nil {
+		return nil, err
+	}
+
+	return cassette, nil
+}
+
+// Save writes the cassette to a file.
+func (c *Cassette) Save(path string) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
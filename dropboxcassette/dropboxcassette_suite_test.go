@@ -0,0 +1,13 @@
+package dropboxcassette_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestDropboxcassette(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Dropboxcassette Suite")
+}
@@ -0,0 +1,135 @@
+package dropboxcassette_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/koofr/go-dropboxclient"
+	. "github.com/koofr/go-dropboxclient/dropboxcassette"
+	"github.com/koofr/go-dropboxclient/mockdropbox"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Cassettes", func() {
+	ctx := context.Background()
+
+	var path string
+
+	BeforeEach(func() {
+		path = filepath.Join(GinkgoT().TempDir(), "cassette.json")
+	})
+
+	newClient := func(transport http.RoundTripper) *dropboxclient.Dropbox {
+		client, err := dropboxclient.New(
+			dropboxclient.WithAccessToken("secret-token"),
+			dropboxclient.WithBaseURL("http://mockdropbox.test"),
+			dropboxclient.WithTransport(transport),
+		)
+		Expect(err).NotTo(HaveOccurred())
+		return client
+	}
+
+	// run uploads a file, lists the root and downloads the file.
+	run := func(client *dropboxclient.Dropbox) (*dropboxclient.ListFolderResult, []byte, error) {
+		session, err := client.UploadSessionStart(ctx, bytes.NewReader([]byte{0xff, 0x00, 0x01}))
+		if err != nil {
+			return nil, nil, err
+		}
+		_, err = client.UploadSessionFinish(ctx, &dropboxclient.UploadSessionFinishArg{
+			Cursor: &dropboxclient.UploadSessionCursor{SessionId: session.SessionId, Offset: 3},
+			Commit: &dropboxclient.CommitInfo{Path: "/file.bin", Mode: &dropboxclient.WriteMode{Tag: dropboxclient.WriteModeAdd}},
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		list, err := client.ListFolder(ctx, &dropboxclient.ListFolderArg{Path: ""})
+		if err != nil {
+			return nil, nil, err
+		}
+		reader, _, err := client.Download(ctx, &dropboxclient.DownloadArg{Path: "/file.bin"}, nil)
+		if err != nil {
+			return nil, nil, err
+		}
+		defer reader.Close()
+		data, err := io.ReadAll(reader)
+		return list, data, err
+	}
+
+	record := func() (*dropboxclient.ListFolderResult, []byte) {
+		recorder := NewRecorder(mockdropbox.New().Transport())
+		list, data, err := run(newClient(recorder))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(recorder.Save(path)).To(Succeed())
+		return list, data
+	}
+
+	It("should replay recorded interactions", func() {
+		list, data := record()
+
+		cassette, err := Load(path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cassette.Interactions).To(HaveLen(4))
+
+		replayer := NewReplayer(cassette, MatchRouteAndArg("cursor"))
+		replayedList, replayedData, err := run(newClient(replayer))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(replayedList).To(Equal(list))
+		Expect(replayedData).To(Equal(data))
+		Expect(replayer.Remaining()).To(Equal(0))
+	})
+
+	It("should keep the Dropbox API headers and redact the access token", func() {
+		record()
+
+		content, err := os.ReadFile(path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(content)).NotTo(ContainSubstring("secret-token"))
+
+		cassette, err := Load(path)
+		Expect(err).NotTo(HaveOccurred())
+
+		download := cassette.Interactions[3]
+		Expect(download.Request.Route()).To(Equal("/2/files/download"))
+		Expect(download.Request.Header.Get("Authorization")).To(Equal(Redacted))
+		Expect(string(download.Request.Arg())).To(MatchJSON(`{"path": "/file.bin"}`))
+		Expect(download.Response.Header.Get("Dropbox-Api-Result")).To(ContainSubstring(`"name":"file.bin"`))
+		Expect([]byte(download.Response.Body)).To(Equal([]byte{0xff, 0x00, 0x01}))
+	})
+
+	It("should fail requests that match no interaction", func() {
+		record()
+
+		cassette, err := Load(path)
+		Expect(err).NotTo(HaveOccurred())
+
+		client := newClient(NewReplayer(cassette, nil))
+		_, err = client.GetMetadata(ctx, &dropboxclient.GetMetadataArg{Path: "/other"})
+		Expect(errors.Is(err, ErrNoInteraction)).To(BeTrue())
+	})
+
+	It("should match on the argument JSON", func() {
+		recorded := &Request{
+			Method: "POST",
+			URL:    "https://api.dropboxapi.com/2/files/list_folder/continue",
+			Header: http.Header{"Content-Type": {"application/json"}},
+			Body:   Body(`{"cursor": "a", "limit": 10}`),
+		}
+		req := &Request{
+			Method: "POST",
+			URL:    "http://localhost/2/files/list_folder/continue",
+			Header: http.Header{"Content-Type": {"application/json"}},
+			Body:   Body(`{"limit":10,"cursor":"b"}`),
+		}
+
+		Expect(MatchRoute(req, recorded)).To(BeTrue())
+		Expect(MatchRouteAndArg()(req, recorded)).To(BeFalse())
+		Expect(MatchRouteAndArg("cursor")(req, recorded)).To(BeTrue())
+	})
+})
@@ -0,0 +1,156 @@
+package dropboxcassette
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strconv"
+	"sync"
+)
+
+// ErrNoInteraction is returned by Replayer for a request that matches none
+// of the remaining interactions.
+var ErrNoInteraction = errors.New("dropboxcassette: no matching interaction")
+
+// Matcher reports whether a request matches a recorded request.
+type Matcher func(req *Request, recorded *Request) bool
+
+// MatchRoute matches requests with the same method and route.
+func MatchRoute(req *Request, recorded *Request) bool {
+	return req.Method == recorded.Method && req.Route() == recorded.Route()
+}
+
+// MatchRouteAndArg returns a matcher for requests with the same method,
+// route and JSON argument. The top-level argument fields in ignore are not
+// compared, e.g. "cursor" or "session_id" which differ between runs.
+func MatchRouteAndArg(ignore ...string) Matcher {
+	return func(req *Request, recorded *Request) bool {
+		if !MatchRoute(req, recorded) {
+			return false
+		}
+
+		arg, ok := decodeArg(req.Arg(), ignore)
+		if !ok {
+			return false
+		}
+		recordedArg, ok := decodeArg(recorded.Arg(), ignore)
+		if !ok {
+			return false
+		}
+
+		return reflect.DeepEqual(arg, recordedArg)
+	}
+}
+
+func decodeArg(data []byte, ignore []string) (interface{}, bool) {
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil, true
+	}
+
+	var arg interface{}
+	if err := json.Unmarshal(data, &arg); err != nil {
+		return nil, false
+	}
+
+	if fields, ok := arg.(map[string]interface{}); ok {
+		for _, name := range ignore {
+			delete(fields, name)
+		}
+	}
+
+	return arg, true
+}
+
+// Replayer is an http.RoundTripper that responds with recorded
+// interactions. Every interaction is replayed once, and a request gets the
+// first remaining interaction it matches.
+type Replayer struct {
+	cassette *Cassette
+	match    Matcher
+	used     []bool
+	mutex    sync.Mutex
+}
+
+// NewReplayer returns a replayer of cassette. It matches requests with
+// MatchRouteAndArg() if match is nil.
+func NewReplayer(cassette *Cassette, match Matcher) *Replayer {
+	if match == nil {
+		match = MatchRouteAndArg()
+	}
+
+	return &Replayer{
+		cassette: cassette,
+		match:    match,
+		used:     make([]bool, len(cassette.Interactions)),
+	}
+}
+
+func (r *Replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	request := &Request{
+		Method: req.Method,
+		URL:    req.URL.String(),
+		Header: req.Header,
+		Body:   body,
+	}
+
+	interaction, ok := r.next(request)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s %s %s", ErrNoInteraction, request.Method, request.Route(), request.Arg())
+	}
+
+	recorded := interaction.Response
+
+	return &http.Response{
+		Status:        strconv.Itoa(recorded.StatusCode) + " " + http.StatusText(recorded.StatusCode),
+		StatusCode:    recorded.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        recorded.Header.Clone(),
+		Body:          io.NopCloser(bytes.NewReader(recorded.Body)),
+		ContentLength: int64(len(recorded.Body)),
+		Request:       req,
+	}, nil
+}
+
+func (r *Replayer) next(request *Request) (*Interaction, bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for i, interaction := range r.cassette.Interactions {
+		if !r.used[i] && r.match(request, interaction.Request) {
+			r.used[i] = true
+			return interaction, true
+		}
+	}
+
+	return nil, false
+}
+
+// Remaining returns the number of interactions that were not replayed.
+func (r *Replayer) Remaining() int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	n := 0
+	for _, used := range r.used {
+		if !used {
+			n++
+		}
+	}
+	return n
+}
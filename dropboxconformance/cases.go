@@ -0,0 +1,780 @@
+package dropboxconformance
+
+import (
+	"encoding/hex"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/koofr/go-dropboxclient"
+	"github.com/koofr/go-ioutils"
+)
+
+// Cases are all cases of the suite, in the order they run.
+var Cases = []*Case{
+	{"users/get_space_usage: reports the allocation", getSpaceUsage},
+
+	{"files/get_metadata: by path", getMetadataByPath},
+	{"files/get_metadata: by id", getMetadataByID},
+	{"files/get_metadata: case insensitive path", getMetadataCaseInsensitive},
+	{"files/get_metadata: NFD folder name is normalized to NFC", getMetadataNFDFolder},
+	{"files/get_metadata: NFD file name is normalized to NFC", getMetadataNFDFile},
+	{"files/get_metadata: not found", getMetadataNotFound},
+	{"files/get_metadata: root is unsupported", getMetadataRoot},
+
+	{"files/list_folder: root", listFolderRoot},
+	{"files/list_folder: empty folder", listFolderEmpty},
+	{"files/list_folder: by id", listFolderByID},
+	{"files/list_folder: children", listFolderChildren},
+	{"files/list_folder: recursive", listFolderRecursive},
+	{"files/list_folder: not found", listFolderNotFound},
+	{"files/list_folder: file is not a folder", listFolderNotFolder},
+
+	{"files/list_folder/continue: new entries", listFolderContinueNew},
+	{"files/list_folder/continue: moved and deleted entries", listFolderContinueDeleted},
+	{"files/list_folder/continue: deleted folder", listFolderContinueDeletedFolder},
+	{"files/list_folder/continue: deleted entries of the listed folder", listFolderContinueDeletedScope},
+	{"files/list_folder: include_deleted", listFolderIncludeDeleted},
+	{"files/list_folder/continue: invalid cursor", listFolderContinueInvalidCursor},
+
+	{"files/create_folder: creates a folder", createFolder},
+	{"files/create_folder: conflict with a folder", createFolderConflictFolder},
+	{"files/create_folder: conflict with a file", createFolderConflictFile},
+
+	{"files/delete: by path", deleteByPath},
+	{"files/delete: by id", deleteByID},
+	{"files/delete: descendants", deleteDescendants},
+	{"files/delete: not found", deleteNotFound},
+
+	{"files/copy: folder by path", copyFolder},
+	{"files/copy: by id", copyByID},
+	{"files/copy: descendants", copyDescendants},
+	{"files/copy: file content", copyFileContent},
+	{"files/copy: conflict at destination", copyConflict},
+	{"files/copy: autorename", copyAutorename},
+	{"files/copy: folder into itself", copyIntoItself},
+	{"files/copy: source not found", copyNotFound},
+
+	{"files/move: folder by path", moveFolder},
+	{"files/move: by id", moveByID},
+	{"files/move: descendants", moveDescendants},
+	{"files/move: conflict at destination", moveConflict},
+	{"files/move: case-only rename", moveCaseOnly},
+	{"files/move: folder into itself", moveIntoItself},
+	{"files/move: same path", moveSamePath},
+	{"files/move: path_display", movePathDisplay},
+	{"files/move: source not found", moveNotFound},
+
+	{"files/download: by path", downloadByPath},
+	{"files/download: by id", downloadByID},
+	{"files/download: range", downloadRange},
+	{"files/download: not found", downloadNotFound},
+	{"files/download: folder", downloadFolder},
+
+	{"files/upload_session/append: chunks", uploadSessionAppend},
+	{"files/upload_session/append: incorrect offset", uploadSessionAppendIncorrectOffset},
+	{"files/upload_session/finish: file metadata", uploadSessionFinishMetadata},
+	{"files/upload_session/finish: client_modified", uploadSessionFinishClientModified},
+	{"files/upload_session/finish: same content in add mode", uploadSessionFinishSameContent},
+	{"files/upload_session/finish: conflict in add mode", uploadSessionFinishConflict},
+	{"files/upload_session/finish: autorename", uploadSessionFinishAutorename},
+	{"files/upload_session/finish: overwrite", uploadSessionFinishOverwrite},
+	{"files/upload_session/finish: update", uploadSessionFinishUpdate},
+	{"files/upload_session/finish: update with a stale rev", uploadSessionFinishUpdateStale},
+	{"files/upload_session/finish: missing parent folders", uploadSessionFinishMissingParents},
+}
+
+// entries returns "tag path_lower" of the entries, sorted.
+func entries(result *dropboxclient.ListFolderResult) []string {
+	pairs := []string{}
+	for _, md := range result.Entries {
+		pairs = append(pairs, md.Tag+" "+md.PathLower)
+	}
+	sort.Strings(pairs)
+	return pairs
+}
+
+func sorted(pairs ...string) []string {
+	sort.Strings(pairs)
+	return pairs
+}
+
+func getSpaceUsage(t *T) {
+	usage, err := t.Client.GetSpaceUsage(t.Ctx)
+	t.NoError(err, "get space usage")
+	t.True(usage.Allocation != nil && usage.Allocation.Allocated > 0, "allocation: expected allocated space, got %#v", usage.Allocation)
+	t.True(usage.Used >= 0, "used: expected >= 0, got %d", usage.Used)
+}
+
+func getMetadataByPath(t *T) {
+	folder := t.CreateFolder(t.Path("folder"))
+
+	md, err := t.Client.GetMetadata(t.Ctx, &dropboxclient.GetMetadataArg{Path: t.Path("folder")})
+	t.NoError(err, "get metadata")
+	t.Equal(md.Tag, dropboxclient.MetadataFolder, "tag")
+	t.Equal(md.Name, "folder", "name")
+	t.Equal(md.Id, folder.Id, "id")
+	t.Equal(md.PathLower, strings.ToLower(t.Path("folder")), "path_lower")
+}
+
+func getMetadataByID(t *T) {
+	folder := t.CreateFolder(t.Path("folder"))
+
+	md, err := t.Client.GetMetadata(t.Ctx, &dropboxclient.GetMetadataArg{Path: folder.Id})
+	t.NoError(err, "get metadata")
+	t.Equal(md.Name, "folder", "name")
+}
+
+func getMetadataCaseInsensitive(t *T) {
+	t.CreateFolder(t.Path("Folder"))
+
+	md, err := t.Client.GetMetadata(t.Ctx, &dropboxclient.GetMetadataArg{Path: t.Path("FOLDER")})
+	t.NoError(err, "get metadata")
+	t.Equal(md.Name, "Folder", "name")
+}
+
+func getMetadataNFDFolder(t *T) {
+	nameNFC := "ö"
+	nameNFD := "ö"
+
+	md := t.CreateFolder(t.Path(nameNFD))
+	t.Equal(md.Name, nameNFC, "created name")
+
+	md, err := t.Client.GetMetadata(t.Ctx, &dropboxclient.GetMetadataArg{Path: t.Path(nameNFC)})
+	t.NoError(err, "get metadata")
+	t.Equal(md.Name, nameNFC, "name")
+}
+
+func getMetadataNFDFile(t *T) {
+	nameNFC := "ö"
+	nameNFD := "ö"
+
+	md := t.Upload(t.Path(nameNFD), "12345")
+	t.Equal(md.Name, nameNFC, "uploaded name")
+
+	md, err := t.Client.GetMetadata(t.Ctx, &dropboxclient.GetMetadataArg{Path: t.Path(nameNFC)})
+	t.NoError(err, "get metadata")
+	t.Equal(md.Name, nameNFC, "name")
+}
+
+func getMetadataNotFound(t *T) {
+	_, err := t.Client.GetMetadata(t.Ctx, &dropboxclient.GetMetadataArg{Path: t.Path("missing")})
+	t.Error(err, "path/not_found", "get metadata")
+}
+
+func getMetadataRoot(t *T) {
+	_, err := t.Client.GetMetadata(t.Ctx, &dropboxclient.GetMetadataArg{Path: ""})
+	t.True(err != nil, "get metadata: expected an error")
+	t.True(strings.Contains(err.Error(), "The root folder is unsupported"), "get metadata: unexpected error: %s", err)
+}
+
+func listFolderRoot(t *T) {
+	result, err := t.Client.ListFolder(t.Ctx, &dropboxclient.ListFolderArg{Path: ""})
+	t.NoError(err, "list folder")
+
+	rootLower := strings.ToLower(t.Root)
+
+	for {
+		for _, md := range result.Entries {
+			if md.PathLower == rootLower {
+				t.Equal(md.Tag, dropboxclient.MetadataFolder, "tag")
+				return
+			}
+		}
+		if !result.HasMore {
+			break
+		}
+		result, err = t.Client.ListFolderContinue(t.Ctx, &dropboxclient.ListFolderContinueArg{Cursor: result.Cursor})
+		t.NoError(err, "list folder continue")
+	}
+
+	t.Fatalf("list folder: %s not listed", t.Root)
+}
+
+func listFolderEmpty(t *T) {
+	t.CreateFolder(t.Path("folder"))
+
+	result, err := t.Client.ListFolder(t.Ctx, &dropboxclient.ListFolderArg{Path: t.Path("folder")})
+	t.NoError(err, "list folder")
+	t.Equal(entries(result), []string{}, "entries")
+	t.Equal(result.HasMore, false, "has_more")
+	t.True(result.Cursor != "", "cursor: expected a cursor")
+}
+
+func listFolderByID(t *T) {
+	folder := t.CreateFolder(t.Path("folder"))
+	t.CreateFolder(t.Path("folder", "child"))
+
+	result, err := t.Client.ListFolder(t.Ctx, &dropboxclient.ListFolderArg{Path: folder.Id})
+	t.NoError(err, "list folder")
+	t.Equal(entries(result), []string{"folder " + strings.ToLower(t.Path("folder", "child"))}, "entries")
+}
+
+func listFolderChildren(t *T) {
+	t.CreateFolder(t.Path("folder"))
+	t.CreateFolder(t.Path("folder", "Child"))
+	t.CreateFolder(t.Path("folder", "Child", "grandchild"))
+	t.Upload(t.Path("folder", "file.txt"), "12345")
+
+	result, err := t.Client.ListFolder(t.Ctx, &dropboxclient.ListFolderArg{Path: t.Path("folder")})
+	t.NoError(err, "list folder")
+	t.Equal(entries(result), sorted(
+		"folder "+strings.ToLower(t.Path("folder", "child")),
+		"file "+strings.ToLower(t.Path("folder", "file.txt")),
+	), "entries")
+}
+
+func listFolderRecursive(t *T) {
+	t.CreateFolder(t.Path("folder"))
+	t.CreateFolder(t.Path("folder", "child"))
+	t.Upload(t.Path("folder", "child", "file.txt"), "12345")
+
+	result, err := t.Client.ListFolder(t.Ctx, &dropboxclient.ListFolderArg{Path: t.Path("folder"), Recursive: true})
+	t.NoError(err, "list folder")
+	t.Equal(entries(result), sorted(
+		"folder "+strings.ToLower(t.Path("folder")),
+		"folder "+strings.ToLower(t.Path("folder", "child")),
+		"file "+strings.ToLower(t.Path("folder", "child", "file.txt")),
+	), "entries")
+}
+
+func listFolderNotFound(t *T) {
+	_, err := t.Client.ListFolder(t.Ctx, &dropboxclient.ListFolderArg{Path: t.Path("missing")})
+	t.Error(err, "path/not_found", "list folder")
+}
+
+func listFolderNotFolder(t *T) {
+	t.Upload(t.Path("file.txt"), "12345")
+
+	_, err := t.Client.ListFolder(t.Ctx, &dropboxclient.ListFolderArg{Path: t.Path("file.txt")})
+	t.Error(err, "path/not_folder", "list folder")
+}
+
+func listFolderContinueNew(t *T) {
+	t.CreateFolder(t.Path("folder"))
+	t.CreateFolder(t.Path("folder", "a"))
+
+	result, err := t.Client.ListFolder(t.Ctx, &dropboxclient.ListFolderArg{Path: t.Path("folder")})
+	t.NoError(err, "list folder")
+
+	result, err = t.Client.ListFolderContinue(t.Ctx, &dropboxclient.ListFolderContinueArg{Cursor: result.Cursor})
+	t.NoError(err, "list folder continue")
+	t.Equal(entries(result), []string{}, "entries without changes")
+
+	t.CreateFolder(t.Path("folder", "b"))
+
+	result, err = t.Client.ListFolderContinue(t.Ctx, &dropboxclient.ListFolderContinueArg{Cursor: result.Cursor})
+	t.NoError(err, "list folder continue")
+	t.Equal(entries(result), []string{"folder " + strings.ToLower(t.Path("folder", "b"))}, "entries")
+	t.Equal(result.HasMore, false, "has_more")
+}
+
+func listFolderContinueDeleted(t *T) {
+	dir1 := t.CreateFolder(t.Path("dir1"))
+	dir2 := t.CreateFolder(t.Path("dir1", "dir2"))
+
+	result, err := t.Client.ListFolder(t.Ctx, &dropboxclient.ListFolderArg{Path: t.Path("dir1"), Recursive: true})
+	t.NoError(err, "list folder")
+	t.Equal(entries(result), sorted(
+		"folder "+dir1.PathLower,
+		"folder "+dir2.PathLower,
+	), "entries")
+
+	dir3 := t.CreateFolder(t.Path("dir1", "dir2", "dir3"))
+
+	result, err = t.Client.ListFolderContinue(t.Ctx, &dropboxclient.ListFolderContinueArg{Cursor: result.Cursor})
+	t.NoError(err, "list folder continue")
+	t.Equal(entries(result), []string{"folder " + dir3.PathLower}, "entries after create")
+
+	oldDir3 := dir3
+	dir3, err = t.Client.Move(t.Ctx, &dropboxclient.RelocationArg{FromPath: dir3.PathLower, ToPath: path.Join(path.Dir(dir3.PathLower), "dir3-moved")})
+	t.NoError(err, "move")
+
+	result, err = t.Client.ListFolderContinue(t.Ctx, &dropboxclient.ListFolderContinueArg{Cursor: result.Cursor})
+	t.NoError(err, "list folder continue")
+	t.Equal(entries(result), sorted(
+		"deleted "+oldDir3.PathLower,
+		"folder "+dir3.PathLower,
+	), "entries after move")
+
+	_, err = t.Client.Delete(t.Ctx, &dropboxclient.DeleteArg{Path: dir3.PathLower})
+	t.NoError(err, "delete")
+
+	result, err = t.Client.ListFolderContinue(t.Ctx, &dropboxclient.ListFolderContinueArg{Cursor: result.Cursor})
+	t.NoError(err, "list folder continue")
+	t.Equal(entries(result), []string{"deleted " + dir3.PathLower}, "entries after delete")
+
+	_, err = t.Client.Delete(t.Ctx, &dropboxclient.DeleteArg{Path: dir2.PathLower})
+	t.NoError(err, "delete")
+
+	result, err = t.Client.ListFolderContinue(t.Ctx, &dropboxclient.ListFolderContinueArg{Cursor: result.Cursor})
+	t.NoError(err, "list folder continue")
+	t.Equal(entries(result), []string{"deleted " + dir2.PathLower}, "entries after delete")
+	t.Equal(result.HasMore, false, "has_more")
+}
+
+func listFolderContinueDeletedScope(t *T) {
+	t.CreateFolder(t.Path("a"))
+	t.CreateFolder(t.Path("a", "b"))
+	t.CreateFolder(t.Path("a", "b", "c"))
+	t.CreateFolder(t.Path("other"))
+	t.CreateFolder(t.Path("other", "d"))
+
+	children, err := t.Client.ListFolder(t.Ctx, &dropboxclient.ListFolderArg{Path: t.Path("a")})
+	t.NoError(err, "list folder")
+	recursive, err := t.Client.ListFolder(t.Ctx, &dropboxclient.ListFolderArg{Path: t.Path("a"), Recursive: true})
+	t.NoError(err, "list folder recursive")
+
+	_, err = t.Client.Delete(t.Ctx, &dropboxclient.DeleteArg{Path: t.Path("a", "b", "c")})
+	t.NoError(err, "delete nested folder")
+	_, err = t.Client.Delete(t.Ctx, &dropboxclient.DeleteArg{Path: t.Path("other", "d")})
+	t.NoError(err, "delete other folder")
+
+	result, err := t.Client.ListFolderContinue(t.Ctx, &dropboxclient.ListFolderContinueArg{Cursor: children.Cursor})
+	t.NoError(err, "list folder continue")
+	t.Equal(entries(result), []string{}, "entries of children cursor")
+
+	result, err = t.Client.ListFolderContinue(t.Ctx, &dropboxclient.ListFolderContinueArg{Cursor: recursive.Cursor})
+	t.NoError(err, "list folder continue recursive")
+	t.Equal(entries(result), []string{"deleted " + strings.ToLower(t.Path("a", "b", "c"))}, "entries of recursive cursor")
+}
+
+func listFolderIncludeDeleted(t *T) {
+	t.CreateFolder(t.Path("folder"))
+	t.Upload(t.Path("folder", "gone.txt"), "gone")
+	t.Upload(t.Path("folder", "back.txt"), "back")
+
+	_, err := t.Client.Delete(t.Ctx, &dropboxclient.DeleteArg{Path: t.Path("folder", "gone.txt")})
+	t.NoError(err, "delete")
+	_, err = t.Client.Delete(t.Ctx, &dropboxclient.DeleteArg{Path: t.Path("folder", "back.txt")})
+	t.NoError(err, "delete")
+	t.Upload(t.Path("folder", "back.txt"), "back again")
+
+	result, err := t.Client.ListFolder(t.Ctx, &dropboxclient.ListFolderArg{Path: t.Path("folder")})
+	t.NoError(err, "list folder")
+	t.Equal(entries(result), []string{"file " + strings.ToLower(t.Path("folder", "back.txt"))}, "entries")
+
+	result, err = t.Client.ListFolder(t.Ctx, &dropboxclient.ListFolderArg{Path: t.Path("folder"), IncludeDeleted: true})
+	t.NoError(err, "list folder include deleted")
+	t.Equal(entries(result), sorted(
+		"deleted "+strings.ToLower(t.Path("folder", "gone.txt")),
+		"file "+strings.ToLower(t.Path("folder", "back.txt")),
+	), "entries with deleted")
+}
+
+func listFolderContinueDeletedFolder(t *T) {
+	folder := t.CreateFolder(t.Path("folder"))
+
+	byPath, err := t.Client.ListFolder(t.Ctx, &dropboxclient.ListFolderArg{Path: t.Path("folder")})
+	t.NoError(err, "list folder by path")
+
+	byID, err := t.Client.ListFolder(t.Ctx, &dropboxclient.ListFolderArg{Path: folder.Id})
+	t.NoError(err, "list folder by id")
+
+	_, err = t.Client.Delete(t.Ctx, &dropboxclient.DeleteArg{Path: folder.Id})
+	t.NoError(err, "delete")
+
+	_, err = t.Client.ListFolderContinue(t.Ctx, &dropboxclient.ListFolderContinueArg{Cursor: byPath.Cursor})
+	t.Error(err, "path/not_found", "list folder continue by path")
+
+	_, err = t.Client.ListFolderContinue(t.Ctx, &dropboxclient.ListFolderContinueArg{Cursor: byID.Cursor})
+	t.Error(err, "path/not_found", "list folder continue by id")
+}
+
+func listFolderContinueInvalidCursor(t *T) {
+	_, err := t.Client.ListFolderContinue(t.Ctx, &dropboxclient.ListFolderContinueArg{Cursor: "invalid"})
+	_, ok := dropboxclient.IsDropboxError(err)
+	t.True(ok, "list folder continue: expected a Dropbox error, got %v", err)
+	t.True(strings.Contains(err.Error(), `Invalid "cursor"`), "list folder continue: unexpected error: %s", err)
+}
+
+func createFolder(t *T) {
+	md, err := t.Client.CreateFolder(t.Ctx, &dropboxclient.CreateFolderArg{Path: t.Path("Folder")})
+	t.NoError(err, "create folder")
+	t.Equal(md.Name, "Folder", "name")
+	t.Equal(md.Tag, "", "tag")
+	t.Equal(md.PathLower, strings.ToLower(t.Path("Folder")), "path_lower")
+	t.True(md.Id != "", "id: expected an id")
+}
+
+func createFolderConflictFolder(t *T) {
+	t.CreateFolder(t.Path("folder"))
+
+	_, err := t.Client.CreateFolder(t.Ctx, &dropboxclient.CreateFolderArg{Path: t.Path("FOLDER")})
+	t.Error(err, "path/conflict", "create folder")
+}
+
+func createFolderConflictFile(t *T) {
+	t.Upload(t.Path("file.txt"), "12345")
+
+	_, err := t.Client.CreateFolder(t.Ctx, &dropboxclient.CreateFolderArg{Path: t.Path("file.txt")})
+	t.Error(err, "path/conflict", "create folder")
+}
+
+func deleteByPath(t *T) {
+	t.CreateFolder(t.Path("folder"))
+
+	md, err := t.Client.Delete(t.Ctx, &dropboxclient.DeleteArg{Path: t.Path("folder")})
+	t.NoError(err, "delete")
+	t.Equal(md.Name, "folder", "name")
+	t.Equal(md.Tag, dropboxclient.MetadataFolder, "tag")
+	t.Equal(t.Exists(t.Path("folder")), false, "exists after delete")
+}
+
+func deleteByID(t *T) {
+	folder := t.CreateFolder(t.Path("folder"))
+
+	md, err := t.Client.Delete(t.Ctx, &dropboxclient.DeleteArg{Path: folder.Id})
+	t.NoError(err, "delete")
+	t.Equal(md.Name, "folder", "name")
+
+	_, err = t.Client.GetMetadata(t.Ctx, &dropboxclient.GetMetadataArg{Path: folder.Id})
+	t.Error(err, "path/not_found", "get metadata by id after delete")
+}
+
+func deleteDescendants(t *T) {
+	t.CreateFolder(t.Path("folder"))
+	file := t.Upload(t.Path("folder", "file.txt"), "12345")
+
+	_, err := t.Client.Delete(t.Ctx, &dropboxclient.DeleteArg{Path: t.Path("folder")})
+	t.NoError(err, "delete")
+
+	_, err = t.Client.GetMetadata(t.Ctx, &dropboxclient.GetMetadataArg{Path: file.Id})
+	t.Error(err, "path/not_found", "get metadata of a descendant")
+}
+
+func deleteNotFound(t *T) {
+	_, err := t.Client.Delete(t.Ctx, &dropboxclient.DeleteArg{Path: t.Path("missing")})
+	t.Error(err, "path_lookup/not_found", "delete")
+}
+
+func copyFolder(t *T) {
+	folder := t.CreateFolder(t.Path("folder"))
+
+	md, err := t.Client.Copy(t.Ctx, &dropboxclient.RelocationArg{FromPath: t.Path("folder"), ToPath: t.Path("copy")})
+	t.NoError(err, "copy")
+	t.Equal(md.Name, "copy", "name")
+	t.Equal(md.Tag, dropboxclient.MetadataFolder, "tag")
+	t.True(md.Id != folder.Id, "id: expected a new id")
+	t.Equal(t.Exists(t.Path("folder")), true, "source exists")
+	t.Equal(t.Exists(t.Path("copy")), true, "copy exists")
+}
+
+func copyByID(t *T) {
+	folder := t.CreateFolder(t.Path("folder"))
+
+	md, err := t.Client.Copy(t.Ctx, &dropboxclient.RelocationArg{FromPath: folder.Id, ToPath: t.Path("copy")})
+	t.NoError(err, "copy")
+
+	md, err = t.Client.GetMetadata(t.Ctx, &dropboxclient.GetMetadataArg{Path: md.Id})
+	t.NoError(err, "get metadata of the copy")
+	t.Equal(md.Name, "copy", "name")
+}
+
+func copyDescendants(t *T) {
+	t.CreateFolder(t.Path("folder"))
+	t.CreateFolder(t.Path("folder", "child"))
+	t.Upload(t.Path("folder", "child", "file.txt"), "12345")
+
+	_, err := t.Client.Copy(t.Ctx, &dropboxclient.RelocationArg{FromPath: t.Path("folder"), ToPath: t.Path("copy")})
+	t.NoError(err, "copy")
+
+	t.Equal(t.Exists(t.Path("copy", "child")), true, "copied child exists")
+	t.Equal(t.Exists(t.Path("copy", "child", "file.txt")), true, "copied file exists")
+	t.Equal(t.Exists(t.Path("folder", "child", "file.txt")), true, "source file exists")
+}
+
+func copyFileContent(t *T) {
+	file := t.Upload(t.Path("file.txt"), "12345")
+
+	md, err := t.Client.Copy(t.Ctx, &dropboxclient.RelocationArg{FromPath: t.Path("file.txt"), ToPath: t.Path("copy.txt")})
+	t.NoError(err, "copy")
+	t.Equal(md.Size, file.Size, "size")
+	t.Equal(md.ContentHash, file.ContentHash, "content_hash")
+	t.Equal(t.Download(t.Path("copy.txt")), "12345", "content")
+}
+
+func copyConflict(t *T) {
+	t.CreateFolder(t.Path("a"))
+	t.CreateFolder(t.Path("b"))
+
+	_, err := t.Client.Copy(t.Ctx, &dropboxclient.RelocationArg{FromPath: t.Path("a"), ToPath: t.Path("b")})
+	t.Error(err, "to/conflict", "copy")
+}
+
+func copyAutorename(t *T) {
+	t.Upload(t.Path("file.txt"), "12345")
+	t.Upload(t.Path("copy.txt"), "other")
+
+	md, err := t.Client.Copy(t.Ctx, &dropboxclient.RelocationArg{FromPath: t.Path("file.txt"), ToPath: t.Path("copy.txt"), Autorename: true})
+	t.NoError(err, "copy")
+	t.Equal(md.Name, "copy (1).txt", "name")
+	t.Equal(t.Download(t.Path("copy (1).txt")), "12345", "content")
+	t.Equal(t.Download(t.Path("copy.txt")), "other", "existing content")
+}
+
+func copyIntoItself(t *T) {
+	t.CreateFolder(t.Path("folder"))
+
+	_, err := t.Client.Copy(t.Ctx, &dropboxclient.RelocationArg{FromPath: t.Path("folder"), ToPath: t.Path("folder", "copy")})
+	t.Error(err, "cant_move_folder_into_itself", "copy")
+}
+
+func copyNotFound(t *T) {
+	_, err := t.Client.Copy(t.Ctx, &dropboxclient.RelocationArg{FromPath: t.Path("missing"), ToPath: t.Path("copy")})
+	t.Error(err, "from_lookup/not_found", "copy")
+}
+
+func moveFolder(t *T) {
+	folder := t.CreateFolder(t.Path("folder"))
+
+	md, err := t.Client.Move(t.Ctx, &dropboxclient.RelocationArg{FromPath: t.Path("folder"), ToPath: t.Path("moved")})
+	t.NoError(err, "move")
+	t.Equal(md.Name, "moved", "name")
+	t.Equal(md.Id, folder.Id, "id")
+	t.Equal(t.Exists(t.Path("folder")), false, "source exists")
+	t.Equal(t.Exists(t.Path("moved")), true, "destination exists")
+}
+
+func moveByID(t *T) {
+	folder := t.CreateFolder(t.Path("folder"))
+
+	_, err := t.Client.Move(t.Ctx, &dropboxclient.RelocationArg{FromPath: folder.Id, ToPath: t.Path("moved")})
+	t.NoError(err, "move")
+
+	md, err := t.Client.GetMetadata(t.Ctx, &dropboxclient.GetMetadataArg{Path: folder.Id})
+	t.NoError(err, "get metadata")
+	t.Equal(md.Name, "moved", "name")
+}
+
+func moveDescendants(t *T) {
+	t.CreateFolder(t.Path("folder"))
+	t.CreateFolder(t.Path("folder", "child"))
+	file := t.Upload(t.Path("folder", "child", "file.txt"), "12345")
+
+	_, err := t.Client.Move(t.Ctx, &dropboxclient.RelocationArg{FromPath: t.Path("folder"), ToPath: t.Path("moved")})
+	t.NoError(err, "move")
+
+	md, err := t.Client.GetMetadata(t.Ctx, &dropboxclient.GetMetadataArg{Path: file.Id})
+	t.NoError(err, "get metadata of a descendant")
+	t.Equal(md.PathLower, strings.ToLower(t.Path("moved", "child", "file.txt")), "path_lower")
+	t.Equal(t.Download(t.Path("moved", "child", "file.txt")), "12345", "content")
+}
+
+func moveConflict(t *T) {
+	t.CreateFolder(t.Path("a"))
+	t.CreateFolder(t.Path("b"))
+
+	_, err := t.Client.Move(t.Ctx, &dropboxclient.RelocationArg{FromPath: t.Path("a"), ToPath: t.Path("b")})
+	t.Error(err, "to/conflict", "move")
+}
+
+func moveCaseOnly(t *T) {
+	folder := t.CreateFolder(t.Path("Folder"))
+
+	md, err := t.Client.Move(t.Ctx, &dropboxclient.RelocationArg{FromPath: t.Path("Folder"), ToPath: t.Path("folder")})
+	t.NoError(err, "move")
+	t.Equal(md.Id, folder.Id, "id")
+	t.Equal(md.Name, "folder", "name")
+
+	md, err = t.Client.GetMetadata(t.Ctx, &dropboxclient.GetMetadataArg{Path: folder.Id})
+	t.NoError(err, "get metadata")
+	t.Equal(md.Name, "folder", "name after the move")
+}
+
+func moveIntoItself(t *T) {
+	t.CreateFolder(t.Path("folder"))
+	t.CreateFolder(t.Path("folder", "child"))
+
+	_, err := t.Client.Move(t.Ctx, &dropboxclient.RelocationArg{FromPath: t.Path("folder"), ToPath: t.Path("folder", "child", "moved")})
+	t.Error(err, "cant_move_folder_into_itself", "move")
+	t.Equal(t.Exists(t.Path("folder", "child")), true, "child exists")
+}
+
+func moveSamePath(t *T) {
+	t.CreateFolder(t.Path("folder"))
+
+	_, err := t.Client.Move(t.Ctx, &dropboxclient.RelocationArg{FromPath: t.Path("folder"), ToPath: t.Path("folder")})
+	t.Error(err, "duplicated_or_nested_paths", "move")
+}
+
+func movePathDisplay(t *T) {
+	t.CreateFolder(t.Path("Folder"))
+	file := t.Upload(t.Path("Folder", "File.txt"), "12345")
+	t.CreateFolder(t.Path("Target"))
+
+	_, err := t.Client.Move(t.Ctx, &dropboxclient.RelocationArg{FromPath: t.Path("Folder"), ToPath: t.Path("target", "Moved")})
+	t.NoError(err, "move")
+
+	md, err := t.Client.GetMetadata(t.Ctx, &dropboxclient.GetMetadataArg{Path: file.Id})
+	t.NoError(err, "get metadata")
+	t.Equal(md.PathDisplay, t.Path("Target", "Moved", "File.txt"), "path_display")
+}
+
+func moveNotFound(t *T) {
+	_, err := t.Client.Move(t.Ctx, &dropboxclient.RelocationArg{FromPath: t.Path("missing"), ToPath: t.Path("moved")})
+	t.Error(err, "from_lookup/not_found", "move")
+}
+
+func download(t *T, arg *dropboxclient.DownloadArg, span *ioutils.FileSpan, want string) {
+	reader, md, err := t.Client.Download(t.Ctx, arg, span)
+	t.NoError(err, "download")
+	defer reader.Close()
+
+	t.Equal(md.Name, "file.txt", "name")
+	t.True(md.ETag != "", "etag: expected an etag")
+	t.Equal(md.ContentLength, int64(len(want)), "content length")
+
+	data, err := io.ReadAll(reader)
+	t.NoError(err, "read")
+	t.Equal(string(data), want, "content")
+}
+
+func downloadByPath(t *T) {
+	t.Upload(t.Path("file.txt"), "12345")
+
+	download(t, &dropboxclient.DownloadArg{Path: t.Path("file.txt")}, nil, "12345")
+}
+
+func downloadByID(t *T) {
+	file := t.Upload(t.Path("file.txt"), "12345")
+
+	download(t, &dropboxclient.DownloadArg{Path: file.Id}, nil, "12345")
+}
+
+func downloadRange(t *T) {
+	t.Upload(t.Path("file.txt"), "12345")
+
+	download(t, &dropboxclient.DownloadArg{Path: t.Path("file.txt")}, &ioutils.FileSpan{Start: 2, End: 3}, "34")
+}
+
+func downloadNotFound(t *T) {
+	_, _, err := t.Client.Download(t.Ctx, &dropboxclient.DownloadArg{Path: t.Path("missing")}, nil)
+	t.Error(err, "path/not_found", "download")
+}
+
+func downloadFolder(t *T) {
+	t.CreateFolder(t.Path("folder"))
+
+	_, _, err := t.Client.Download(t.Ctx, &dropboxclient.DownloadArg{Path: t.Path("folder")}, nil)
+	t.Error(err, "path/not_file", "download")
+}
+
+func uploadSessionAppend(t *T) {
+	session, err := t.Client.UploadSessionStart(t.Ctx, strings.NewReader("123"))
+	t.NoError(err, "start")
+
+	err = t.Client.UploadSessionAppend(t.Ctx, &dropboxclient.UploadSessionCursor{SessionId: session.SessionId, Offset: 3}, strings.NewReader("45"))
+	t.NoError(err, "append")
+
+	md, err := t.Client.UploadSessionFinish(t.Ctx, &dropboxclient.UploadSessionFinishArg{
+		Cursor: &dropboxclient.UploadSessionCursor{SessionId: session.SessionId, Offset: 5},
+		Commit: &dropboxclient.CommitInfo{Path: t.Path("file.txt"), Mode: &dropboxclient.WriteMode{Tag: dropboxclient.WriteModeAdd}},
+	})
+	t.NoError(err, "finish")
+	t.Equal(md.Size, int64(5), "size")
+	t.Equal(t.Download(t.Path("file.txt")), "12345", "content")
+}
+
+func uploadSessionAppendIncorrectOffset(t *T) {
+	session, err := t.Client.UploadSessionStart(t.Ctx, strings.NewReader("123"))
+	t.NoError(err, "start")
+
+	err = t.Client.UploadSessionAppend(t.Ctx, &dropboxclient.UploadSessionCursor{SessionId: session.SessionId, Offset: 1}, strings.NewReader("45"))
+	t.Error(err, "incorrect_offset", "append")
+}
+
+func uploadSessionFinishMetadata(t *T) {
+	md := t.Upload(t.Path("File.txt"), "12345")
+
+	hash := dropboxclient.NewContentHash()
+	hash.Write([]byte("12345"))
+
+	t.Equal(md.Tag, "", "tag")
+	t.Equal(md.Name, "File.txt", "name")
+	t.Equal(md.PathLower, strings.ToLower(t.Path("File.txt")), "path_lower")
+	t.Equal(md.Size, int64(5), "size")
+	t.Equal(md.ContentHash, hex.EncodeToString(hash.Sum(nil)), "content_hash")
+	t.True(md.Id != "", "id: expected an id")
+	t.True(md.Rev != "", "rev: expected a rev")
+	t.True(!md.ServerModified.IsZero(), "server_modified: expected a time")
+}
+
+func uploadSessionFinishClientModified(t *T) {
+	clientModified := "2020-01-02T03:04:05Z"
+
+	session, err := t.Client.UploadSessionStart(t.Ctx, strings.NewReader("12345"))
+	t.NoError(err, "start")
+
+	md, err := t.Client.UploadSessionFinish(t.Ctx, &dropboxclient.UploadSessionFinishArg{
+		Cursor: &dropboxclient.UploadSessionCursor{SessionId: session.SessionId, Offset: 5},
+		Commit: &dropboxclient.CommitInfo{
+			Path:           t.Path("file.txt"),
+			Mode:           &dropboxclient.WriteMode{Tag: dropboxclient.WriteModeAdd},
+			ClientModified: &clientModified,
+		},
+	})
+	t.NoError(err, "finish")
+	t.True(md.ClientModified.Equal(time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)), "client_modified: got %s", md.ClientModified)
+}
+
+func uploadSessionFinishSameContent(t *T) {
+	file := t.Upload(t.Path("file.txt"), "12345")
+
+	md := t.Upload(t.Path("file.txt"), "12345")
+	t.Equal(md.Id, file.Id, "id")
+	t.Equal(md.Name, "file.txt", "name")
+}
+
+func uploadSessionFinishConflict(t *T) {
+	t.Upload(t.Path("file.txt"), "12345")
+
+	_, err := t.TryUpload(t.Path("file.txt"), "67890", &dropboxclient.WriteMode{Tag: dropboxclient.WriteModeAdd}, false)
+	t.Error(err, "path/conflict", "upload")
+}
+
+func uploadSessionFinishAutorename(t *T) {
+	t.Upload(t.Path("file.txt"), "12345")
+
+	md, err := t.TryUpload(t.Path("file.txt"), "67890", &dropboxclient.WriteMode{Tag: dropboxclient.WriteModeAdd}, true)
+	t.NoError(err, "upload")
+	t.Equal(md.Name, "file (1).txt", "name")
+	t.Equal(t.Download(t.Path("file.txt")), "12345", "original content")
+}
+
+func uploadSessionFinishOverwrite(t *T) {
+	file := t.Upload(t.Path("file.txt"), "12345")
+
+	md, err := t.TryUpload(t.Path("file.txt"), "67890", &dropboxclient.WriteMode{Tag: dropboxclient.WriteModeOverwrite}, false)
+	t.NoError(err, "upload")
+	t.Equal(md.Id, file.Id, "id")
+	t.True(md.Rev != file.Rev, "rev: expected a new rev")
+	t.Equal(t.Download(t.Path("file.txt")), "67890", "content")
+}
+
+func uploadSessionFinishUpdate(t *T) {
+	file := t.Upload(t.Path("file.txt"), "12345")
+
+	md, err := t.TryUpload(t.Path("file.txt"), "67890", &dropboxclient.WriteMode{Tag: dropboxclient.WriteModeUpdate, Update: file.Rev}, false)
+	t.NoError(err, "upload")
+	t.True(md.Rev != file.Rev, "rev: expected a new rev")
+	t.Equal(t.Download(t.Path("file.txt")), "67890", "content")
+}
+
+func uploadSessionFinishUpdateStale(t *T) {
+	file := t.Upload(t.Path("file.txt"), "12345")
+
+	_, err := t.TryUpload(t.Path("file.txt"), "67890", &dropboxclient.WriteMode{Tag: dropboxclient.WriteModeOverwrite}, false)
+	t.NoError(err, "overwrite")
+
+	_, err = t.TryUpload(t.Path("file.txt"), "abcde", &dropboxclient.WriteMode{Tag: dropboxclient.WriteModeUpdate, Update: file.Rev}, false)
+	t.Error(err, "path/conflict", "update")
+}
+
+func uploadSessionFinishMissingParents(t *T) {
+	md := t.Upload(t.Path("a", "b", "file.txt"), "12345")
+	t.Equal(md.PathLower, strings.ToLower(t.Path("a", "b", "file.txt")), "path_lower")
+	t.Equal(t.Exists(t.Path("a", "b")), true, "parent exists")
+}
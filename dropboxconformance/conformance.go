@@ -0,0 +1,267 @@
+// Package dropboxconformance checks that a dropboxclient.Client behaves like
+// the Dropbox API. The same cases run against the real API, mockdropbox and
+// custom fakes, and the reports of two clients can be compared to find the
+// behaviours that diverge.
+package dropboxconformance
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"strings"
+
+	"github.com/koofr/go-dropboxclient"
+)
+
+// NewClientFunc returns the client a case runs against. It is called once
+// per case, so a fake can start from an empty account every time.
+type NewClientFunc func() (dropboxclient.Client, error)
+
+// Case is a single checked behaviour. Name starts with the route, e.g.
+// "files/copy: conflict at destination".
+type Case struct {
+	Name string
+	Run  func(t *T)
+}
+
+// T is passed to a case. Each case works in its own Root folder, which is
+// created before and deleted after the case runs.
+type T struct {
+	Ctx    context.Context
+	Client dropboxclient.Client
+	Root   string
+}
+
+type failure struct {
+	err error
+}
+
+// Fatalf fails the case and stops running it.
+func (t *T) Fatalf(format string, args ...interface{}) {
+	panic(&failure{fmt.Errorf(format, args...)})
+}
+
+// Path joins elems to the case root.
+func (t *T) Path(elems ...string) string {
+	return t.Root + "/" + strings.Join(elems, "/")
+}
+
+// RandomName returns a name that is unique within the account.
+func (t *T) RandomName() string {
+	return fmt.Sprintf("%d", rand.Int63())
+}
+
+func (t *T) NoError(err error, op string) {
+	if err != nil {
+		t.Fatalf("%s: unexpected error: %s", op, err)
+	}
+}
+
+// Error fails the case unless err is a Dropbox error with the tag path
+// want, e.g. "path/not_found".
+func (t *T) Error(err error, want string, op string) {
+	if err == nil {
+		t.Fatalf("%s: expected error %s, got none", op, want)
+	}
+	if got := dropboxclient.ErrorTag(err); got != want {
+		t.Fatalf("%s: expected error %s, got %q: %s", op, want, got, err)
+	}
+}
+
+func (t *T) Equal(got interface{}, want interface{}, what string) {
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("%s: expected %#v, got %#v", what, want, got)
+	}
+}
+
+func (t *T) True(cond bool, format string, args ...interface{}) {
+	if !cond {
+		t.Fatalf(format, args...)
+	}
+}
+
+func (t *T) CreateFolder(path string) *dropboxclient.Metadata {
+	md, err := t.Client.CreateFolder(t.Ctx, &dropboxclient.CreateFolderArg{Path: path})
+	t.NoError(err, "create folder "+path)
+	return md
+}
+
+// Upload uploads data to path in a single session, failing the case on
+// error.
+func (t *T) Upload(path string, data string) *dropboxclient.Metadata {
+	md, err := t.TryUpload(path, data, &dropboxclient.WriteMode{Tag: dropboxclient.WriteModeAdd}, false)
+	t.NoError(err, "upload "+path)
+	return md
+}
+
+func (t *T) TryUpload(path string, data string, mode *dropboxclient.WriteMode, autorename bool) (*dropboxclient.Metadata, error) {
+	session, err := t.Client.UploadSessionStart(t.Ctx, strings.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	return t.Client.UploadSessionFinish(t.Ctx, &dropboxclient.UploadSessionFinishArg{
+		Cursor: &dropboxclient.UploadSessionCursor{
+			SessionId: session.SessionId,
+			Offset:    int64(len(data)),
+		},
+		Commit: &dropboxclient.CommitInfo{
+			Path:       path,
+			Mode:       mode,
+			Autorename: autorename,
+		},
+	})
+}
+
+// Download returns the content of the file at path.
+func (t *T) Download(path string) string {
+	reader, _, err := t.Client.Download(t.Ctx, &dropboxclient.DownloadArg{Path: path}, nil)
+	t.NoError(err, "download "+path)
+	defer reader.Close()
+
+	buf := &bytes.Buffer{}
+	_, err = buf.ReadFrom(reader)
+	t.NoError(err, "read "+path)
+
+	return buf.String()
+}
+
+// Exists reports whether there is an item at path.
+func (t *T) Exists(path string) bool {
+	_, err := t.Client.GetMetadata(t.Ctx, &dropboxclient.GetMetadataArg{Path: path})
+	if dropboxclient.ErrorTag(err) == "path/not_found" {
+		return false
+	}
+	t.NoError(err, "get metadata "+path)
+	return true
+}
+
+// RunCase runs c against a new client and returns its failure, if any.
+func RunCase(ctx context.Context, newClient NewClientFunc, c *Case) (err error) {
+	client, err := newClient()
+	if err != nil {
+		return fmt.Errorf("new client: %w", err)
+	}
+
+	t := &T{
+		Ctx:    ctx,
+		Client: client,
+		Root:   fmt.Sprintf("/conformance-%d", rand.Int63()),
+	}
+
+	if _, err := client.CreateFolder(ctx, &dropboxclient.CreateFolderArg{Path: t.Root}); err != nil {
+		return fmt.Errorf("create root: %w", err)
+	}
+
+	defer client.Delete(ctx, &dropboxclient.DeleteArg{Path: t.Root})
+
+	defer func() {
+		if r := recover(); r != nil {
+			f, ok := r.(*failure)
+			if !ok {
+				panic(r)
+			}
+			err = f.err
+		}
+	}()
+
+	c.Run(t)
+
+	return nil
+}
+
+// Result is the outcome of a case. Err is nil if the case passed.
+type Result struct {
+	Case string
+	Err  error
+}
+
+type Report struct {
+	Results []*Result
+}
+
+// Run runs all Cases and reports their results.
+func Run(ctx context.Context, newClient NewClientFunc) *Report {
+	return RunCases(ctx, newClient, Cases)
+}
+
+func RunCases(ctx context.Context, newClient NewClientFunc, cases []*Case) *Report {
+	report := &Report{}
+
+	for _, c := range cases {
+		report.Results = append(report.Results, &Result{
+			Case: c.Name,
+			Err:  RunCase(ctx, newClient, c),
+		})
+	}
+
+	return report
+}
+
+// Failures returns the results of the failed cases.
+func (r *Report) Failures() []*Result {
+	failures := []*Result{}
+	for _, result := range r.Results {
+		if result.Err != nil {
+			failures = append(failures, result)
+		}
+	}
+	return failures
+}
+
+func (r *Report) String() string {
+	b := &strings.Builder{}
+	for _, result := range r.Results {
+		if result.Err != nil {
+			fmt.Fprintf(b, "FAIL %s: %s\n", result.Case, result.Err)
+		} else {
+			fmt.Fprintf(b, "ok   %s\n", result.Case)
+		}
+	}
+	return b.String()
+}
+
+// Divergence is a case that passed for one client and failed for the other.
+// Expected is the error of the reference client, Got the error of the
+// client under test.
+type Divergence struct {
+	Case     string
+	Expected error
+	Got      error
+}
+
+func (d *Divergence) String() string {
+	if d.Got != nil {
+		return fmt.Sprintf("%s: %s", d.Case, d.Got)
+	}
+	return fmt.Sprintf("%s: passes, but fails for the reference: %s", d.Case, d.Expected)
+}
+
+// Diverge compares the report of a client with the report of a reference
+// client, e.g. the real API, and returns the cases whose outcome differs.
+// Cases missing from either report are ignored.
+func Diverge(reference *Report, report *Report) []*Divergence {
+	expected := map[string]error{}
+	for _, result := range reference.Results {
+		expected[result.Case] = result.Err
+	}
+
+	divergences := []*Divergence{}
+	for _, result := range report.Results {
+		expectedErr, ok := expected[result.Case]
+		if !ok {
+			continue
+		}
+		if (expectedErr == nil) != (result.Err == nil) {
+			divergences = append(divergences, &Divergence{
+				Case:     result.Case,
+				Expected: expectedErr,
+				Got:      result.Err,
+			})
+		}
+	}
+
+	return divergences
+}
@@ -0,0 +1,77 @@
+package dropboxconformance_test
+
+import (
+	"context"
+	"errors"
+
+	"github.com/koofr/go-dropboxclient"
+	"github.com/koofr/go-dropboxclient/dropboxconformance"
+	"github.com/koofr/go-dropboxclient/mockdropbox"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("RunCase", func() {
+	newClient := func() (dropboxclient.Client, error) {
+		return mockdropbox.NewMemoryClient(), nil
+	}
+
+	It("should run a case in its own root folder", func() {
+		var root string
+
+		err := dropboxconformance.RunCase(context.Background(), newClient, &dropboxconformance.Case{
+			Name: "root",
+			Run: func(t *dropboxconformance.T) {
+				root = t.Root
+				t.Equal(t.Exists(t.Root), true, "root exists")
+			},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(root).To(HavePrefix("/conformance-"))
+	})
+
+	It("should return the failure of a case", func() {
+		err := dropboxconformance.RunCase(context.Background(), newClient, &dropboxconformance.Case{
+			Name: "failure",
+			Run: func(t *dropboxconformance.T) {
+				_, err := t.Client.GetMetadata(t.Ctx, &dropboxclient.GetMetadataArg{Path: t.Path("missing")})
+				t.Error(err, "path/conflict", "get metadata")
+			},
+		})
+		Expect(err).To(MatchError(ContainSubstring(`expected error path/conflict, got "path/not_found"`)))
+	})
+
+	It("should return client errors", func() {
+		err := dropboxconformance.RunCase(context.Background(), func() (dropboxclient.Client, error) {
+			return nil, errors.New("no client")
+		}, dropboxconformance.Cases[0])
+		Expect(err).To(MatchError("new client: no client"))
+	})
+})
+
+var _ = Describe("Diverge", func() {
+	It("should return the cases with different outcomes", func() {
+		failed := errors.New("failed")
+
+		reference := &dropboxconformance.Report{Results: []*dropboxconformance.Result{
+			{Case: "a"},
+			{Case: "b"},
+			{Case: "c", Err: failed},
+			{Case: "d", Err: failed},
+		}}
+		report := &dropboxconformance.Report{Results: []*dropboxconformance.Result{
+			{Case: "a"},
+			{Case: "b", Err: failed},
+			{Case: "c"},
+			{Case: "d", Err: failed},
+			{Case: "e", Err: failed},
+		}}
+
+		Expect(dropboxconformance.Diverge(reference, report)).To(Equal([]*dropboxconformance.Divergence{
+			{Case: "b", Got: failed},
+			{Case: "c", Expected: failed},
+		}))
+		Expect(report.Failures()).To(HaveLen(3))
+	})
+})
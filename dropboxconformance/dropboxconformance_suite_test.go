@@ -0,0 +1,13 @@
+package dropboxconformance_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestDropboxConformance(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "DropboxConformance Suite")
+}
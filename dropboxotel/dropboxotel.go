@@ -0,0 +1,212 @@
+// Package dropboxotel instruments the Dropbox client with OpenTelemetry
+// traces and metrics. It lives in its own module so that the core client
+// does not depend on OpenTelemetry.
+package dropboxotel
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/koofr/go-dropboxclient"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const ScopeName = "github.com/koofr/go-dropboxclient/dropboxotel"
+
+const (
+	RouteKey         = attribute.Key("dropbox.route")
+	StatusCodeKey    = attribute.Key("http.response.status_code")
+	ErrorTagKey      = attribute.Key("dropbox.error_tag")
+	BytesSentKey     = attribute.Key("dropbox.bytes_sent")
+	BytesReceivedKey = attribute.Key("dropbox.bytes_received")
+	RetryKey         = attribute.Key("dropbox.retry")
+)
+
+type Options struct {
+	// TracerProvider defaults to the global tracer provider.
+	TracerProvider trace.TracerProvider
+	// MeterProvider defaults to the global meter provider.
+	MeterProvider metric.MeterProvider
+}
+
+// Middleware returns a middleware that creates a client span per call and
+// records its duration in the dropbox.client.duration histogram.
+//
+// The span of a call whose response body is read by the caller, like
+// files/download, ends when the body is closed.
+func Middleware(opts *Options) (dropboxclient.Middleware, error) {
+	if opts == nil {
+		opts = &Options{}
+	}
+
+	tracerProvider := opts.TracerProvider
+	if tracerProvider == nil {
+		tracerProvider = otel.GetTracerProvider()
+	}
+
+	meterProvider := opts.MeterProvider
+	if meterProvider == nil {
+		meterProvider = otel.GetMeterProvider()
+	}
+
+	tracer := tracerProvider.Tracer(ScopeName)
+
+	duration, err := meterProvider.Meter(ScopeName).Float64Histogram(
+		"dropbox.client.duration",
+		metric.WithDescription("Duration of Dropbox API calls until the response headers are received."),
+		metric.WithUnit("s"),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(next dropboxclient.Handler) dropboxclient.Handler {
+		return func(call *dropboxclient.Call) (*http.Response, error) {
+			req := call.Request
+
+			parent := req.Context
+			if parent == nil {
+				parent = context.Background()
+			}
+
+			ctx, span := tracer.Start(parent, call.Route,
+				trace.WithSpanKind(trace.SpanKindClient),
+				trace.WithAttributes(
+					RouteKey.String(call.Route),
+					RetryKey.Int(call.Retry),
+				),
+			)
+
+			origCtx := req.Context
+			req.Context = ctx
+			defer func() {
+				req.Context = origCtx
+			}()
+
+			var sent *countingReader
+			if req.ReqReader != nil {
+				sent = &countingReader{r: req.ReqReader}
+				req.ReqReader = sent
+			}
+
+			start := time.Now()
+
+			res, err := next(call)
+
+			elapsed := time.Since(start)
+
+			if sent != nil {
+				span.SetAttributes(BytesSentKey.Int64(sent.count()))
+			} else if req.ReqContentLength > 0 {
+				span.SetAttributes(BytesSentKey.Int64(req.ReqContentLength))
+			}
+
+			metricAttrs := []attribute.KeyValue{RouteKey.String(call.Route)}
+
+			if statusCode := statusCode(res, err); statusCode != 0 {
+				span.SetAttributes(StatusCodeKey.Int(statusCode))
+				metricAttrs = append(metricAttrs, StatusCodeKey.Int(statusCode))
+			}
+
+			duration.Record(ctx, elapsed.Seconds(), metric.WithAttributes(metricAttrs...))
+
+			if err != nil {
+				if tag := dropboxclient.ErrorTag(err); tag != "" {
+					span.SetAttributes(ErrorTagKey.String(tag))
+				}
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+				span.End()
+				return res, err
+			}
+
+			if req.RespValue == nil && !req.RespConsume {
+				res.Body = &spanBody{body: res.Body, span: span}
+				return res, nil
+			}
+
+			if res.ContentLength >= 0 {
+				span.SetAttributes(BytesReceivedKey.Int64(res.ContentLength))
+			}
+			span.End()
+
+			return res, nil
+		}
+	}, nil
+}
+
+// Instrument adds the middleware to client.
+func Instrument(client *dropboxclient.Dropbox, opts *Options) error {
+	mw, err := Middleware(opts)
+	if err != nil {
+		return err
+	}
+
+	client.Use(mw)
+
+	return nil
+}
+
+func statusCode(res *http.Response, err error) int {
+	if res != nil {
+		return res.StatusCode
+	}
+
+	if dropboxErr, ok := dropboxclient.IsDropboxError(err); ok && dropboxErr.HttpClientError != nil {
+		return dropboxErr.HttpClientError.Got
+	}
+
+	return 0
+}
+
+type countingReader struct {
+	r io.Reader
+	n atomic.Int64
+}
+
+func (r *countingReader) Read(p []byte) (n int, err error) {
+	n, err = r.r.Read(p)
+	r.n.Add(int64(n))
+	return n, err
+}
+
+func (r *countingReader) count() int64 {
+	return r.n.Load()
+}
+
+// spanBody counts the bytes read from a streamed response body and ends the
+// span when the body is closed.
+type spanBody struct {
+	body io.ReadCloser
+	span trace.Span
+	read int64
+	once sync.Once
+}
+
+func (b *spanBody) Read(p []byte) (n int, err error) {
+	n, err = b.body.Read(p)
+	b.read += int64(n)
+	if err != nil && err != io.EOF {
+		b.span.RecordError(err)
+	}
+	return n, err
+}
+
+func (b *spanBody) Close() error {
+	err := b.body.Close()
+
+	b.once.Do(func() {
+		b.span.SetAttributes(BytesReceivedKey.Int64(b.read))
+		b.span.End()
+	})
+
+	return err
+}
@@ -0,0 +1,13 @@
+package dropboxotel_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestDropboxotel(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Dropboxotel Suite")
+}
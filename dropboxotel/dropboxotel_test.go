@@ -0,0 +1,163 @@
+package dropboxotel_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/koofr/go-dropboxclient"
+	. "github.com/koofr/go-dropboxclient/dropboxotel"
+	"github.com/koofr/go-dropboxclient/mockdropbox"
+	"github.com/koofr/go-httpclient"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	tracenoop "go.opentelemetry.io/otel/trace/noop"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Middleware", func() {
+	var mockServer *httptest.Server
+	var client *dropboxclient.Dropbox
+	var spans *tracetest.SpanRecorder
+	var reader *sdkmetric.ManualReader
+
+	BeforeEach(func() {
+		mockServer = httptest.NewServer(mockdropbox.New())
+
+		var err error
+		client, err = dropboxclient.New(dropboxclient.WithAccessToken("mock"), dropboxclient.WithBaseURL(mockServer.URL))
+		Expect(err).NotTo(HaveOccurred())
+
+		spans = tracetest.NewSpanRecorder()
+		reader = sdkmetric.NewManualReader()
+
+		Expect(Instrument(client, &Options{
+			TracerProvider: sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans)),
+			MeterProvider:  sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)),
+		})).To(Succeed())
+	})
+
+	AfterEach(func() {
+		mockServer.Close()
+	})
+
+	attrs := func(span sdktrace.ReadOnlySpan) map[attribute.Key]attribute.Value {
+		m := map[attribute.Key]attribute.Value{}
+		for _, kv := range span.Attributes() {
+			m[kv.Key] = kv.Value
+		}
+		return m
+	}
+
+	It("should record a span per route", func() {
+		_, err := client.CreateFolder(context.Background(), &dropboxclient.CreateFolderArg{Path: "/otel"})
+		Expect(err).NotTo(HaveOccurred())
+
+		ended := spans.Ended()
+		Expect(ended).To(HaveLen(1))
+		Expect(ended[0].Name()).To(Equal("files/create_folder"))
+
+		a := attrs(ended[0])
+		Expect(a[RouteKey].AsString()).To(Equal("files/create_folder"))
+		Expect(a[StatusCodeKey].AsInt64()).To(Equal(int64(200)))
+		Expect(a[BytesSentKey].AsInt64()).To(BeNumerically(">", 0))
+		Expect(a[RetryKey].AsInt64()).To(Equal(int64(0)))
+	})
+
+	It("should record the error tag", func() {
+		_, err := client.GetMetadata(context.Background(), &dropboxclient.GetMetadataArg{Path: "/missing"})
+		Expect(err).To(HaveOccurred())
+		Expect(dropboxclient.ErrorTag(err)).To(Equal("path/not_found"))
+
+		ended := spans.Ended()
+		Expect(ended).To(HaveLen(1))
+		Expect(ended[0].Status().Code).To(Equal(codes.Error))
+
+		a := attrs(ended[0])
+		Expect(a[ErrorTagKey].AsString()).To(Equal("path/not_found"))
+		Expect(a[StatusCodeKey].AsInt64()).To(Equal(int64(409)))
+	})
+
+	It("should count streamed bytes and end the span on close", func() {
+		data := []byte("hello otel")
+
+		session, err := client.UploadSessionStart(context.Background(), bytes.NewReader(data))
+		Expect(err).NotTo(HaveOccurred())
+		_, err = client.UploadSessionFinish(context.Background(), &dropboxclient.UploadSessionFinishArg{
+			Cursor: &dropboxclient.UploadSessionCursor{SessionId: session.SessionId, Offset: int64(len(data))},
+			Commit: &dropboxclient.CommitInfo{Path: "/file.txt", Mode: &dropboxclient.WriteMode{Tag: dropboxclient.WriteModeAdd}},
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(spans.Ended()).To(HaveLen(2))
+		Expect(attrs(spans.Ended()[0])[BytesSentKey].AsInt64()).To(Equal(int64(len(data))))
+
+		body, _, err := client.Download(context.Background(), &dropboxclient.DownloadArg{Path: "/file.txt"}, nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(spans.Ended()).To(HaveLen(2))
+
+		_, err = io.ReadAll(body)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(body.Close()).To(Succeed())
+
+		ended := spans.Ended()
+		Expect(ended).To(HaveLen(3))
+		Expect(ended[2].Name()).To(Equal("files/download"))
+		Expect(attrs(ended[2])[BytesReceivedKey].AsInt64()).To(Equal(int64(len(data))))
+	})
+
+	It("should start a span for a request without a context", func() {
+		middleware, err := Middleware(&Options{
+			TracerProvider: tracenoop.NewTracerProvider(),
+			MeterProvider:  sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)),
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		req := &httpclient.RequestData{RespConsume: true}
+		handler := middleware(func(call *dropboxclient.Call) (*http.Response, error) {
+			Expect(call.Request.Context).NotTo(BeNil())
+			return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+		})
+
+		_, err = handler(&dropboxclient.Call{Route: "files/get_metadata", Request: req})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(req.Context).To(BeNil())
+	})
+
+	It("should record latency histograms per route", func() {
+		_, err := client.CreateFolder(context.Background(), &dropboxclient.CreateFolderArg{Path: "/a"})
+		Expect(err).NotTo(HaveOccurred())
+		_, err = client.CreateFolder(context.Background(), &dropboxclient.CreateFolderArg{Path: "/b"})
+		Expect(err).NotTo(HaveOccurred())
+		_, err = client.GetMetadata(context.Background(), &dropboxclient.GetMetadataArg{Path: "/a"})
+		Expect(err).NotTo(HaveOccurred())
+
+		rm := metricdata.ResourceMetrics{}
+		Expect(reader.Collect(context.Background(), &rm)).To(Succeed())
+
+		Expect(rm.ScopeMetrics).To(HaveLen(1))
+		Expect(rm.ScopeMetrics[0].Metrics).To(HaveLen(1))
+
+		m := rm.ScopeMetrics[0].Metrics[0]
+		Expect(m.Name).To(Equal("dropbox.client.duration"))
+
+		counts := map[string]uint64{}
+		for _, point := range m.Data.(metricdata.Histogram[float64]).DataPoints {
+			route, _ := point.Attributes.Value(RouteKey)
+			counts[route.AsString()] += point.Count
+		}
+		Expect(counts).To(Equal(map[string]uint64{
+			"files/create_folder": 2,
+			"files/get_metadata":  1,
+		}))
+	})
+})
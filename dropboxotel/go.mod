@@ -0,0 +1,36 @@
+module github.com/koofr/go-dropboxclient/dropboxotel
+
+go 1.21
+
+require (
+	github.com/koofr/go-dropboxclient v0.0.0-20261018195505-682324a3ed4e
+	github.com/koofr/go-httpclient v0.0.0-20240520111329-e20f8f203988
+	github.com/onsi/ginkgo/v2 v2.17.3
+	github.com/onsi/gomega v1.33.1
+	go.opentelemetry.io/otel v1.28.0
+	go.opentelemetry.io/otel/metric v1.28.0
+	go.opentelemetry.io/otel/sdk v1.28.0
+	go.opentelemetry.io/otel/sdk/metric v1.28.0
+	go.opentelemetry.io/otel/trace v1.28.0
+)
+
+require (
+	github.com/go-logr/logr v1.4.2 // indirect
+	github.com/go-logr/stdr v1.2.2 // indirect
+	github.com/go-task/slim-sprig/v3 v3.0.0 // indirect
+	github.com/google/go-cmp v0.6.0 // indirect
+	github.com/google/pprof v0.0.0-20240509144519-723abb6459b7 // indirect
+	github.com/google/uuid v1.6.0 // indirect
+	github.com/gorilla/mux v1.8.1 // indirect
+	github.com/koofr/go-httputils v0.0.0-20240520111524-c45bd15e974d // indirect
+	github.com/koofr/go-ioutils v0.0.0-20240520105419-00cafc007e76 // indirect
+	github.com/koofr/go-pathutils v0.0.0-20240520113213-2f3538c02136 // indirect
+	golang.org/x/net v0.25.0 // indirect
+	golang.org/x/sys v0.21.0 // indirect
+	golang.org/x/text v0.15.0 // indirect
+	golang.org/x/time v0.5.0 // indirect
+	golang.org/x/tools v0.21.0 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
+)
+
+replace github.com/koofr/go-dropboxclient => ../
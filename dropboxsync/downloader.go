@@ -0,0 +1,341 @@
+package dropboxsync
+
+import (
+	"context"
+	"encoding/hex"
+	"io"
+	"os"
+	gopath "path"
+	"path/filepath"
+	"strings"
+
+	"github.com/koofr/go-dropboxclient"
+)
+
+const tempFilePrefix = ".dropboxsync-"
+
+// Downloader keeps a local directory in step with a Dropbox folder. The
+// first Sync lists the whole folder, later calls only apply the changes
+// since the persisted list folder cursor.
+type Downloader struct {
+	Client    dropboxclient.Client
+	RemoteDir string
+	LocalDir  string
+	// CursorPath is the file the list folder cursor is persisted to. If
+	// empty the cursor is only kept in memory.
+	CursorPath string
+	// Cursors overrides CursorPath with a custom cursor store.
+	Cursors dropboxclient.CursorStore
+
+	feed *dropboxclient.ChangeFeed
+	seen map[string]bool
+}
+
+func (d *Downloader) changeFeed() *dropboxclient.ChangeFeed {
+	if d.feed == nil {
+		cursors := d.Cursors
+		if cursors == nil && d.CursorPath != "" {
+			cursors = dropboxclient.NewFileCursorStore(d.CursorPath)
+		}
+
+		d.feed = dropboxclient.NewChangeFeed(d.Client, &dropboxclient.ListFolderArg{
+			Path:      d.RemoteDir,
+			Recursive: true,
+		}, cursors)
+	}
+
+	return d.feed
+}
+
+// Sync applies all pending remote changes to the local directory. If there
+// is no cursor yet or Dropbox reset the cursor, the whole folder is listed
+// again and local entries missing remotely are removed.
+func (d *Downloader) Sync(ctx context.Context) error {
+	if err := os.MkdirAll(d.LocalDir, 0755); err != nil {
+		return err
+	}
+
+	// an interrupted full listing starts over in the next Poll
+	d.seen = nil
+
+	return d.changeFeed().Poll(ctx, d.handle)
+}
+
+func (d *Downloader) handle(ctx context.Context, batch *dropboxclient.ChangeBatch) error {
+	if batch.Reset {
+		if d.seen == nil {
+			d.seen = map[string]bool{}
+		}
+
+		for _, md := range batch.Entries {
+			if rel, ok := d.rel(md.PathLower); ok && md.Tag != dropboxclient.MetadataDeleted {
+				d.seen[rel] = true
+			}
+		}
+	}
+
+	if err := d.apply(ctx, batch.Entries); err != nil {
+		return err
+	}
+
+	if batch.Reset && !batch.HasMore {
+		seen := d.seen
+		d.seen = nil
+		return d.removeUnseen(seen)
+	}
+
+	return nil
+}
+
+func (d *Downloader) removeUnseen(seen map[string]bool) error {
+	var remove func(dir string, rel string) error
+	remove = func(dir string, rel string) error {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return err
+		}
+
+		for _, entry := range entries {
+			childRel := strings.ToLower(gopath.Join(rel, entry.Name()))
+			childPath := filepath.Join(dir, entry.Name())
+
+			if !seen[childRel] {
+				if err := os.RemoveAll(childPath); err != nil {
+					return err
+				}
+				continue
+			}
+
+			if entry.IsDir() {
+				if err := remove(childPath, childRel); err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	}
+
+	return remove(d.LocalDir, "")
+}
+
+// rel returns the lower case path of pathLower relative to RemoteDir.
+func (d *Downloader) rel(pathLower string) (string, bool) {
+	root := strings.ToLower(strings.TrimSuffix(d.RemoteDir, "/"))
+
+	if pathLower == root {
+		return "", true
+	}
+
+	if !strings.HasPrefix(pathLower, root+"/") {
+		return "", false
+	}
+
+	return pathLower[len(root)+1:], true
+}
+
+// resolve finds the local path of rel, matching every component case
+// insensitively. ok is false if some component does not exist, in which
+// case path is built from the components that do.
+func (d *Downloader) resolve(rel string) (path string, ok bool) {
+	path = d.LocalDir
+
+	if rel == "" {
+		return path, true
+	}
+
+	parts := strings.Split(rel, "/")
+
+	for i, part := range parts {
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return filepath.Join(path, filepath.Join(parts[i:]...)), false
+		}
+
+		found := ""
+		for _, entry := range entries {
+			if entry.Name() == part {
+				found = part
+				break
+			}
+			if found == "" && strings.EqualFold(entry.Name(), part) {
+				found = entry.Name()
+			}
+		}
+
+		if found == "" {
+			return filepath.Join(path, filepath.Join(parts[i:]...)), false
+		}
+
+		path = filepath.Join(path, found)
+	}
+
+	return path, true
+}
+
+// target returns the local path an entry should be written to, using the
+// entry name for the last component.
+func (d *Downloader) target(rel string, md *dropboxclient.Metadata) (path string, existing string, exists bool) {
+	parentPath := d.LocalDir
+	if parentRel := gopath.Dir(rel); parentRel != "." {
+		parentPath, _ = d.resolve(parentRel)
+	}
+
+	existing, exists = d.resolve(rel)
+
+	return filepath.Join(parentPath, md.Name), existing, exists
+}
+
+func (d *Downloader) apply(ctx context.Context, entries []*dropboxclient.Metadata) error {
+	for _, md := range entries {
+		rel, ok := d.rel(md.PathLower)
+		if !ok || rel == "" {
+			continue
+		}
+
+		var err error
+
+		switch md.Tag {
+		case dropboxclient.MetadataDeleted:
+			if existing, exists := d.resolve(rel); exists {
+				err = os.RemoveAll(existing)
+			}
+		case dropboxclient.MetadataFolder:
+			err = d.applyFolder(rel, md)
+		case dropboxclient.MetadataFile:
+			err = d.applyFile(ctx, rel, md)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (d *Downloader) applyFolder(rel string, md *dropboxclient.Metadata) error {
+	path, existing, exists := d.target(rel, md)
+
+	if exists {
+		info, err := os.Stat(existing)
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if existing != path {
+				return os.Rename(existing, path)
+			}
+			return nil
+		}
+		if err := os.Remove(existing); err != nil {
+			return err
+		}
+	}
+
+	return os.MkdirAll(path, 0755)
+}
+
+func (d *Downloader) unchanged(path string, md *dropboxclient.Metadata) bool {
+	info, err := os.Stat(path)
+	if err != nil || !info.Mode().IsRegular() || info.Size() != md.Size {
+		return false
+	}
+
+	if info.ModTime().Equal(md.ClientModified) {
+		return true
+	}
+
+	if md.ContentHash == "" {
+		return false
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	h := dropboxclient.NewContentHash()
+	if _, err := io.Copy(h, f); err != nil {
+		return false
+	}
+
+	if hex.EncodeToString(h.Sum(nil)) != md.ContentHash {
+		return false
+	}
+
+	return os.Chtimes(path, md.ClientModified, md.ClientModified) == nil
+}
+
+func (d *Downloader) applyFile(ctx context.Context, rel string, md *dropboxclient.Metadata) error {
+	path, existing, exists := d.target(rel, md)
+
+	if exists && existing == path && d.unchanged(path, md) {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	// download by id so that a concurrent rename can not change the content
+	reader, _, err := d.Client.Download(ctx, &dropboxclient.DownloadArg{Path: md.Id}, nil)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	write := func(f *os.File) error {
+		if _, err := io.Copy(f, reader); err != nil {
+			return err
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+		return os.Chtimes(f.Name(), md.ClientModified, md.ClientModified)
+	}
+
+	// the existing entry is only removed once the new content is written.
+	// A file at path is replaced by the rename.
+	replace := func() error {
+		if !exists {
+			return nil
+		}
+		if existing == path {
+			if info, err := os.Lstat(existing); err != nil || !info.IsDir() {
+				return nil
+			}
+		}
+		return os.RemoveAll(existing)
+	}
+
+	return writeFileAtomic(path, write, replace)
+}
+
+// writeFileAtomic writes a temporary file next to path and renames it over
+// path once write and then replace succeed. write may close the file.
+func writeFileAtomic(path string, write func(f *os.File) error, replace func() error) error {
+	f, err := os.CreateTemp(filepath.Dir(path), tempFilePrefix+"*")
+	if err != nil {
+		return err
+	}
+	tmpPath := f.Name()
+
+	err = write(f)
+	f.Close()
+
+	if err == nil {
+		err = replace()
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, path)
+	}
+
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	return nil
+}
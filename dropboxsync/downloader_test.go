@@ -0,0 +1,235 @@
+package dropboxsync_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	gopath "path"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"github.com/koofr/go-dropboxclient"
+	. "github.com/koofr/go-dropboxclient/dropboxsync"
+	"github.com/koofr/go-dropboxclient/mockdropbox"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Downloader", func() {
+	var mock *mockdropbox.MockDropbox
+	var mockServer *httptest.Server
+	var client *dropboxclient.Dropbox
+	var localDir string
+	var downloader *Downloader
+	var resetNext atomic.Bool
+
+	BeforeEach(func() {
+		mock = mockdropbox.New()
+		resetNext.Store(false)
+
+		mockServer = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/2/files/list_folder/continue" && resetNext.CompareAndSwap(true, false) {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusConflict)
+				w.Write([]byte(`{"error_summary":"reset/..","error":{".tag":"reset"}}`))
+				return
+			}
+			mock.ServeHTTP(w, r)
+		}))
+
+		var err error
+		client, err = dropboxclient.New(dropboxclient.WithAccessToken("mock"), dropboxclient.WithBaseURL(mockServer.URL))
+		Expect(err).NotTo(HaveOccurred())
+
+		localDir = GinkgoT().TempDir()
+
+		downloader = &Downloader{
+			Client:     client,
+			RemoteDir:  "/backup",
+			LocalDir:   filepath.Join(localDir, "mirror"),
+			CursorPath: filepath.Join(localDir, "cursor"),
+		}
+	})
+
+	AfterEach(func() {
+		mockServer.Close()
+	})
+
+	modTime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	writeRemote := func(p string, data string) {
+		dirs := []string{}
+		for dir := gopath.Dir(p); dir != "/"; dir = gopath.Dir(dir) {
+			dirs = append([]string{dir}, dirs...)
+		}
+		for _, dir := range dirs {
+			_, err := client.CreateFolder(context.Background(), &dropboxclient.CreateFolderArg{Path: dir})
+			if !errors.Is(dropboxclient.FSError(err), fs.ErrExist) {
+				Expect(err).NotTo(HaveOccurred())
+			}
+		}
+
+		clientModified := modTime.Format(dropboxclient.DropboxClientModifiedFormat)
+		w := client.NewUploadWriter(context.Background(), &dropboxclient.CommitInfo{
+			Path:           p,
+			Mode:           &dropboxclient.WriteMode{Tag: dropboxclient.WriteModeOverwrite},
+			ClientModified: &clientModified,
+		})
+		_, err := io.WriteString(w, data)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(w.Close()).To(Succeed())
+	}
+
+	deleteRemote := func(p string) {
+		_, err := client.Delete(context.Background(), &dropboxclient.DeleteArg{Path: p})
+		Expect(err).NotTo(HaveOccurred())
+	}
+
+	readLocal := func(rel string) string {
+		data, err := os.ReadFile(filepath.Join(downloader.LocalDir, filepath.FromSlash(rel)))
+		Expect(err).NotTo(HaveOccurred())
+		return string(data)
+	}
+
+	localExists := func(rel string) bool {
+		_, err := os.Stat(filepath.Join(downloader.LocalDir, filepath.FromSlash(rel)))
+		if os.IsNotExist(err) {
+			return false
+		}
+		Expect(err).NotTo(HaveOccurred())
+		return true
+	}
+
+	sync := func() {
+		Expect(downloader.Sync(context.Background())).To(Succeed())
+	}
+
+	It("should download the initial tree", func() {
+		writeRemote("/backup/a.txt", "a")
+		writeRemote("/backup/dir/b.txt", "b")
+		writeRemote("/other/c.txt", "c")
+
+		sync()
+
+		Expect(readLocal("a.txt")).To(Equal("a"))
+		Expect(readLocal("dir/b.txt")).To(Equal("b"))
+		Expect(localExists("c.txt")).To(BeFalse())
+
+		info, err := os.Stat(filepath.Join(downloader.LocalDir, "a.txt"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.ModTime().Equal(modTime)).To(BeTrue())
+
+		cursor, err := os.ReadFile(downloader.CursorPath)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cursor).NotTo(BeEmpty())
+	})
+
+	It("should apply incremental changes", func() {
+		writeRemote("/backup/a.txt", "a")
+		writeRemote("/backup/dir/b.txt", "b")
+		sync()
+
+		writeRemote("/backup/a.txt", "changed")
+		writeRemote("/backup/new.txt", "new")
+		deleteRemote("/backup/dir")
+
+		sync()
+
+		Expect(readLocal("a.txt")).To(Equal("changed"))
+		Expect(readLocal("new.txt")).To(Equal("new"))
+		Expect(localExists("dir")).To(BeFalse())
+	})
+
+	It("should resume from the persisted cursor", func() {
+		writeRemote("/backup/a.txt", "a")
+		sync()
+
+		writeRemote("/backup/b.txt", "b")
+
+		downloader = &Downloader{
+			Client:     client,
+			RemoteDir:  downloader.RemoteDir,
+			LocalDir:   downloader.LocalDir,
+			CursorPath: downloader.CursorPath,
+		}
+
+		Expect(os.WriteFile(filepath.Join(downloader.LocalDir, "a.txt"), []byte("local"), 0644)).To(Succeed())
+
+		sync()
+
+		Expect(readLocal("b.txt")).To(Equal("b"))
+		Expect(readLocal("a.txt")).To(Equal("local"))
+	})
+
+	It("should replace a file with a folder", func() {
+		writeRemote("/backup/x", "file")
+		sync()
+
+		deleteRemote("/backup/x")
+		writeRemote("/backup/x/y.txt", "y")
+		sync()
+
+		Expect(readLocal("x/y.txt")).To(Equal("y"))
+	})
+
+	It("should keep the local file if the download fails", func() {
+		writeRemote("/backup/a.txt", "old")
+		sync()
+
+		writeRemote("/backup/a.txt", "new content")
+		mock.SetFaults(1, &mockdropbox.FaultRule{
+			Route:      "files/download",
+			Fault:      mockdropbox.FaultReset,
+			ResetAfter: 3,
+		})
+		Expect(downloader.Sync(context.Background())).NotTo(Succeed())
+
+		Expect(readLocal("a.txt")).To(Equal("old"))
+		entries, err := os.ReadDir(downloader.LocalDir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(entries).To(HaveLen(1))
+
+		mock.ClearFaults()
+		sync()
+
+		Expect(readLocal("a.txt")).To(Equal("new content"))
+	})
+
+	It("should resync after a cursor reset", func() {
+		writeRemote("/backup/a.txt", "a")
+		writeRemote("/backup/b.txt", "b")
+		sync()
+
+		Expect(os.WriteFile(filepath.Join(downloader.LocalDir, "stale.txt"), []byte("stale"), 0644)).To(Succeed())
+		deleteRemote("/backup/b.txt")
+		writeRemote("/backup/c.txt", "c")
+
+		resetNext.Store(true)
+		sync()
+		Expect(resetNext.Load()).To(BeFalse())
+
+		Expect(readLocal("a.txt")).To(Equal("a"))
+		Expect(readLocal("c.txt")).To(Equal("c"))
+		Expect(localExists("b.txt")).To(BeFalse())
+		Expect(localExists("stale.txt")).To(BeFalse())
+	})
+
+	It("should delete entries case-insensitively", func() {
+		writeRemote("/backup/Dir/File.txt", "f")
+		sync()
+
+		Expect(readLocal("Dir/File.txt")).To(Equal("f"))
+
+		deleteRemote("/backup/dir/file.txt")
+		sync()
+
+		Expect(localExists("Dir/File.txt")).To(BeFalse())
+		Expect(localExists("Dir")).To(BeTrue())
+	})
+})
@@ -0,0 +1,13 @@
+package dropboxsync_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestDropboxsync(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Dropboxsync Suite")
+}
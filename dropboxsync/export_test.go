@@ -0,0 +1,13 @@
+package dropboxsync
+
+import "io"
+
+// SetOpenLocalFile replaces the function that opens local files for upload
+// and returns a function that restores it.
+func SetOpenLocalFile(open func(path string) (io.ReadCloser, error)) (restore func()) {
+	prev := openLocalFile
+	openLocalFile = open
+	return func() {
+		openLocalFile = prev
+	}
+}
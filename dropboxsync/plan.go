@@ -0,0 +1,159 @@
+// Package dropboxsync mirrors folders between the local file system and
+// Dropbox.
+package dropboxsync
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+)
+
+type ActionType string
+
+const (
+	ActionCreateFolder ActionType = "create_folder"
+	ActionUpload       ActionType = "upload"
+	ActionUpdate       ActionType = "update"
+	ActionMove         ActionType = "move"
+	ActionDelete       ActionType = "delete"
+)
+
+type Action struct {
+	Type ActionType
+	// LocalPath is the local file for uploads and updates.
+	LocalPath string
+	// RemotePath is the target of the action.
+	RemotePath string
+	// FromRemotePath is the source of a move.
+	FromRemotePath string
+	// Rev is the known remote rev of the file replaced by an update.
+	Rev string
+	// Size is the size of the uploaded file.
+	Size int64
+}
+
+func (a *Action) String() string {
+	switch a.Type {
+	case ActionUpload, ActionUpdate:
+		return fmt.Sprintf("%s %s -> %s", a.Type, a.LocalPath, a.RemotePath)
+	case ActionMove:
+		return fmt.Sprintf("%s %s -> %s", a.Type, a.FromRemotePath, a.RemotePath)
+	default:
+		return fmt.Sprintf("%s %s", a.Type, a.RemotePath)
+	}
+}
+
+// Plan is an ordered list of actions. Consecutive actions of the same type
+// form a step; actions within a step are independent of each other and may
+// run concurrently, except folder creations which run in order.
+type Plan struct {
+	Actions []*Action
+}
+
+func (p *Plan) add(actions ...*Action) {
+	p.Actions = append(p.Actions, actions...)
+}
+
+func (p *Plan) steps() [][]*Action {
+	steps := [][]*Action{}
+
+	for i, action := range p.Actions {
+		if i == 0 || action.Type != p.Actions[i-1].Type {
+			steps = append(steps, []*Action{})
+		}
+		steps[len(steps)-1] = append(steps[len(steps)-1], action)
+	}
+
+	return steps
+}
+
+// Print writes one line per action to w.
+func (p *Plan) Print(w io.Writer) error {
+	for _, action := range p.Actions {
+		if _, err := fmt.Fprintln(w, action.String()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+type ActionError struct {
+	Action *Action
+	Err    error
+}
+
+func (e *ActionError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Action, e.Err)
+}
+
+func (e *ActionError) Unwrap() error {
+	return e.Err
+}
+
+// execute runs the plan step by step with at most concurrency actions in
+// flight. It stops after the first failed step and returns the first error.
+func (p *Plan) execute(ctx context.Context, concurrency int, run func(ctx context.Context, action *Action) error) error {
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	for _, step := range p.steps() {
+		stepConcurrency := concurrency
+		if step[0].Type == ActionCreateFolder {
+			stepConcurrency = 1
+		}
+
+		if err := executeStep(ctx, step, stepConcurrency, run); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func executeStep(ctx context.Context, step []*Action, concurrency int, run func(ctx context.Context, action *Action) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	jobs := make(chan *Action)
+	var firstErr error
+	var errMutex sync.Mutex
+	var wg sync.WaitGroup
+
+	for i := 0; i < concurrency && i < len(step); i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for action := range jobs {
+				if err := run(ctx, action); err != nil {
+					errMutex.Lock()
+					if firstErr == nil {
+						firstErr = &ActionError{Action: action, Err: err}
+					}
+					errMutex.Unlock()
+					cancel()
+				}
+			}
+		}()
+	}
+
+	for _, action := range step {
+		select {
+		case jobs <- action:
+		case <-ctx.Done():
+		}
+	}
+
+	close(jobs)
+	wg.Wait()
+
+	if firstErr != nil {
+		return firstErr
+	}
+
+	return ctx.Err()
+}
@@ -0,0 +1,413 @@
+package dropboxsync
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	gopath "path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/koofr/go-dropboxclient"
+)
+
+const DefaultConcurrency = 4
+
+// Uploader mirrors a local directory to a Dropbox folder: new and changed
+// files are uploaded, files that vanished locally are deleted remotely and
+// renamed files are moved instead of uploaded again.
+type Uploader struct {
+	Client    dropboxclient.Client
+	LocalDir  string
+	RemoteDir string
+	// Concurrency is the maximum number of actions executed at the same
+	// time. Defaults to DefaultConcurrency.
+	Concurrency int
+	// DryRun makes Sync print the plan instead of executing it.
+	DryRun bool
+	// Output receives the plan in dry-run mode. Defaults to os.Stdout.
+	Output io.Writer
+}
+
+type localEntry struct {
+	path    string
+	rel     string
+	isDir   bool
+	size    int64
+	modTime time.Time
+	hash    string
+}
+
+func (e *localEntry) contentHash() (string, error) {
+	if e.hash != "" {
+		return e.hash, nil
+	}
+
+	f, err := os.Open(e.path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := dropboxclient.NewContentHash()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+
+	e.hash = hex.EncodeToString(h.Sum(nil))
+
+	return e.hash, nil
+}
+
+type remoteEntry struct {
+	rel string
+	md  *dropboxclient.Metadata
+}
+
+func relKey(rel string) string {
+	return strings.ToLower(rel)
+}
+
+func isUnder(key string, parentKey string) bool {
+	return strings.HasPrefix(key, parentKey+"/")
+}
+
+func (u *Uploader) remoteRoot() string {
+	return strings.TrimSuffix(u.RemoteDir, "/")
+}
+
+func (u *Uploader) remotePath(rel string) string {
+	return u.remoteRoot() + "/" + rel
+}
+
+func (u *Uploader) scanLocal() (entries []*localEntry, err error) {
+	err = filepath.WalkDir(u.LocalDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if p == u.LocalDir {
+			return nil
+		}
+		if !d.IsDir() && !d.Type().IsRegular() {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(u.LocalDir, p)
+		if err != nil {
+			return err
+		}
+
+		entries = append(entries, &localEntry{
+			path:    p,
+			rel:     filepath.ToSlash(rel),
+			isDir:   d.IsDir(),
+			size:    info.Size(),
+			modTime: info.ModTime().UTC().Truncate(time.Second),
+		})
+
+		return nil
+	})
+
+	return entries, err
+}
+
+func (u *Uploader) scanRemote(ctx context.Context) (entries map[string]*remoteEntry, rootExists bool, err error) {
+	entries = map[string]*remoteEntry{}
+	root := u.remoteRoot()
+	rootExists = true
+
+	err = dropboxclient.Walk(ctx, u.Client, root, func(p string, md *dropboxclient.Metadata, err error) error {
+		if err != nil {
+			if p == root && md == nil && errors.Is(dropboxclient.FSError(err), fs.ErrNotExist) {
+				rootExists = false
+				return nil
+			}
+			return err
+		}
+		if p == root {
+			return nil
+		}
+
+		rel := strings.TrimPrefix(p, root+"/")
+		entries[relKey(rel)] = &remoteEntry{rel: rel, md: md}
+
+		return nil
+	})
+
+	return entries, rootExists, err
+}
+
+func (u *Uploader) unchanged(local *localEntry, remote *dropboxclient.Metadata) (bool, error) {
+	if local.size != remote.Size {
+		return false, nil
+	}
+
+	if local.modTime.Equal(remote.ClientModified.UTC().Truncate(time.Second)) {
+		return true, nil
+	}
+
+	if remote.ContentHash == "" {
+		return false, nil
+	}
+
+	hash, err := local.contentHash()
+	if err != nil {
+		return false, err
+	}
+
+	return hash == remote.ContentHash, nil
+}
+
+// Plan compares the local directory with the remote folder and returns the
+// actions needed to make the remote folder match.
+func (u *Uploader) Plan(ctx context.Context) (*Plan, error) {
+	locals, err := u.scanLocal()
+	if err != nil {
+		return nil, err
+	}
+
+	remotes, rootExists, err := u.scanRemote(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &Plan{}
+
+	if !rootExists && u.remoteRoot() != "" {
+		plan.add(&Action{Type: ActionCreateFolder, RemotePath: u.remoteRoot()})
+	}
+
+	localKeys := map[string]*localEntry{}
+	for _, local := range locals {
+		localKeys[relKey(local.rel)] = local
+	}
+
+	// remote entries replaced by an entry of the other type are deleted first
+	replaced := []*Action{}
+	for _, local := range locals {
+		key := relKey(local.rel)
+		remote, ok := remotes[key]
+		if !ok || local.isDir == (remote.md.Tag == dropboxclient.MetadataFolder) {
+			continue
+		}
+
+		replaced = append(replaced, &Action{Type: ActionDelete, RemotePath: u.remotePath(remote.rel)})
+
+		for k := range remotes {
+			if k == key || isUnder(k, key) {
+				delete(remotes, k)
+			}
+		}
+	}
+
+	folders := []*Action{}
+	uploads := []*Action{}
+	updates := []*Action{}
+	uploadEntries := map[*Action]*localEntry{}
+
+	for _, local := range locals {
+		remote, ok := remotes[relKey(local.rel)]
+
+		if local.isDir {
+			if !ok {
+				folders = append(folders, &Action{Type: ActionCreateFolder, RemotePath: u.remotePath(local.rel)})
+			}
+			continue
+		}
+
+		if !ok {
+			action := &Action{Type: ActionUpload, LocalPath: local.path, RemotePath: u.remotePath(local.rel), Size: local.size}
+			uploads = append(uploads, action)
+			uploadEntries[action] = local
+			continue
+		}
+
+		unchanged, err := u.unchanged(local, remote.md)
+		if err != nil {
+			return nil, err
+		}
+		if !unchanged {
+			updates = append(updates, &Action{Type: ActionUpdate, LocalPath: local.path, RemotePath: u.remotePath(local.rel), Rev: remote.md.Rev, Size: local.size})
+		}
+	}
+
+	// remote files that vanished locally are move sources for new local
+	// files with the same content
+	vanished := map[string][]string{}
+	for key, remote := range remotes {
+		if _, ok := localKeys[key]; ok || remote.md.Tag != dropboxclient.MetadataFile || remote.md.ContentHash == "" {
+			continue
+		}
+		vanished[remote.md.ContentHash] = append(vanished[remote.md.ContentHash], key)
+	}
+	for _, keys := range vanished {
+		sort.Strings(keys)
+	}
+
+	moves := []*Action{}
+	moved := map[string]bool{}
+	remainingUploads := []*Action{}
+
+	for _, action := range uploads {
+		local := uploadEntries[action]
+
+		var keys []string
+		if len(vanished) > 0 {
+			hash, err := local.contentHash()
+			if err != nil {
+				return nil, err
+			}
+			keys = vanished[hash]
+		}
+
+		if len(keys) == 0 {
+			remainingUploads = append(remainingUploads, action)
+			continue
+		}
+
+		from := remotes[keys[0]]
+		vanished[local.hash] = keys[1:]
+		moved[keys[0]] = true
+
+		moves = append(moves, &Action{Type: ActionMove, FromRemotePath: u.remotePath(from.rel), RemotePath: action.RemotePath, Size: local.size})
+	}
+
+	deleteKeys := []string{}
+	for key := range remotes {
+		if _, ok := localKeys[key]; !ok && !moved[key] {
+			deleteKeys = append(deleteKeys, key)
+		}
+	}
+	sort.Strings(deleteKeys)
+
+	deleted := map[string]bool{}
+	deletes := []*Action{}
+	for _, key := range deleteKeys {
+		parentDeleted := false
+		for parent := gopath.Dir(key); parent != "."; parent = gopath.Dir(parent) {
+			if deleted[parent] {
+				parentDeleted = true
+				break
+			}
+		}
+		deleted[key] = true
+		if !parentDeleted {
+			deletes = append(deletes, &Action{Type: ActionDelete, RemotePath: u.remotePath(remotes[key].rel)})
+		}
+	}
+
+	plan.add(replaced...)
+	plan.add(folders...)
+	plan.add(moves...)
+	plan.add(remainingUploads...)
+	plan.add(updates...)
+	plan.add(deletes...)
+
+	return plan, nil
+}
+
+// Execute runs the actions of plan.
+func (u *Uploader) Execute(ctx context.Context, plan *Plan) error {
+	concurrency := u.Concurrency
+	if concurrency <= 0 {
+		concurrency = DefaultConcurrency
+	}
+
+	return plan.execute(ctx, concurrency, u.run)
+}
+
+// Sync plans and executes the mirror. In dry-run mode the plan is printed
+// to Output and nothing is changed.
+func (u *Uploader) Sync(ctx context.Context) (*Plan, error) {
+	plan, err := u.Plan(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if u.DryRun {
+		output := u.Output
+		if output == nil {
+			output = os.Stdout
+		}
+		return plan, plan.Print(output)
+	}
+
+	return plan, u.Execute(ctx, plan)
+}
+
+func (u *Uploader) run(ctx context.Context, action *Action) error {
+	switch action.Type {
+	case ActionCreateFolder:
+		_, err := u.Client.CreateFolder(ctx, &dropboxclient.CreateFolderArg{Path: action.RemotePath})
+		if errors.Is(dropboxclient.FSError(err), fs.ErrExist) {
+			return nil
+		}
+		return err
+
+	case ActionUpload, ActionUpdate:
+		return u.upload(ctx, action)
+
+	case ActionMove:
+		_, err := u.Client.Move(ctx, &dropboxclient.RelocationArg{FromPath: action.FromRemotePath, ToPath: action.RemotePath})
+		return err
+
+	case ActionDelete:
+		_, err := u.Client.Delete(ctx, &dropboxclient.DeleteArg{Path: action.RemotePath})
+		if errors.Is(dropboxclient.FSError(err), fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+
+	return nil
+}
+
+// openLocalFile opens a local file for upload. It is replaced in tests.
+var openLocalFile = func(path string) (io.ReadCloser, error) {
+	return os.Open(path)
+}
+
+func (u *Uploader) upload(ctx context.Context, action *Action) error {
+	f, err := openLocalFile(action.LocalPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := os.Stat(action.LocalPath)
+	if err != nil {
+		return err
+	}
+
+	mode := &dropboxclient.WriteMode{Tag: dropboxclient.WriteModeAdd}
+	if action.Type == ActionUpdate {
+		mode = &dropboxclient.WriteMode{Tag: dropboxclient.WriteModeUpdate, Update: action.Rev}
+	}
+
+	clientModified := info.ModTime().UTC().Truncate(time.Second).Format(dropboxclient.DropboxClientModifiedFormat)
+
+	w := dropboxclient.NewUploadWriter(ctx, u.Client, &dropboxclient.CommitInfo{
+		Path:           action.RemotePath,
+		Mode:           mode,
+		ClientModified: &clientModified,
+		Mute:           true,
+	})
+
+	if _, err := io.Copy(w, f); err != nil {
+		// do not commit a truncated file
+		w.Abort()
+		return err
+	}
+
+	return w.Close()
+}
@@ -0,0 +1,258 @@
+package dropboxsync_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing/iotest"
+	"time"
+
+	"github.com/koofr/go-dropboxclient"
+	. "github.com/koofr/go-dropboxclient/dropboxsync"
+	"github.com/koofr/go-dropboxclient/mockdropbox"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Uploader", func() {
+	var mockServer *httptest.Server
+	var client *dropboxclient.Dropbox
+	var localDir string
+	var uploader *Uploader
+
+	BeforeEach(func() {
+		mockServer = httptest.NewServer(mockdropbox.New())
+
+		var err error
+		client, err = dropboxclient.New(dropboxclient.WithAccessToken("mock"), dropboxclient.WithBaseURL(mockServer.URL))
+		Expect(err).NotTo(HaveOccurred())
+
+		localDir = GinkgoT().TempDir()
+
+		uploader = &Uploader{
+			Client:    client,
+			LocalDir:  localDir,
+			RemoteDir: "/backup",
+		}
+	})
+
+	AfterEach(func() {
+		mockServer.Close()
+	})
+
+	modTime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	writeLocal := func(rel string, data string) {
+		p := filepath.Join(localDir, filepath.FromSlash(rel))
+		Expect(os.MkdirAll(filepath.Dir(p), 0755)).To(Succeed())
+		Expect(os.WriteFile(p, []byte(data), 0644)).To(Succeed())
+		Expect(os.Chtimes(p, modTime, modTime)).To(Succeed())
+	}
+
+	readRemote := func(p string) string {
+		reader, _, err := client.Download(context.Background(), &dropboxclient.DownloadArg{Path: p}, nil)
+		Expect(err).NotTo(HaveOccurred())
+		defer reader.Close()
+		data, err := io.ReadAll(reader)
+		Expect(err).NotTo(HaveOccurred())
+		return string(data)
+	}
+
+	remoteExists := func(p string) bool {
+		_, err := client.GetMetadata(context.Background(), &dropboxclient.GetMetadataArg{Path: p})
+		if errors.Is(dropboxclient.FSError(err), fs.ErrNotExist) {
+			return false
+		}
+		Expect(err).NotTo(HaveOccurred())
+		return true
+	}
+
+	actionStrings := func(plan *Plan) []string {
+		strs := []string{}
+		for _, action := range plan.Actions {
+			strs = append(strs, action.String())
+		}
+		return strs
+	}
+
+	sync := func() *Plan {
+		plan, err := uploader.Sync(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		return plan
+	}
+
+	It("should upload a new tree", func() {
+		writeLocal("a.txt", "a")
+		writeLocal("dir/b.txt", "b")
+		writeLocal("dir/sub/c.txt", "c")
+
+		plan := sync()
+		Expect(actionStrings(plan)).To(Equal([]string{
+			"create_folder /backup",
+			"create_folder /backup/dir",
+			"create_folder /backup/dir/sub",
+			"upload " + filepath.Join(localDir, "a.txt") + " -> /backup/a.txt",
+			"upload " + filepath.Join(localDir, "dir/b.txt") + " -> /backup/dir/b.txt",
+			"upload " + filepath.Join(localDir, "dir/sub/c.txt") + " -> /backup/dir/sub/c.txt",
+		}))
+
+		Expect(readRemote("/backup/dir/sub/c.txt")).To(Equal("c"))
+
+		md, err := client.GetMetadata(context.Background(), &dropboxclient.GetMetadataArg{Path: "/backup/a.txt"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(md.ClientModified.Equal(modTime)).To(BeTrue())
+
+		Expect(sync().Actions).To(BeEmpty())
+	})
+
+	It("should sync with any Client", func() {
+		memory := mockdropbox.NewMemoryClient()
+		uploader.Client = memory
+
+		writeLocal("dir/a.txt", "a")
+		sync()
+
+		md, err := memory.GetMetadata(context.Background(), &dropboxclient.GetMetadataArg{Path: "/backup/dir/a.txt"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(md.Size).To(Equal(int64(1)))
+
+		Expect(sync().Actions).To(BeEmpty())
+	})
+
+	It("should update changed files using the known rev", func() {
+		writeLocal("a.txt", "a")
+		sync()
+
+		writeLocal("a.txt", "changed")
+
+		plan := sync()
+		Expect(plan.Actions).To(HaveLen(1))
+		Expect(plan.Actions[0].Type).To(Equal(ActionUpdate))
+		Expect(plan.Actions[0].Rev).NotTo(BeEmpty())
+
+		Expect(readRemote("/backup/a.txt")).To(Equal("changed"))
+	})
+
+	It("should not commit a file when the local read fails", func() {
+		writeLocal("a.txt", "original")
+		sync()
+
+		writeLocal("a.txt", "changed content")
+
+		readErr := errors.New("read failed")
+		restore := SetOpenLocalFile(func(path string) (io.ReadCloser, error) {
+			return io.NopCloser(io.MultiReader(strings.NewReader("chan"), iotest.ErrReader(readErr))), nil
+		})
+		defer restore()
+
+		_, err := uploader.Sync(context.Background())
+		Expect(errors.Is(err, readErr)).To(BeTrue())
+
+		Expect(readRemote("/backup/a.txt")).To(Equal("original"))
+	})
+
+	It("should skip files with the same content and a different mtime", func() {
+		writeLocal("a.txt", "a")
+		sync()
+
+		p := filepath.Join(localDir, "a.txt")
+		Expect(os.Chtimes(p, modTime.Add(time.Hour), modTime.Add(time.Hour))).To(Succeed())
+
+		Expect(sync().Actions).To(BeEmpty())
+	})
+
+	It("should not clobber concurrent remote edits", func() {
+		writeLocal("a.txt", "a")
+		sync()
+
+		writeLocal("a.txt", "local")
+
+		plan, err := uploader.Plan(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+
+		w := client.NewUploadWriter(context.Background(), &dropboxclient.CommitInfo{
+			Path: "/backup/a.txt",
+			Mode: &dropboxclient.WriteMode{Tag: dropboxclient.WriteModeOverwrite},
+		})
+		_, err = io.WriteString(w, "remote")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(w.Close()).To(Succeed())
+
+		err = uploader.Execute(context.Background(), plan)
+		Expect(err).To(HaveOccurred())
+
+		var actionErr *ActionError
+		Expect(errors.As(err, &actionErr)).To(BeTrue())
+		Expect(actionErr.Action.Type).To(Equal(ActionUpdate))
+		Expect(errors.Is(dropboxclient.FSError(actionErr.Err), fs.ErrExist)).To(BeTrue())
+
+		Expect(readRemote("/backup/a.txt")).To(Equal("remote"))
+	})
+
+	It("should delete files and folders that vanished locally", func() {
+		writeLocal("a.txt", "a")
+		writeLocal("dir/b.txt", "b")
+		writeLocal("dir/sub/c.txt", "c")
+		sync()
+
+		Expect(os.RemoveAll(filepath.Join(localDir, "dir"))).To(Succeed())
+
+		plan := sync()
+		Expect(actionStrings(plan)).To(Equal([]string{"delete /backup/dir"}))
+
+		Expect(remoteExists("/backup/dir")).To(BeFalse())
+		Expect(remoteExists("/backup/a.txt")).To(BeTrue())
+	})
+
+	It("should move renamed files", func() {
+		writeLocal("a.txt", "a")
+		writeLocal("b.txt", "b")
+		sync()
+
+		Expect(os.Rename(filepath.Join(localDir, "a.txt"), filepath.Join(localDir, "renamed.txt"))).To(Succeed())
+
+		plan := sync()
+		Expect(actionStrings(plan)).To(Equal([]string{"move /backup/a.txt -> /backup/renamed.txt"}))
+
+		Expect(remoteExists("/backup/a.txt")).To(BeFalse())
+		Expect(readRemote("/backup/renamed.txt")).To(Equal("a"))
+	})
+
+	It("should replace a file with a folder", func() {
+		writeLocal("x", "file")
+		sync()
+
+		Expect(os.Remove(filepath.Join(localDir, "x"))).To(Succeed())
+		writeLocal("x/y.txt", "y")
+
+		plan := sync()
+		Expect(actionStrings(plan)).To(Equal([]string{
+			"delete /backup/x",
+			"create_folder /backup/x",
+			"upload " + filepath.Join(localDir, "x/y.txt") + " -> /backup/x/y.txt",
+		}))
+
+		Expect(readRemote("/backup/x/y.txt")).To(Equal("y"))
+	})
+
+	It("should print the plan in dry-run mode", func() {
+		writeLocal("a.txt", "a")
+
+		var out bytes.Buffer
+		uploader.DryRun = true
+		uploader.Output = &out
+
+		plan := sync()
+		Expect(plan.Actions).To(HaveLen(2))
+		Expect(out.String()).To(Equal("create_folder /backup\nupload " + filepath.Join(localDir, "a.txt") + " -> /backup/a.txt\n"))
+
+		Expect(remoteExists("/backup")).To(BeFalse())
+	})
+})
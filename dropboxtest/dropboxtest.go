@@ -0,0 +1,56 @@
+// Package dropboxtest provides Dropbox clients backed by an in-process
+// mockdropbox for tests.
+package dropboxtest
+
+import (
+	"net/http"
+
+	"github.com/koofr/go-dropboxclient"
+	"github.com/koofr/go-dropboxclient/mockdropbox"
+)
+
+// BaseURL is the base URL of clients created by NewClient. Requests never
+// leave the process.
+const BaseURL = "http://mockdropbox.test"
+
+// AccessToken is the access token of clients created by NewClient.
+const AccessToken = "mock"
+
+// TB is the part of testing.TB used by this package. It is also
+// implemented by GinkgoT().
+type TB interface {
+	Helper()
+	Fatalf(format string, args ...interface{})
+	Cleanup(f func())
+}
+
+// NewClient returns a client wired to a fresh mock. Options are applied
+// after the defaults, so e.g. WithAccessToken selects a different mock
+// store. The mock is cleaned up when the test ends.
+func NewClient(t TB, opts ...dropboxclient.Option) *dropboxclient.Dropbox {
+	client, _ := NewClientWithMock(t, opts...)
+	return client
+}
+
+// NewClientWithMock is like NewClient but also returns the mock, e.g. to
+// inject faults or register webhooks.
+func NewClientWithMock(t TB, opts ...dropboxclient.Option) (*dropboxclient.Dropbox, *mockdropbox.MockDropbox) {
+	t.Helper()
+
+	mock := mockdropbox.New()
+
+	opts = append([]dropboxclient.Option{
+		dropboxclient.WithAccessToken(AccessToken),
+		dropboxclient.WithBaseURL(BaseURL),
+		dropboxclient.WithHTTPClient(&http.Client{Transport: mock.Transport()}),
+	}, opts...)
+
+	client, err := dropboxclient.New(opts...)
+	if err != nil {
+		t.Fatalf("dropboxtest: %s", err)
+	}
+
+	t.Cleanup(mock.UnregisterWebhook)
+
+	return client, mock
+}
@@ -0,0 +1,13 @@
+package dropboxtest_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestDropboxtest(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Dropboxtest Suite")
+}
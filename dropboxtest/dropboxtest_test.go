@@ -0,0 +1,106 @@
+package dropboxtest_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"time"
+
+	"github.com/koofr/go-dropboxclient"
+	. "github.com/koofr/go-dropboxclient/dropboxtest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("NewClient", func() {
+	upload := func(client dropboxclient.Client, path string, data []byte) {
+		w := dropboxclient.NewUploadWriter(context.Background(), client, &dropboxclient.CommitInfo{
+			Path: path,
+			Mode: &dropboxclient.WriteMode{Tag: dropboxclient.WriteModeAdd},
+		})
+		_, err := w.Write(data)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(w.Close()).To(Succeed())
+	}
+
+	It("should serve requests in process", func() {
+		client := NewClient(GinkgoT())
+
+		_, err := client.CreateFolder(context.Background(), &dropboxclient.CreateFolderArg{Path: "/dir"})
+		Expect(err).NotTo(HaveOccurred())
+
+		upload(client, "/dir/file.txt", []byte("hello"))
+
+		reader, md, err := client.Download(context.Background(), &dropboxclient.DownloadArg{Path: "/dir/file.txt"}, nil)
+		Expect(err).NotTo(HaveOccurred())
+		defer reader.Close()
+
+		Expect(md.Size).To(Equal(int64(5)))
+
+		data, err := io.ReadAll(reader)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(data)).To(Equal("hello"))
+
+		_, err = client.GetMetadata(context.Background(), &dropboxclient.GetMetadataArg{Path: "/missing"})
+		dropboxErr, ok := dropboxclient.IsDropboxError(err)
+		Expect(ok).To(BeTrue())
+		Expect(dropboxErr.Err.Path.Tag).To(Equal("not_found"))
+	})
+
+	It("should give every client a fresh mock", func() {
+		client1 := NewClient(GinkgoT())
+		client2 := NewClient(GinkgoT())
+
+		_, err := client1.CreateFolder(context.Background(), &dropboxclient.CreateFolderArg{Path: "/dir"})
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = client2.CreateFolder(context.Background(), &dropboxclient.CreateFolderArg{Path: "/dir"})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("should end cut downloads with an unexpected EOF", func() {
+		client, mock := NewClientWithMock(GinkgoT())
+
+		data := bytes.Repeat([]byte("x"), 1000)
+		upload(client, "/file.bin", data)
+
+		mock.CutDownloadsAfter(100)
+
+		reader, _, err := client.Download(context.Background(), &dropboxclient.DownloadArg{Path: "/file.bin"}, nil)
+		Expect(err).NotTo(HaveOccurred())
+		defer reader.Close()
+
+		read, err := io.ReadAll(reader)
+		Expect(err).To(Equal(io.ErrUnexpectedEOF))
+		Expect(read).To(HaveLen(100))
+
+		resumable, _, err := client.DownloadResumable(context.Background(), &dropboxclient.DownloadArg{Path: "/file.bin"}, nil, &dropboxclient.ResumableDownloadOptions{
+			MaxRetries: 20,
+			RetryDelay: time.Millisecond,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		defer resumable.Close()
+
+		read, err = io.ReadAll(resumable)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(read).To(Equal(data))
+	})
+
+	It("should stop reading when the context is canceled", func() {
+		client := NewClient(GinkgoT())
+
+		upload(client, "/file.bin", bytes.Repeat([]byte("x"), 1000))
+
+		ctx, cancel := context.WithCancel(context.Background())
+
+		reader, _, err := client.Download(ctx, &dropboxclient.DownloadArg{Path: "/file.bin"}, nil)
+		Expect(err).NotTo(HaveOccurred())
+		defer reader.Close()
+
+		cancel()
+
+		_, err = io.ReadAll(reader)
+		Expect(err).To(MatchError(context.Canceled))
+	})
+})
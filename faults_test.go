@@ -0,0 +1,197 @@
+package dropboxclient_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/koofr/go-dropboxclient"
+	"github.com/koofr/go-dropboxclient/mockdropbox"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("MockDropbox faults", func() {
+	var mock *mockdropbox.MockDropbox
+	var client *Dropbox
+	var stop func()
+
+	BeforeEach(func() {
+		client, mock, stop = startMockClient()
+	})
+
+	AfterEach(func() {
+		stop()
+	})
+
+	getMetadata := func() error {
+		_, err := client.GetMetadata(context.Background(), &GetMetadataArg{Path: "/file.txt"})
+		return err
+	}
+
+	It("should fail writes with too_many_write_operations", func() {
+		mock.SetFaults(1, &mockdropbox.FaultRule{
+			Route:      "files/create_folder",
+			Fault:      mockdropbox.FaultTooManyWriteOperations,
+			Times:      1,
+			RetryAfter: 3,
+		})
+
+		_, err := client.CreateFolder(context.Background(), &CreateFolderArg{Path: "/dir"})
+		Expect(err).To(HaveOccurred())
+
+		dropboxErr, ok := IsDropboxError(err)
+		Expect(ok).To(BeTrue())
+		Expect(dropboxErr.HttpClientError.Got).To(Equal(http.StatusTooManyRequests))
+		Expect(dropboxErr.HttpClientError.Headers.Get("Retry-After")).To(Equal("3"))
+		Expect(dropboxErr.Err.Reason.Tag).To(Equal("too_many_write_operations"))
+		Expect(dropboxErr.Err.RetryAfter).To(Equal(3))
+
+		_, err = client.CreateFolder(context.Background(), &CreateFolderArg{Path: "/dir"})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(mock.Faults()[0].Fired).To(Equal(1))
+	})
+
+	It("should skip requests and only match the route", func() {
+		uploadFile(client, "/file.txt", []byte("hello"))
+
+		mock.SetFaults(1, &mockdropbox.FaultRule{
+			Route: "files/get_metadata",
+			Fault: mockdropbox.FaultServiceUnavailable,
+			Skip:  1,
+		})
+
+		Expect(getMetadata()).To(Succeed())
+		err := getMetadata()
+		Expect(err).To(HaveOccurred())
+		dropboxErr, _ := IsDropboxError(err)
+		Expect(dropboxErr.HttpClientError.Got).To(Equal(http.StatusServiceUnavailable))
+		Expect(dropboxErr.HttpClientError.Headers.Get("Retry-After")).To(Equal("1"))
+
+		_, err = client.ListFolder(context.Background(), &ListFolderArg{Path: ""})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("should fail the same requests with the same seed", func() {
+		uploadFile(client, "/file.txt", []byte("hello"))
+
+		failures := func(seed int64) []bool {
+			mock.SetFaults(seed, &mockdropbox.FaultRule{
+				Fault:       mockdropbox.FaultInternalServerError,
+				Probability: 0.5,
+			})
+			failed := []bool{}
+			for i := 0; i < 20; i++ {
+				failed = append(failed, getMetadata() != nil)
+			}
+			return failed
+		}
+
+		first := failures(42)
+		Expect(first).To(ContainElement(true))
+		Expect(first).To(ContainElement(false))
+		Expect(failures(42)).To(Equal(first))
+	})
+
+	It("should drop the connection in the middle of a download", func() {
+		uploadFile(client, "/file.txt", bytes.Repeat([]byte("x"), 1000))
+
+		mock.SetFaults(1, &mockdropbox.FaultRule{
+			Route:      "files/download",
+			Fault:      mockdropbox.FaultReset,
+			ResetAfter: 100,
+		})
+
+		reader, _, err := client.Download(context.Background(), &DownloadArg{Path: "/file.txt"}, nil)
+		Expect(err).NotTo(HaveOccurred())
+		defer reader.Close()
+
+		data, err := io.ReadAll(reader)
+		Expect(err).To(HaveOccurred())
+		Expect(data).To(HaveLen(100))
+	})
+
+	It("should add latency", func() {
+		uploadFile(client, "/file.txt", []byte("hello"))
+
+		mock.SetFaults(1, &mockdropbox.FaultRule{
+			Fault:   mockdropbox.FaultLatency,
+			Latency: 50 * time.Millisecond,
+		})
+
+		start := time.Now()
+		Expect(getMetadata()).To(Succeed())
+		Expect(time.Since(start)).To(BeNumerically(">=", 50*time.Millisecond))
+	})
+
+	It("should parse fault rules", func() {
+		rule, err := mockdropbox.ParseFaultRule("route=files/download,fault=latency,latency=250ms,probability=0.5,times=2")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(rule).To(Equal(&mockdropbox.FaultRule{
+			Route:       "files/download",
+			Fault:       mockdropbox.FaultLatency,
+			Latency:     250 * time.Millisecond,
+			Probability: 0.5,
+			Times:       2,
+		}))
+
+		_, err = mockdropbox.ParseFaultRule("fault=explode")
+		Expect(err).To(HaveOccurred())
+		_, err = mockdropbox.ParseFaultRule("fault=reset,times=many")
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should be configured with the control endpoint", func() {
+		server := httptest.NewServer(mock)
+		defer server.Close()
+
+		req, err := http.NewRequest("PUT", server.URL+"/_mock/faults", bytes.NewReader([]byte(
+			`{"seed": 7, "rules": [{"route": "files/get_metadata", "fault": "too_many_requests", "times": 1}]}`,
+		)))
+		Expect(err).NotTo(HaveOccurred())
+		res, err := http.DefaultClient.Do(req)
+		Expect(err).NotTo(HaveOccurred())
+		res.Body.Close()
+		Expect(res.StatusCode).To(Equal(http.StatusNoContent))
+
+		err = getMetadata()
+		dropboxErr, ok := IsDropboxError(err)
+		Expect(ok).To(BeTrue())
+		Expect(dropboxErr.HttpClientError.Got).To(Equal(http.StatusTooManyRequests))
+		Expect(dropboxErr.Err.Reason.Tag).To(Equal("too_many_requests"))
+
+		res, err = http.Get(server.URL + "/_mock/faults")
+		Expect(err).NotTo(HaveOccurred())
+		defer res.Body.Close()
+
+		config := struct {
+			Seed  int64                    `json:"seed"`
+			Rules []*mockdropbox.FaultRule `json:"rules"`
+		}{}
+		Expect(json.NewDecoder(res.Body).Decode(&config)).To(Succeed())
+		Expect(config.Seed).To(Equal(int64(7)))
+		Expect(config.Rules).To(HaveLen(1))
+		Expect(config.Rules[0].Fired).To(Equal(1))
+
+		req, err = http.NewRequest("DELETE", server.URL+"/_mock/faults", nil)
+		Expect(err).NotTo(HaveOccurred())
+		res, err = http.DefaultClient.Do(req)
+		Expect(err).NotTo(HaveOccurred())
+		res.Body.Close()
+		Expect(mock.Faults()).To(BeEmpty())
+
+		req, err = http.NewRequest("PATCH", server.URL+"/_mock/faults", nil)
+		Expect(err).NotTo(HaveOccurred())
+		res, err = http.DefaultClient.Do(req)
+		Expect(err).NotTo(HaveOccurred())
+		res.Body.Close()
+		Expect(res.StatusCode).To(Equal(http.StatusMethodNotAllowed))
+		Expect(res.Header.Get("Allow")).To(Equal("GET, PUT, POST, DELETE"))
+	})
+})
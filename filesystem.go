@@ -0,0 +1,162 @@
+package dropboxclient
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+)
+
+// FileSystem is a writable file system backed by a Dropbox folder. Read
+// operations are provided by the embedded FS, whose cache is invalidated by
+// every write.
+type FileSystem struct {
+	*FS
+}
+
+func NewFileSystem(ctx context.Context, client Client, root string, opts *FSOptions) *FileSystem {
+	return &FileSystem{
+		FS: NewFS(ctx, client, root, opts),
+	}
+}
+
+type fileSystemWriter struct {
+	*UploadWriter
+	fsys *FileSystem
+	name string
+}
+
+func (w *fileSystemWriter) Close() error {
+	err := w.UploadWriter.Close()
+
+	w.fsys.InvalidateCache(w.name)
+
+	if err != nil {
+		return w.fsys.pathError("write", w.name, err)
+	}
+
+	return nil
+}
+
+// Create returns a writer that streams into an upload session. The file is
+// committed, overwriting any existing file, when the writer is closed.
+func (fsys *FileSystem) Create(name string) (io.WriteCloser, error) {
+	if !fs.ValidPath(name) || name == "." {
+		return nil, &fs.PathError{Op: "create", Path: name, Err: fs.ErrInvalid}
+	}
+
+	w := NewUploadWriter(fsys.ctx, fsys.client, &CommitInfo{
+		Path: fsys.path(name),
+		Mode: &WriteMode{
+			Tag: WriteModeOverwrite,
+		},
+	})
+	if fsys.opts.UploadChunkSize > 0 {
+		w.ChunkSize = fsys.opts.UploadChunkSize
+	}
+
+	return &fileSystemWriter{
+		UploadWriter: w,
+		fsys:         fsys,
+		name:         name,
+	}, nil
+}
+
+// MkdirAll creates the folder name along with any missing parents. perm is
+// ignored and exists for compatibility with os.MkdirAll.
+func (fsys *FileSystem) MkdirAll(name string, perm fs.FileMode) error {
+	if !fs.ValidPath(name) {
+		return &fs.PathError{Op: "mkdir", Path: name, Err: fs.ErrInvalid}
+	}
+
+	if name == "." {
+		return nil
+	}
+
+	parts := strings.Split(name, "/")
+
+	for i := range parts {
+		dir := strings.Join(parts[:i+1], "/")
+
+		info, err := fsys.Stat(dir)
+		if err == nil {
+			if !info.IsDir() {
+				return &fs.PathError{Op: "mkdir", Path: dir, Err: ErrNotDir}
+			}
+			continue
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+
+		_, err = fsys.client.CreateFolder(fsys.ctx, &CreateFolderArg{Path: fsys.path(dir)})
+
+		fsys.InvalidateCache(dir)
+
+		if err != nil {
+			if errors.Is(FSError(err), fs.ErrExist) {
+				// created concurrently
+				continue
+			}
+			return fsys.pathError("mkdir", dir, err)
+		}
+	}
+
+	return nil
+}
+
+// Rename moves oldname to newname. It fails with fs.ErrExist if newname
+// already exists.
+func (fsys *FileSystem) Rename(oldname string, newname string) error {
+	if !fs.ValidPath(oldname) || oldname == "." {
+		return &fs.PathError{Op: "rename", Path: oldname, Err: fs.ErrInvalid}
+	}
+	if !fs.ValidPath(newname) || newname == "." {
+		return &fs.PathError{Op: "rename", Path: newname, Err: fs.ErrInvalid}
+	}
+
+	_, err := fsys.client.Move(fsys.ctx, &RelocationArg{
+		FromPath: fsys.path(oldname),
+		ToPath:   fsys.path(newname),
+	})
+
+	fsys.InvalidateCache(oldname)
+	fsys.InvalidateCache(newname)
+
+	if err != nil {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: FSError(err)}
+	}
+
+	return nil
+}
+
+// Remove removes the file or folder name, including its contents.
+func (fsys *FileSystem) Remove(name string) error {
+	if !fs.ValidPath(name) || name == "." {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrInvalid}
+	}
+
+	_, err := fsys.client.Delete(fsys.ctx, &DeleteArg{Path: fsys.path(name)})
+
+	fsys.InvalidateCache(name)
+
+	if err != nil {
+		return fsys.pathError("remove", name, err)
+	}
+
+	return nil
+}
+
+// RemoveAll removes name and everything it contains. It returns nil if name
+// does not exist.
+func (fsys *FileSystem) RemoveAll(name string) error {
+	err := fsys.Remove(name)
+
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+
+	return err
+}
@@ -0,0 +1,133 @@
+package dropboxclient_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math/rand"
+
+	. "github.com/koofr/go-dropboxclient"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("FileSystem", func() {
+	var client *Dropbox
+	var stop func()
+	var fsys *FileSystem
+
+	BeforeEach(func() {
+		client, _, stop = startMockClient()
+
+		root := fmt.Sprintf("/filesystem-%d", rand.Int())
+		_, err := client.CreateFolder(context.Background(), &CreateFolderArg{Path: root})
+		Expect(err).NotTo(HaveOccurred())
+
+		fsys = NewFileSystem(context.Background(), client, root, &FSOptions{
+			UploadChunkSize: 4,
+		})
+	})
+
+	AfterEach(func() {
+		stop()
+	})
+
+	create := func(name string, data []byte) {
+		w, err := fsys.Create(name)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = io.Copy(w, bytes.NewReader(data))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(w.Close()).To(Succeed())
+	}
+
+	Describe("Create", func() {
+		It("should stream a file into an upload session", func() {
+			create("file.txt", []byte("hello world"))
+
+			data, err := fs.ReadFile(fsys, "file.txt")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(data)).To(Equal("hello world"))
+		})
+
+		It("should create an empty file", func() {
+			create("empty.txt", nil)
+
+			info, err := fsys.Stat("empty.txt")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(info.Size()).To(Equal(int64(0)))
+		})
+
+		It("should overwrite an existing file", func() {
+			create("file.txt", []byte("hello world"))
+			create("file.txt", []byte("bye"))
+
+			data, err := fs.ReadFile(fsys, "file.txt")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(data)).To(Equal("bye"))
+		})
+	})
+
+	Describe("MkdirAll", func() {
+		It("should create nested folders", func() {
+			Expect(fsys.MkdirAll("a/b/c", 0755)).To(Succeed())
+			Expect(fsys.MkdirAll("a/b/d", 0755)).To(Succeed())
+
+			info, err := fsys.Stat("a/b/c")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(info.IsDir()).To(BeTrue())
+
+			entries, err := fs.ReadDir(fsys, "a/b")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(entries).To(HaveLen(2))
+		})
+
+		It("should fail if a parent is a file", func() {
+			create("file.txt", []byte("x"))
+
+			err := fsys.MkdirAll("file.txt/a", 0755)
+			Expect(errors.Is(err, ErrNotDir)).To(BeTrue())
+		})
+	})
+
+	Describe("Rename", func() {
+		It("should rename a file", func() {
+			create("file.txt", []byte("x"))
+
+			Expect(fsys.Rename("file.txt", "renamed.txt")).To(Succeed())
+
+			_, err := fsys.Stat("file.txt")
+			Expect(errors.Is(err, fs.ErrNotExist)).To(BeTrue())
+
+			_, err = fsys.Stat("renamed.txt")
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("should fail if the source does not exist", func() {
+			err := fsys.Rename("missing", "renamed.txt")
+			Expect(errors.Is(err, fs.ErrNotExist)).To(BeTrue())
+		})
+	})
+
+	Describe("Remove", func() {
+		It("should remove a folder with contents", func() {
+			Expect(fsys.MkdirAll("a/b", 0755)).To(Succeed())
+			create("a/b/file.txt", []byte("x"))
+
+			Expect(fsys.RemoveAll("a")).To(Succeed())
+
+			_, err := fsys.Stat("a")
+			Expect(errors.Is(err, fs.ErrNotExist)).To(BeTrue())
+		})
+
+		It("should map missing files", func() {
+			err := fsys.Remove("missing")
+			Expect(errors.Is(err, fs.ErrNotExist)).To(BeTrue())
+
+			Expect(fsys.RemoveAll("missing")).To(Succeed())
+		})
+	})
+})
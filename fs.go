@@ -0,0 +1,538 @@
+package dropboxclient
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	gopath "path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/koofr/go-ioutils"
+)
+
+var ErrNotDir = errors.New("not a directory")
+var ErrIsDir = errors.New("is a directory")
+
+// FSError maps a Dropbox API error to the matching io/fs error
+// (fs.ErrNotExist, fs.ErrExist, ErrNotDir, ErrIsDir). Other errors are
+// returned unchanged.
+func FSError(err error) error {
+	dropboxErr, ok := IsDropboxError(err)
+	if !ok {
+		return err
+	}
+
+	var lookup *LookupError
+	switch {
+	case dropboxErr.Err.Path != nil:
+		lookup = dropboxErr.Err.Path
+	case dropboxErr.Err.PathLookup != nil:
+		lookup = dropboxErr.Err.PathLookup
+	case dropboxErr.Err.FromLookup != nil:
+		lookup = dropboxErr.Err.FromLookup
+	case dropboxErr.Err.To != nil:
+		lookup = dropboxErr.Err.To
+	case dropboxErr.Err.Tag == "unsupported_file":
+		return ErrIsDir
+	default:
+		return err
+	}
+
+	switch lookup.Tag {
+	case "not_found":
+		return fs.ErrNotExist
+	case "conflict":
+		return fs.ErrExist
+	case "not_folder":
+		return ErrNotDir
+	case "not_file":
+		return ErrIsDir
+	}
+
+	return err
+}
+
+type FSOptions struct {
+	// CacheTTL enables caching of metadata and folder listings for the given
+	// duration. Zero disables caching.
+	CacheTTL time.Duration
+	// UploadChunkSize is the upload session chunk size used by
+	// FileSystem.Create. Defaults to DefaultUploadChunkSize.
+	UploadChunkSize int
+}
+
+// FS is a read-only fs.FS backed by a Dropbox folder. It implements
+// fs.ReadDirFS, fs.StatFS and fs.ReadFileFS.
+type FS struct {
+	client Client
+	ctx    context.Context
+	root   string
+	opts   FSOptions
+
+	mdCache  map[string]*fsCachedMetadata
+	dirCache map[string]*fsCachedDir
+	mutex    sync.Mutex
+}
+
+var _ fs.ReadDirFS = (*FS)(nil)
+var _ fs.StatFS = (*FS)(nil)
+var _ fs.ReadFileFS = (*FS)(nil)
+
+type fsCachedMetadata struct {
+	md      *Metadata
+	expires time.Time
+}
+
+type fsCachedDir struct {
+	entries []*Metadata
+	expires time.Time
+}
+
+// NewFS returns a file system rooted at the Dropbox folder root ("" for the
+// Dropbox root). All requests are made with ctx.
+func NewFS(ctx context.Context, client Client, root string, opts *FSOptions) *FS {
+	fsys := &FS{
+		client:   client,
+		ctx:      ctx,
+		root:     dropboxFSPath(root, "."),
+		mdCache:  map[string]*fsCachedMetadata{},
+		dirCache: map[string]*fsCachedDir{},
+	}
+
+	if opts != nil {
+		fsys.opts = *opts
+	}
+
+	return fsys
+}
+
+func dropboxFSPath(root string, name string) string {
+	p := gopath.Join("/", root, name)
+	if p == "/" {
+		return ""
+	}
+	return p
+}
+
+func (fsys *FS) path(name string) string {
+	return dropboxFSPath(fsys.root, name)
+}
+
+func (fsys *FS) pathError(op string, name string, err error) error {
+	return &fs.PathError{Op: op, Path: name, Err: FSError(err)}
+}
+
+func (fsys *FS) cacheKey(p string) string {
+	return strings.ToLower(p)
+}
+
+func (fsys *FS) getCachedMetadata(p string) (md *Metadata, ok bool) {
+	if fsys.opts.CacheTTL <= 0 {
+		return nil, false
+	}
+
+	fsys.mutex.Lock()
+	defer fsys.mutex.Unlock()
+
+	cached, ok := fsys.mdCache[fsys.cacheKey(p)]
+	if !ok || time.Now().After(cached.expires) {
+		return nil, false
+	}
+
+	return cached.md, true
+}
+
+func (fsys *FS) setCachedMetadata(p string, md *Metadata) {
+	if fsys.opts.CacheTTL <= 0 {
+		return
+	}
+
+	fsys.mutex.Lock()
+	defer fsys.mutex.Unlock()
+
+	fsys.mdCache[fsys.cacheKey(p)] = &fsCachedMetadata{
+		md:      md,
+		expires: time.Now().Add(fsys.opts.CacheTTL),
+	}
+}
+
+func (fsys *FS) getCachedDir(p string) (entries []*Metadata, ok bool) {
+	if fsys.opts.CacheTTL <= 0 {
+		return nil, false
+	}
+
+	fsys.mutex.Lock()
+	defer fsys.mutex.Unlock()
+
+	cached, ok := fsys.dirCache[fsys.cacheKey(p)]
+	if !ok || time.Now().After(cached.expires) {
+		return nil, false
+	}
+
+	return cached.entries, true
+}
+
+func (fsys *FS) setCachedDir(p string, entries []*Metadata) {
+	if fsys.opts.CacheTTL <= 0 {
+		return
+	}
+
+	fsys.mutex.Lock()
+	defer fsys.mutex.Unlock()
+
+	expires := time.Now().Add(fsys.opts.CacheTTL)
+
+	fsys.dirCache[fsys.cacheKey(p)] = &fsCachedDir{
+		entries: entries,
+		expires: expires,
+	}
+
+	for _, md := range entries {
+		fsys.mdCache[fsys.cacheKey(gopath.Join(p, md.Name))] = &fsCachedMetadata{
+			md:      md,
+			expires: expires,
+		}
+	}
+}
+
+// InvalidateCache drops cached metadata for name, everything below it and
+// the listing of its parent folder.
+func (fsys *FS) InvalidateCache(name string) {
+	fsys.mutex.Lock()
+	defer fsys.mutex.Unlock()
+
+	key := fsys.cacheKey(fsys.path(name))
+	parentKey := fsys.cacheKey(gopath.Dir(key))
+	if parentKey == "/" {
+		parentKey = ""
+	}
+
+	delete(fsys.dirCache, parentKey)
+
+	for k := range fsys.mdCache {
+		if k == key || strings.HasPrefix(k, key+"/") {
+			delete(fsys.mdCache, k)
+		}
+	}
+	for k := range fsys.dirCache {
+		if k == key || strings.HasPrefix(k, key+"/") {
+			delete(fsys.dirCache, k)
+		}
+	}
+}
+
+func (fsys *FS) stat(name string) (md *Metadata, err error) {
+	p := fsys.path(name)
+
+	if p == "" {
+		return &Metadata{Tag: MetadataFolder}, nil
+	}
+
+	if md, ok := fsys.getCachedMetadata(p); ok {
+		return md, nil
+	}
+
+	md, err = fsys.client.GetMetadata(fsys.ctx, &GetMetadataArg{Path: p})
+	if err != nil {
+		return nil, err
+	}
+
+	fsys.setCachedMetadata(p, md)
+
+	return md, nil
+}
+
+func (fsys *FS) Stat(name string) (fs.FileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrInvalid}
+	}
+
+	md, err := fsys.stat(name)
+	if err != nil {
+		return nil, fsys.pathError("stat", name, err)
+	}
+
+	return newFileInfo(name, md), nil
+}
+
+func (fsys *FS) listFolder(name string) (entries []*Metadata, err error) {
+	p := fsys.path(name)
+
+	if entries, ok := fsys.getCachedDir(p); ok {
+		return entries, nil
+	}
+
+	entries, err = listFolderAll(fsys.ctx, fsys.client, p)
+	if err != nil {
+		return nil, err
+	}
+
+	fsys.setCachedDir(p, entries)
+
+	return entries, nil
+}
+
+func (fsys *FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+
+	entries, err := fsys.listFolder(name)
+	if err != nil {
+		return nil, fsys.pathError("readdir", name, err)
+	}
+
+	dirEntries := make([]fs.DirEntry, len(entries))
+	for i, md := range entries {
+		dirEntries[i] = newFileInfo(md.Name, md)
+	}
+
+	return dirEntries, nil
+}
+
+func (fsys *FS) ReadFile(name string) ([]byte, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: fs.ErrInvalid}
+	}
+
+	reader, _, err := fsys.client.Download(fsys.ctx, &DownloadArg{Path: fsys.path(name)}, nil)
+	if err != nil {
+		return nil, fsys.pathError("read", name, err)
+	}
+	defer reader.Close()
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fsys.pathError("read", name, err)
+	}
+
+	return data, nil
+}
+
+func (fsys *FS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+
+	md, err := fsys.stat(name)
+	if err != nil {
+		return nil, fsys.pathError("open", name, err)
+	}
+
+	info := newFileInfo(name, md)
+
+	if info.IsDir() {
+		return &fsDir{fsys: fsys, name: name, info: info}, nil
+	}
+
+	return &fsFile{fsys: fsys, name: name, info: info}, nil
+}
+
+// fileInfo implements both fs.FileInfo and fs.DirEntry for a Metadata.
+type fileInfo struct {
+	name string
+	md   *Metadata
+}
+
+func newFileInfo(name string, md *Metadata) *fileInfo {
+	return &fileInfo{
+		name: gopath.Base(name),
+		md:   md,
+	}
+}
+
+func (i *fileInfo) Name() string {
+	return i.name
+}
+
+func (i *fileInfo) Size() int64 {
+	if i.IsDir() {
+		return 0
+	}
+	return i.md.Size
+}
+
+func (i *fileInfo) Mode() fs.FileMode {
+	if i.IsDir() {
+		return fs.ModeDir | 0555
+	}
+	return 0444
+}
+
+func (i *fileInfo) ModTime() time.Time {
+	return i.md.ClientModified
+}
+
+func (i *fileInfo) IsDir() bool {
+	return i.md.Tag == MetadataFolder
+}
+
+// Sys returns the underlying *Metadata.
+func (i *fileInfo) Sys() interface{} {
+	return i.md
+}
+
+func (i *fileInfo) Type() fs.FileMode {
+	return i.Mode().Type()
+}
+
+func (i *fileInfo) Info() (fs.FileInfo, error) {
+	return i, nil
+}
+
+func (i *fileInfo) String() string {
+	return fs.FormatFileInfo(i)
+}
+
+type fsFile struct {
+	fsys   *FS
+	name   string
+	info   *fileInfo
+	offset int64
+	body   io.ReadCloser
+	closed bool
+}
+
+func (f *fsFile) Stat() (fs.FileInfo, error) {
+	return f.info, nil
+}
+
+func (f *fsFile) Read(p []byte) (n int, err error) {
+	if f.closed {
+		return 0, &fs.PathError{Op: "read", Path: f.name, Err: fs.ErrClosed}
+	}
+
+	size := f.info.Size()
+
+	if f.offset >= size {
+		return 0, io.EOF
+	}
+
+	if f.body == nil {
+		var span *ioutils.FileSpan
+		if f.offset > 0 {
+			span = &ioutils.FileSpan{Start: f.offset, End: size - 1}
+		}
+
+		f.body, _, err = f.fsys.client.Download(f.fsys.ctx, &DownloadArg{Path: f.fsys.path(f.name)}, span)
+		if err != nil {
+			return 0, f.fsys.pathError("read", f.name, err)
+		}
+	}
+
+	n, err = f.body.Read(p)
+	f.offset += int64(n)
+
+	if err == io.EOF && f.offset < size {
+		err = io.ErrUnexpectedEOF
+	}
+
+	return n, err
+}
+
+func (f *fsFile) Seek(offset int64, whence int) (int64, error) {
+	if f.closed {
+		return 0, &fs.PathError{Op: "seek", Path: f.name, Err: fs.ErrClosed}
+	}
+
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		offset += f.info.Size()
+	default:
+		return 0, &fs.PathError{Op: "seek", Path: f.name, Err: fs.ErrInvalid}
+	}
+
+	if offset < 0 {
+		return 0, &fs.PathError{Op: "seek", Path: f.name, Err: fs.ErrInvalid}
+	}
+
+	if offset != f.offset && f.body != nil {
+		f.body.Close()
+		f.body = nil
+	}
+
+	f.offset = offset
+
+	return offset, nil
+}
+
+func (f *fsFile) Close() error {
+	if f.closed {
+		return &fs.PathError{Op: "close", Path: f.name, Err: fs.ErrClosed}
+	}
+
+	f.closed = true
+
+	if f.body != nil {
+		return f.body.Close()
+	}
+
+	return nil
+}
+
+type fsDir struct {
+	fsys    *FS
+	name    string
+	info    *fileInfo
+	entries []fs.DirEntry
+	loaded  bool
+	closed  bool
+}
+
+func (d *fsDir) Stat() (fs.FileInfo, error) {
+	return d.info, nil
+}
+
+func (d *fsDir) Read(p []byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.name, Err: ErrIsDir}
+}
+
+func (d *fsDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if d.closed {
+		return nil, &fs.PathError{Op: "readdir", Path: d.name, Err: fs.ErrClosed}
+	}
+
+	if !d.loaded {
+		entries, err := d.fsys.ReadDir(d.name)
+		if err != nil {
+			return nil, err
+		}
+		d.entries = entries
+		d.loaded = true
+	}
+
+	if n <= 0 {
+		entries := d.entries
+		d.entries = nil
+		return entries, nil
+	}
+
+	if len(d.entries) == 0 {
+		return nil, io.EOF
+	}
+
+	if n > len(d.entries) {
+		n = len(d.entries)
+	}
+
+	entries := d.entries[:n]
+	d.entries = d.entries[n:]
+
+	return entries, nil
+}
+
+func (d *fsDir) Close() error {
+	if d.closed {
+		return &fs.PathError{Op: "close", Path: d.name, Err: fs.ErrClosed}
+	}
+
+	d.closed = true
+
+	return nil
+}
@@ -0,0 +1,133 @@
+package dropboxclient_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"testing/fstest"
+	"time"
+
+	. "github.com/koofr/go-dropboxclient"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("FS", func() {
+	var client *Dropbox
+	var stop func()
+	var root string
+
+	BeforeEach(func() {
+		client, _, stop = startMockClient()
+
+		root = fmt.Sprintf("/fs-%d", rand.Int())
+
+		for _, p := range []string{root, root + "/dir", root + "/dir/sub", root + "/empty"} {
+			_, err := client.CreateFolder(context.Background(), &CreateFolderArg{Path: p})
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		uploadFile(client, root+"/a.txt", []byte("hello world"))
+		uploadFile(client, root+"/dir/b.txt", []byte("b"))
+		uploadFile(client, root+"/dir/sub/c.txt", []byte{})
+	})
+
+	AfterEach(func() {
+		stop()
+	})
+
+	It("should pass fstest", func() {
+		fsys := NewFS(context.Background(), client, root, nil)
+
+		Expect(fstest.TestFS(fsys, "a.txt", "dir/b.txt", "dir/sub/c.txt", "empty")).To(Succeed())
+	})
+
+	It("should pass fstest with caching", func() {
+		fsys := NewFS(context.Background(), client, root, &FSOptions{CacheTTL: time.Minute})
+
+		Expect(fstest.TestFS(fsys, "a.txt", "dir/b.txt", "dir/sub/c.txt", "empty")).To(Succeed())
+	})
+
+	It("should map metadata to file info", func() {
+		fsys := NewFS(context.Background(), client, root, nil)
+
+		info, err := fs.Stat(fsys, "a.txt")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.Name()).To(Equal("a.txt"))
+		Expect(info.Size()).To(Equal(int64(11)))
+		Expect(info.IsDir()).To(BeFalse())
+		Expect(info.Sys().(*Metadata).PathLower).To(Equal(root + "/a.txt"))
+
+		info, err = fs.Stat(fsys, "dir")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.IsDir()).To(BeTrue())
+	})
+
+	It("should read files and directories", func() {
+		fsys := NewFS(context.Background(), client, root, nil)
+
+		data, err := fs.ReadFile(fsys, "a.txt")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(data)).To(Equal("hello world"))
+
+		entries, err := fs.ReadDir(fsys, "dir")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(entries).To(HaveLen(2))
+		Expect(entries[0].Name()).To(Equal("b.txt"))
+		Expect(entries[1].Name()).To(Equal("sub"))
+		Expect(entries[1].IsDir()).To(BeTrue())
+	})
+
+	It("should map errors", func() {
+		fsys := NewFS(context.Background(), client, root, nil)
+
+		_, err := fs.Stat(fsys, "missing")
+		Expect(errors.Is(err, fs.ErrNotExist)).To(BeTrue())
+
+		_, err = fs.ReadFile(fsys, "missing")
+		Expect(errors.Is(err, fs.ErrNotExist)).To(BeTrue())
+
+		_, err = fs.ReadDir(fsys, "a.txt")
+		Expect(errors.Is(err, ErrNotDir)).To(BeTrue())
+
+		_, err = fsys.Open("../a.txt")
+		Expect(errors.Is(err, fs.ErrInvalid)).To(BeTrue())
+	})
+
+	It("should serve files over http", func() {
+		fsys := NewFS(context.Background(), client, root, nil)
+
+		handler := http.FileServer(http.FS(fsys))
+
+		req := httptest.NewRequest("GET", "/a.txt", nil)
+		req.Header.Set("Range", "bytes=6-")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		Expect(rec.Code).To(Equal(http.StatusPartialContent))
+		Expect(rec.Body.String()).To(Equal("world"))
+	})
+
+	It("should cache metadata until invalidated", func() {
+		fsys := NewFS(context.Background(), client, root, &FSOptions{CacheTTL: time.Minute})
+
+		_, err := fs.Stat(fsys, "a.txt")
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = client.Delete(context.Background(), &DeleteArg{Path: root + "/a.txt"})
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = fs.Stat(fsys, "a.txt")
+		Expect(err).NotTo(HaveOccurred())
+
+		fsys.InvalidateCache("a.txt")
+
+		_, err = fs.Stat(fsys, "a.txt")
+		Expect(errors.Is(err, fs.ErrNotExist)).To(BeTrue())
+	})
+})
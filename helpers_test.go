@@ -0,0 +1,61 @@
+package dropboxclient_test
+
+import (
+	"bytes"
+	"context"
+	"net/http/httptest"
+	"strings"
+
+	. "github.com/koofr/go-dropboxclient"
+	"github.com/koofr/go-dropboxclient/mockdropbox"
+
+	. "github.com/onsi/gomega"
+)
+
+func startMockClient() (client *Dropbox, mock *mockdropbox.MockDropbox, stop func()) {
+	mock = mockdropbox.New()
+	mockServer := httptest.NewServer(mock)
+
+	client, err := New(
+		WithAccessToken("mock"),
+		WithBaseURL(mockServer.URL),
+		WithHTTPClient(mockServer.Client()),
+	)
+	Expect(err).NotTo(HaveOccurred())
+
+	return client, mock, mockServer.Close
+}
+
+func uploadFile(client Client, path string, data []byte) *Metadata {
+	session, err := client.UploadSessionStart(context.Background(), bytes.NewReader(data))
+	Expect(err).NotTo(HaveOccurred())
+
+	md, err := client.UploadSessionFinish(context.Background(), &UploadSessionFinishArg{
+		Cursor: &UploadSessionCursor{
+			SessionId: session.SessionId,
+			Offset:    int64(len(data)),
+		},
+		Commit: &CommitInfo{
+			Path: path,
+			Mode: &WriteMode{
+				Tag: WriteModeOverwrite,
+			},
+		},
+	})
+	Expect(err).NotTo(HaveOccurred())
+
+	return md
+}
+
+func uploadMemoryFile(client Client, path string, data string) *Metadata {
+	session, err := client.UploadSessionStart(context.Background(), strings.NewReader(data))
+	Expect(err).NotTo(HaveOccurred())
+
+	md, err := client.UploadSessionFinish(context.Background(), &UploadSessionFinishArg{
+		Cursor: &UploadSessionCursor{SessionId: session.SessionId, Offset: int64(len(data))},
+		Commit: &CommitInfo{Path: path, Mode: &WriteMode{Tag: WriteModeAdd}},
+	})
+	Expect(err).NotTo(HaveOccurred())
+
+	return md
+}
@@ -0,0 +1,205 @@
+package dropboxclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/koofr/go-httpclient"
+)
+
+// Call is a single request passing through the middleware chain.
+type Call struct {
+	// Route is the API route without the version prefix, e.g.
+	// "files/get_metadata".
+	Route   string
+	Client  *httpclient.HTTPClient
+	Request *httpclient.RequestData
+	// Arg is the request argument: the JSON body value for RPC routes or
+	// the raw Dropbox-API-Arg header for content routes.
+	Arg interface{}
+	// Result is set once the request completed: the decoded response value
+	// for RPC routes or the raw Dropbox-API-Result header for content
+	// routes.
+	Result interface{}
+	// Retry is the number of failed attempts that preceded this call when it
+	// is retried by DownloadResumable or DownloadTo.
+	Retry int
+}
+
+// ErrRequestTimeout is returned when a request exceeds the timeout of its
+// endpoint class.
+var ErrRequestTimeout = errors.New("dropbox request timeout")
+
+type retryContextKey struct{}
+
+func withRetry(ctx context.Context, retry int) context.Context {
+	return context.WithValue(ctx, retryContextKey{}, retry)
+}
+
+// Handler performs a call. Errors returned by the innermost handler are
+// already converted with HandleError.
+type Handler func(call *Call) (*http.Response, error)
+
+// Middleware wraps a Handler, e.g. to add headers, log or measure calls.
+type Middleware func(next Handler) Handler
+
+// Use appends middlewares to the chain applied in Request. The first
+// middleware is the outermost one.
+func (c *Dropbox) Use(middlewares ...Middleware) {
+	c.middlewares = append(c.middlewares, middlewares...)
+}
+
+func newCall(client *httpclient.HTTPClient, req *httpclient.RequestData) *Call {
+	call := &Call{
+		Route:   strings.TrimPrefix(req.Path, "/2/"),
+		Client:  client,
+		Request: req,
+	}
+
+	if req.Context != nil {
+		call.Retry, _ = req.Context.Value(retryContextKey{}).(int)
+	}
+
+	if req.ReqValue != nil {
+		call.Arg = req.ReqValue
+	} else if arg := req.Headers.Get("Dropbox-API-Arg"); arg != "" {
+		call.Arg = json.RawMessage(arg)
+	}
+
+	return call
+}
+
+func (c *Dropbox) timeout(client *httpclient.HTTPClient) time.Duration {
+	switch client {
+	case c.ApiHTTPClient:
+		return c.ApiTimeout
+	case c.ContentHTTPClient:
+		return c.ContentTimeout
+	}
+	return 0
+}
+
+func (c *Dropbox) doCall(call *Call) (res *http.Response, err error) {
+	req := call.Request
+
+	if c.TokenSource != nil {
+		ctx := req.Context
+		if ctx == nil {
+			ctx = context.Background()
+		}
+
+		token, err := c.TokenSource.Token(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		if req.Headers == nil {
+			req.Headers = make(http.Header)
+		}
+		req.Headers.Set("Authorization", "Bearer "+token)
+	}
+
+	if timeout := c.timeout(call.Client); timeout > 0 {
+		parent := req.Context
+		if parent == nil {
+			parent = context.Background()
+		}
+
+		ctx, cancel := context.WithCancelCause(parent)
+		timer := time.AfterFunc(timeout, func() {
+			cancel(ErrRequestTimeout)
+		})
+		req.Context = ctx
+
+		res, err = call.Client.Request(req)
+
+		timer.Stop()
+
+		if err != nil && context.Cause(ctx) == ErrRequestTimeout {
+			cancel(nil)
+			return res, ErrRequestTimeout
+		}
+
+		if err == nil && req.RespValue == nil && !req.RespConsume {
+			res.Body = &cancelBody{ReadCloser: res.Body, cancel: func() { cancel(nil) }}
+		} else {
+			cancel(nil)
+		}
+	} else {
+		res, err = call.Client.Request(req)
+	}
+
+	if err != nil {
+		return res, c.HandleError(err)
+	}
+
+	if call.Request.RespValue != nil {
+		call.Result = call.Request.RespValue
+	} else if result := res.Header.Get("Dropbox-API-Result"); result != "" {
+		call.Result = json.RawMessage(result)
+	}
+
+	return res, nil
+}
+
+// cancelBody releases the context of a streamed response when the body is
+// closed.
+type cancelBody struct {
+	io.ReadCloser
+	cancel func()
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// LoggingMiddleware logs the route, outcome and duration of every call.
+// If logger is nil the standard logger is used.
+func LoggingMiddleware(logger *log.Logger) Middleware {
+	if logger == nil {
+		logger = log.Default()
+	}
+
+	return func(next Handler) Handler {
+		return func(call *Call) (*http.Response, error) {
+			start := time.Now()
+
+			res, err := next(call)
+
+			duration := time.Since(start)
+
+			if err != nil {
+				logger.Printf("Dropbox %s failed in %s: %s", call.Route, duration, err)
+			} else {
+				logger.Printf("Dropbox %s %d in %s", call.Route, res.StatusCode, duration)
+			}
+
+			return res, err
+		}
+	}
+}
+
+// TimingMiddleware calls observe with the route, duration and error of every
+// call. The duration of download calls covers the response headers only
+// since the body is read by the caller.
+func TimingMiddleware(observe func(route string, duration time.Duration, err error)) Middleware {
+	return func(next Handler) Handler {
+		return func(call *Call) (*http.Response, error) {
+			start := time.Now()
+
+			res, err := next(call)
+
+			observe(call.Route, time.Since(start), err)
+
+			return res, err
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package dropboxclient_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	. "github.com/koofr/go-dropboxclient"
+	"github.com/koofr/go-dropboxclient/mockdropbox"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Middleware", func() {
+	var client *Dropbox
+	var mock *mockdropbox.MockDropbox
+	var stop func()
+
+	BeforeEach(func() {
+		client, mock, stop = startMockClient()
+	})
+
+	AfterEach(func() {
+		stop()
+	})
+
+	It("should run middlewares in order with route, arg and result", func() {
+		order := []string{}
+		calls := []*Call{}
+
+		client.Use(
+			func(next Handler) Handler {
+				return func(call *Call) (*http.Response, error) {
+					order = append(order, "outer")
+					calls = append(calls, call)
+					return next(call)
+				}
+			},
+			func(next Handler) Handler {
+				return func(call *Call) (*http.Response, error) {
+					order = append(order, "inner")
+					return next(call)
+				}
+			},
+		)
+
+		folder, err := client.CreateFolder(context.Background(), &CreateFolderArg{Path: "/middleware"})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(order).To(Equal([]string{"outer", "inner"}))
+		Expect(calls).To(HaveLen(1))
+		Expect(calls[0].Route).To(Equal("files/create_folder"))
+		Expect(calls[0].Arg).To(Equal(&CreateFolderArg{Path: "/middleware"}))
+		Expect(*(calls[0].Result.(**Metadata))).To(Equal(folder))
+
+		uploadFile(client, "/middleware/file.txt", []byte("data"))
+
+		reader, _, err := client.Download(context.Background(), &DownloadArg{Path: "/middleware/file.txt"}, nil)
+		Expect(err).NotTo(HaveOccurred())
+		reader.Close()
+
+		download := calls[len(calls)-1]
+		Expect(download.Route).To(Equal("files/download"))
+		Expect(download.Arg).To(MatchJSON(`{"path":"/middleware/file.txt"}`))
+
+		md := &Metadata{}
+		Expect(json.Unmarshal(download.Result.(json.RawMessage), md)).To(Succeed())
+		Expect(md.Name).To(Equal("file.txt"))
+	})
+
+	It("should allow modifying requests", func() {
+		client.Use(func(next Handler) Handler {
+			return func(call *Call) (*http.Response, error) {
+				call.Request.ReqValue = &CreateFolderArg{Path: "/rewritten"}
+				return next(call)
+			}
+		})
+
+		folder, err := client.CreateFolder(context.Background(), &CreateFolderArg{Path: "/original"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(folder.Name).To(Equal("rewritten"))
+	})
+
+	It("should log calls", func() {
+		var buf bytes.Buffer
+		client.Use(LoggingMiddleware(log.New(&buf, "", 0)))
+
+		_, err := client.CreateFolder(context.Background(), &CreateFolderArg{Path: "/logged"})
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = client.GetMetadata(context.Background(), &GetMetadataArg{Path: "/missing"})
+		Expect(err).To(HaveOccurred())
+
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		Expect(lines).To(HaveLen(2))
+		Expect(lines[0]).To(HavePrefix("Dropbox files/create_folder 200 in "))
+		Expect(lines[1]).To(HavePrefix("Dropbox files/get_metadata failed in "))
+		Expect(lines[1]).To(ContainSubstring("path/not_found"))
+	})
+
+	It("should time calls", func() {
+		type observation struct {
+			route string
+			err   error
+		}
+		observations := []observation{}
+
+		client.Use(TimingMiddleware(func(route string, duration time.Duration, err error) {
+			Expect(duration).To(BeNumerically(">", 0))
+			observations = append(observations, observation{route, err})
+		}))
+
+		_, err := client.GetMetadata(context.Background(), &GetMetadataArg{Path: "/missing"})
+		Expect(err).To(HaveOccurred())
+
+		Expect(observations).To(HaveLen(1))
+		Expect(observations[0].route).To(Equal("files/get_metadata"))
+
+		_, ok := IsDropboxError(observations[0].err)
+		Expect(ok).To(BeTrue())
+	})
+
+	It("should expose the retry count of resumed downloads", func() {
+		uploadFile(client, "/retry.bin", bytes.Repeat([]byte("x"), 256))
+
+		retries := []int{}
+		client.Use(func(next Handler) Handler {
+			return func(call *Call) (*http.Response, error) {
+				retries = append(retries, call.Retry)
+				return next(call)
+			}
+		})
+
+		mock.CutDownloadsAfter(200)
+
+		reader, _, err := client.DownloadResumable(context.Background(), &DownloadArg{Path: "/retry.bin"}, nil, &ResumableDownloadOptions{
+			MaxRetries: 3,
+			RetryDelay: time.Millisecond,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		defer reader.Close()
+
+		data, err := io.ReadAll(reader)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(data).To(HaveLen(256))
+
+		Expect(retries).To(Equal([]int{0, 1}))
+	})
+})
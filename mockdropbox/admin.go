@@ -0,0 +1,342 @@
+package mockdropbox
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	gopath "path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/koofr/go-dropboxclient"
+)
+
+// UploadSessionInfo describes an upload session that was not finished yet.
+type UploadSessionInfo struct {
+	Id     string `json:"id"`
+	Offset int64  `json:"offset"`
+}
+
+// Change is an entry of the change log returned by Store.Changes.
+type Change struct {
+	ChangeID int64                   `json:"change_id"`
+	Metadata *dropboxclient.Metadata `json:"metadata"`
+}
+
+// ChangesResult is the response of the /_mock/changes endpoint.
+type ChangesResult struct {
+	Changes         []*Change `json:"changes"`
+	CurrentChangeID int64     `json:"current_change_id"`
+}
+
+// UploadSessions returns the unfinished upload sessions ordered by id.
+func (s *Store) UploadSessions() []*UploadSessionInfo {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	sessions := []*UploadSessionInfo{}
+	for _, session := range s.uploadSessions {
+		sessions = append(sessions, &UploadSessionInfo{
+			Id:     session.Id,
+			Offset: session.Upload.Size(),
+		})
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].Id < sessions[j].Id
+	})
+
+	return sessions
+}
+
+// Changes returns the changes made after the change ID since, ordered by
+// change ID. An item changed several times is only listed with its latest
+// change, deleted entries are listed as they were recorded.
+func (s *Store) Changes(since int64) []*Change {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	changes := []*Change{}
+	add := func(item *Item) {
+		if item.ChangeID > since {
+			md := *item.Metadata
+			changes = append(changes, &Change{
+				ChangeID: item.ChangeID,
+				Metadata: &md,
+			})
+		}
+	}
+	for id, item := range s.itemsByIds {
+		if id != "" {
+			add(item)
+		}
+	}
+	for _, item := range s.deletedItems {
+		add(item)
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].ChangeID < changes[j].ChangeID
+	})
+
+	return changes
+}
+
+// mkdirAll returns the folder at the absolute path, creating it and its
+// parents if needed.
+func (s *Store) mkdirAll(path string) (*Item, error) {
+	path = normalizePath(path)
+
+	if !strings.HasPrefix(path, "/") && path != "" {
+		return nil, fmt.Errorf("not an absolute path: %q", path)
+	}
+
+	if item, ok := s.GetItemByPath(path); ok {
+		if item.Metadata.Tag == dropboxclient.MetadataFile {
+			return nil, fmt.Errorf("not a folder: %s", path)
+		}
+		return item, nil
+	}
+
+	parentItem, err := s.mkdirAll(gopath.Dir(path))
+	if err != nil {
+		return nil, err
+	}
+
+	if item, ok := s.CreateFolder(parentItem, path); ok {
+		return item, nil
+	}
+
+	// created concurrently
+	return s.mkdirAll(path)
+}
+
+// Import adds the folders and regular files of a tar archive to the folder
+// at path. Missing folders are created and existing files are overwritten.
+// File modification times are used as client_modified.
+func (s *Store) Import(path string, r io.Reader) error {
+	if path != "" && (!strings.HasPrefix(path, "/") || validPath(path) != nil) {
+		return fmt.Errorf("invalid path: %q", path)
+	}
+	root := normalizePath(gopath.Clean("/" + path))
+
+	tr := tar.NewReader(r)
+
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		// clean the name on its own so that ".." can not leave root
+		name := normalizePath(gopath.Join(root, gopath.Clean("/"+header.Name)))
+		if name == "" {
+			continue
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if _, err := s.mkdirAll(name); err != nil {
+				return err
+			}
+
+		case tar.TypeReg:
+			if err := s.importFile(name, header.ModTime, tr); err != nil {
+				return fmt.Errorf("%s: %w", header.Name, err)
+			}
+		}
+	}
+}
+
+func (s *Store) importFile(path string, modTime time.Time, r io.Reader) error {
+	parentItem, err := s.mkdirAll(gopath.Dir(path))
+	if err != nil {
+		return err
+	}
+
+	upload, err := s.NewUpload()
+	if err != nil {
+		return err
+	}
+	defer upload.Discard()
+
+	if _, err := io.Copy(upload, r); err != nil {
+		return err
+	}
+
+	blob, err := s.CommitUpload(upload)
+	if err != nil {
+		return err
+	}
+	defer s.ReleaseBlob(blob)
+
+	var clientModified *time.Time
+	if !modTime.IsZero() {
+		t := modTime.UTC().Truncate(time.Second)
+		clientModified = &t
+	}
+
+	_, err = s.CreateFile(blob, parentItem, path, false, clientModified, dropboxclient.WriteModeOverwrite, "")
+	if err == errConflict {
+		return errors.New("a folder exists at the path")
+	}
+
+	return err
+}
+
+// Export writes the folders and files under the folder at path as a tar
+// archive. Names are relative to path.
+func (s *Store) Export(path string, w io.Writer) error {
+	type entry struct {
+		name string
+		item Item
+	}
+
+	root, ok := s.GetItemByPath(path)
+	if !ok {
+		return fmt.Errorf("not found: %s", path)
+	}
+	if root.Metadata.Tag == dropboxclient.MetadataFile {
+		return fmt.Errorf("not a folder: %s", path)
+	}
+
+	// snapshot the tree, blobs do not change once committed
+	entries := []*entry{}
+	s.mutex.RLock()
+	var walk func(item *Item, prefix string)
+	walk = func(item *Item, prefix string) {
+		children := append([]*Item{}, item.Children...)
+		sort.Slice(children, func(i, j int) bool {
+			return children[i].Metadata.Name < children[j].Metadata.Name
+		})
+		for _, child := range children {
+			name := prefix + child.Metadata.Name
+			md := *child.Metadata
+			entries = append(entries, &entry{
+				name: name,
+				item: Item{Metadata: &md, Hash: child.Hash},
+			})
+			walk(child, name+"/")
+		}
+	}
+	walk(root, "")
+	s.mutex.RUnlock()
+
+	tw := tar.NewWriter(w)
+
+	for _, e := range entries {
+		md := e.item.Metadata
+
+		if md.Tag == dropboxclient.MetadataFolder {
+			err := tw.WriteHeader(&tar.Header{
+				Typeflag: tar.TypeDir,
+				Name:     e.name + "/",
+				Mode:     0755,
+			})
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		err := tw.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     e.name,
+			Mode:     0644,
+			Size:     md.Size,
+			ModTime:  md.ClientModified,
+		})
+		if err != nil {
+			return err
+		}
+
+		blob, err := s.OpenBlob(&e.item)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(tw, io.NewSectionReader(blob, 0, blob.Size()))
+		blob.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	return tw.Close()
+}
+
+// AdminReset resets the store of the access token.
+func (d *MockDropbox) AdminReset(w http.ResponseWriter, r *http.Request) {
+	d.Store(r).Reset()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// AdminImport imports the tar archive in the request body into the folder
+// given by the path query parameter.
+func (d *MockDropbox) AdminImport(w http.ResponseWriter, r *http.Request) {
+	if err := d.Store(r).Import(r.URL.Query().Get("path"), r.Body); err != nil {
+		d.err(w, textError(http.StatusBadRequest, "Import error: "+err.Error()))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// AdminExport responds with a tar archive of the folder given by the path
+// query parameter.
+func (d *MockDropbox) AdminExport(w http.ResponseWriter, r *http.Request) {
+	store := d.Store(r)
+	path := r.URL.Query().Get("path")
+	if _, ok := store.GetItemByPath(path); !ok {
+		d.err(w, textError(http.StatusNotFound, "Not found: "+path))
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-tar")
+	if err := store.Export(path, w); err != nil {
+		log.Printf("MockDropbox export error: %s", err)
+		panic(http.ErrAbortHandler)
+	}
+}
+
+// AdminUploadSessions lists the unfinished upload sessions.
+func (d *MockDropbox) AdminUploadSessions(w http.ResponseWriter, r *http.Request) {
+	d.res(w, http.StatusOK, d.Store(r).UploadSessions())
+}
+
+// AdminChanges responds with the changes after the change ID given by the
+// since query parameter.
+func (d *MockDropbox) AdminChanges(w http.ResponseWriter, r *http.Request) {
+	var since int64
+	if s := r.URL.Query().Get("since"); s != "" {
+		var err error
+		if since, err = strconv.ParseInt(strings.TrimSpace(s), 10, 64); err != nil {
+			d.err(w, textError(http.StatusBadRequest, "Invalid since: "+s))
+			return
+		}
+	}
+	store := d.Store(r)
+	currentChangeID := store.GetCurrentChangeID()
+	d.res(w, http.StatusOK, &ChangesResult{
+		Changes:         store.Changes(since),
+		CurrentChangeID: currentChangeID,
+	})
+}
+
+// AdminCompact drops the tombstones up to the change_id query parameter, or
+// all of them if it is missing.
+func (d *MockDropbox) AdminCompact(w http.ResponseWriter, r *http.Request) {
+	var changeID int64
+	if s := r.URL.Query().Get("change_id"); s != "" {
+		var err error
+		if changeID, err = strconv.ParseInt(strings.TrimSpace(s), 10, 64); err != nil {
+			d.err(w, textError(http.StatusBadRequest, "Invalid change_id: "+s))
+			return
+		}
+	}
+	d.Store(r).CompactDeleted(changeID)
+	w.WriteHeader(http.StatusNoContent)
+}
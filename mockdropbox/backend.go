@@ -0,0 +1,203 @@
+package mockdropbox
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/fs"
+	"sync"
+
+	"github.com/koofr/go-dropboxclient"
+)
+
+// Backend stores the state of a Store. File content is kept in blobs named
+// by the MD5 hash of the content, and the metadata is rebuilt from a
+// journal of changes when the store is opened. The store removes blobs that
+// are no longer referenced by a file or a snapshot.
+type Backend interface {
+	// NewUpload returns storage for the content of an upload session.
+	NewUpload() (Upload, error)
+	// OpenBlob opens the blob of a committed upload.
+	OpenBlob(hash string) (Blob, error)
+	// RemoveBlob removes the blob. Blobs that are open stay readable until
+	// they are closed. Removing a missing blob is not an error.
+	RemoveBlob(hash string) error
+	// AppendJournal persists entry at the end of the journal.
+	AppendJournal(entry *JournalEntry) error
+	// ReplayJournal calls fn for every entry in the journal, in order.
+	ReplayJournal(fn func(entry *JournalEntry) error) error
+	Close() error
+}
+
+// Upload is the content of an upload session.
+type Upload interface {
+	io.Writer
+	Size() int64
+	// Truncate drops the content after size. Writes continue at the end.
+	Truncate(size int64) error
+	// Commit stores the current content as a blob. The upload stays usable
+	// until it is discarded.
+	Commit() (*BlobInfo, error)
+	Discard() error
+}
+
+// Blob is the content of a file.
+type Blob interface {
+	io.ReaderAt
+	io.Closer
+	Size() int64
+}
+
+type BlobInfo struct {
+	// Hash is the MD5 hash of the content and the name of the blob.
+	Hash        string
+	ContentHash string
+	Size        int64
+}
+
+// JournalEntry is a change of the store metadata. Exactly one field is set.
+type JournalEntry struct {
+	// AccountID is the account of the store, written once.
+	AccountID string `json:"account_id,omitempty"`
+	// Put creates or replaces the item with the same id.
+	Put *ItemRecord `json:"put,omitempty"`
+	// Remove removes the item with the id.
+	Remove string `json:"remove,omitempty"`
+	// Deleted is a tombstone listed by list_folder/continue.
+	Deleted *ItemRecord `json:"deleted,omitempty"`
+	// Reset removes all items and sets the current change ID.
+	Reset *int64 `json:"reset,omitempty"`
+	// Compact drops the tombstones up to and including the change ID.
+	Compact *int64 `json:"compact,omitempty"`
+}
+
+type ItemRecord struct {
+	Metadata *dropboxclient.Metadata `json:"metadata"`
+	ParentId string                  `json:"parent_id"`
+	Hash     string                  `json:"hash,omitempty"`
+	ChangeID int64                   `json:"change_id"`
+}
+
+var errInvalidOffset = errors.New("mockdropbox: invalid upload offset")
+
+// hashBlob computes the BlobInfo of the content read from r.
+func hashBlob(r io.Reader) (*BlobInfo, error) {
+	md5Hash := md5.New()
+	contentHash := dropboxclient.NewContentHash()
+
+	size, err := io.Copy(io.MultiWriter(md5Hash, contentHash), r)
+	if err != nil {
+		return nil, err
+	}
+
+	return &BlobInfo{
+		Hash:        hex.EncodeToString(md5Hash.Sum(nil)),
+		ContentHash: hex.EncodeToString(contentHash.Sum(nil)),
+		Size:        size,
+	}, nil
+}
+
+// MemoryBackend keeps blobs in memory and does not persist the journal.
+type MemoryBackend struct {
+	blobs map[string][]byte
+	mutex sync.RWMutex
+}
+
+func NewMemoryBackend() *MemoryBackend {
+	return &MemoryBackend{
+		blobs: map[string][]byte{},
+	}
+}
+
+func (b *MemoryBackend) NewUpload() (Upload, error) {
+	return &memoryUpload{
+		backend: b,
+		buffer:  bytes.NewBuffer(nil),
+	}, nil
+}
+
+func (b *MemoryBackend) OpenBlob(hash string) (Blob, error) {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	data, ok := b.blobs[hash]
+	if !ok {
+		return nil, fs.ErrNotExist
+	}
+
+	return memoryBlob{bytes.NewReader(data)}, nil
+}
+
+func (b *MemoryBackend) RemoveBlob(hash string) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	delete(b.blobs, hash)
+
+	return nil
+}
+
+func (b *MemoryBackend) AppendJournal(entry *JournalEntry) error {
+	return nil
+}
+
+func (b *MemoryBackend) ReplayJournal(fn func(entry *JournalEntry) error) error {
+	return nil
+}
+
+func (b *MemoryBackend) Close() error {
+	return nil
+}
+
+type memoryBlob struct {
+	*bytes.Reader
+}
+
+func (b memoryBlob) Close() error {
+	return nil
+}
+
+type memoryUpload struct {
+	backend *MemoryBackend
+	buffer  *bytes.Buffer
+}
+
+func (u *memoryUpload) Write(p []byte) (int, error) {
+	return u.buffer.Write(p)
+}
+
+func (u *memoryUpload) Size() int64 {
+	return int64(u.buffer.Len())
+}
+
+func (u *memoryUpload) Truncate(size int64) error {
+	if size < 0 || size > int64(u.buffer.Len()) {
+		return errInvalidOffset
+	}
+	u.buffer.Truncate(int(size))
+	return nil
+}
+
+func (u *memoryUpload) Commit() (*BlobInfo, error) {
+	info, err := hashBlob(bytes.NewReader(u.buffer.Bytes()))
+	if err != nil {
+		return nil, err
+	}
+
+	u.backend.mutex.Lock()
+	defer u.backend.mutex.Unlock()
+
+	if _, ok := u.backend.blobs[info.Hash]; !ok {
+		// the buffer may be truncated and written to after the commit
+		u.backend.blobs[info.Hash] = bytes.Clone(u.buffer.Bytes())
+	}
+
+	return info, nil
+}
+
+func (u *memoryUpload) Discard() error {
+	u.buffer = nil
+	return nil
+}
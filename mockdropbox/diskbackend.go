@@ -0,0 +1,245 @@
+package mockdropbox
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+const diskJournalName = "journal.jsonl"
+
+// maxJournalLine limits the size of a journal entry when replaying.
+const maxJournalLine = 16 * 1024 * 1024
+
+// DiskBackend keeps blobs as files in Dir/blobs, upload sessions in
+// Dir/uploads and appends the journal to Dir/journal.jsonl, one JSON entry
+// per line.
+type DiskBackend struct {
+	Dir string
+
+	journal      *os.File
+	journalMutex sync.Mutex
+}
+
+// NewDiskBackend opens a backend in dir, creating it if needed.
+func NewDiskBackend(dir string) (*DiskBackend, error) {
+	for _, sub := range []string{"blobs", "uploads"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0755); err != nil {
+			return nil, err
+		}
+	}
+
+	// upload sessions do not survive a restart
+	uploads, err := os.ReadDir(filepath.Join(dir, "uploads"))
+	if err != nil {
+		return nil, err
+	}
+	for _, upload := range uploads {
+		os.Remove(filepath.Join(dir, "uploads", upload.Name()))
+	}
+
+	journal, err := os.OpenFile(filepath.Join(dir, diskJournalName), os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	return &DiskBackend{
+		Dir:     dir,
+		journal: journal,
+	}, nil
+}
+
+// DiskBackends returns a backend factory for New that keeps the store of
+// each access token in its own subdirectory of dataDir.
+func DiskBackends(dataDir string) func(token string) (Backend, error) {
+	return func(token string) (Backend, error) {
+		sum := sha256.Sum256([]byte(token))
+		return NewDiskBackend(filepath.Join(dataDir, hex.EncodeToString(sum[:8])))
+	}
+}
+
+func (b *DiskBackend) blobPath(hash string) string {
+	return filepath.Join(b.Dir, "blobs", hash)
+}
+
+func (b *DiskBackend) NewUpload() (Upload, error) {
+	file, err := os.CreateTemp(filepath.Join(b.Dir, "uploads"), "upload-")
+	if err != nil {
+		return nil, err
+	}
+
+	return &diskUpload{
+		backend: b,
+		file:    file,
+	}, nil
+}
+
+func (b *DiskBackend) OpenBlob(hash string) (Blob, error) {
+	file, err := os.Open(b.blobPath(hash))
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return &diskBlob{
+		File: file,
+		size: info.Size(),
+	}, nil
+}
+
+func (b *DiskBackend) RemoveBlob(hash string) error {
+	if err := os.Remove(b.blobPath(hash)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (b *DiskBackend) AppendJournal(entry *JournalEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	b.journalMutex.Lock()
+	defer b.journalMutex.Unlock()
+
+	_, err = b.journal.Write(append(data, '\n'))
+	return err
+}
+
+// ReplayJournal calls fn for every entry in the journal. A final entry
+// without a newline is left by an append that was interrupted, e.g. by a
+// crash, and is dropped from the journal.
+func (b *DiskBackend) ReplayJournal(fn func(entry *JournalEntry) error) error {
+	b.journalMutex.Lock()
+	defer b.journalMutex.Unlock()
+
+	if _, err := b.journal.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	reader := bufio.NewReader(b.journal)
+
+	var offset int64
+	for line := 1; ; line++ {
+		data, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			if len(data) > 0 {
+				return b.journal.Truncate(offset)
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if len(data) > maxJournalLine {
+			return fmt.Errorf("journal line %d: %w", line, bufio.ErrTooLong)
+		}
+		offset += int64(len(data))
+
+		entry := &JournalEntry{}
+		if err := json.Unmarshal(data, entry); err != nil {
+			return fmt.Errorf("journal line %d: %w", line, err)
+		}
+		if err := fn(entry); err != nil {
+			return fmt.Errorf("journal line %d: %w", line, err)
+		}
+	}
+}
+
+func (b *DiskBackend) Close() error {
+	b.journalMutex.Lock()
+	defer b.journalMutex.Unlock()
+
+	return b.journal.Close()
+}
+
+type diskBlob struct {
+	*os.File
+	size int64
+}
+
+func (b *diskBlob) Size() int64 {
+	return b.size
+}
+
+type diskUpload struct {
+	backend *DiskBackend
+	file    *os.File
+	size    int64
+}
+
+func (u *diskUpload) Write(p []byte) (int, error) {
+	n, err := u.file.WriteAt(p, u.size)
+	u.size += int64(n)
+	return n, err
+}
+
+func (u *diskUpload) Size() int64 {
+	return u.size
+}
+
+func (u *diskUpload) Truncate(size int64) error {
+	if size < 0 || size > u.size {
+		return errInvalidOffset
+	}
+	if err := u.file.Truncate(size); err != nil {
+		return err
+	}
+	u.size = size
+	return nil
+}
+
+func (u *diskUpload) Commit() (*BlobInfo, error) {
+	info, err := hashBlob(io.NewSectionReader(u.file, 0, u.size))
+	if err != nil {
+		return nil, err
+	}
+
+	blobPath := u.backend.blobPath(info.Hash)
+
+	if _, err := os.Stat(blobPath); err == nil {
+		return info, nil
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	// copy to a temporary file first so that a blob is never partial
+	tmp, err := os.CreateTemp(filepath.Dir(blobPath), ".blob-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, io.NewSectionReader(u.file, 0, u.size)); err != nil {
+		tmp.Close()
+		return nil, err
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, err
+	}
+
+	if err := os.Rename(tmp.Name(), blobPath); err != nil {
+		return nil, err
+	}
+
+	return info, nil
+}
+
+func (u *diskUpload) Discard() error {
+	u.file.Close()
+	return os.Remove(u.file.Name())
+}
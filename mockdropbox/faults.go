@@ -0,0 +1,413 @@
+package mockdropbox
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/koofr/go-dropboxclient"
+)
+
+// Fault is the kind of failure injected by a FaultRule.
+type Fault string
+
+const (
+	// FaultTooManyRequests responds with 429 too_many_requests and a
+	// Retry-After header.
+	FaultTooManyRequests Fault = "too_many_requests"
+	// FaultTooManyWriteOperations responds with 429
+	// too_many_write_operations and a Retry-After header.
+	FaultTooManyWriteOperations Fault = "too_many_write_operations"
+	// FaultInternalServerError responds with 500.
+	FaultInternalServerError Fault = "internal_server_error"
+	// FaultServiceUnavailable responds with 503 and a Retry-After header.
+	FaultServiceUnavailable Fault = "service_unavailable"
+	// FaultReset serves the request and drops the connection after
+	// ResetAfter bytes of the response body. The request takes effect.
+	FaultReset Fault = "reset"
+	// FaultLatency delays the request by Latency and serves it. Latency
+	// rules add up and combine with other faults.
+	FaultLatency Fault = "latency"
+)
+
+// DefaultFaultSeed seeds the fault probabilities until SetFaults is called.
+const DefaultFaultSeed = 1
+
+// FaultRule injects a fault into the requests to a route.
+type FaultRule struct {
+	// Route is the API route without the /2/ prefix, e.g.
+	// "files/upload_session/append". Empty matches every route.
+	Route string
+	Fault Fault
+	// Probability is the chance that a matching request fails. Zero means
+	// every matching request fails.
+	Probability float64
+	// Skip is the number of matching requests served before the rule fires.
+	Skip int
+	// Times limits how many times the rule fires. Zero is unlimited.
+	Times int
+	// RetryAfter is the Retry-After in seconds of 429 and 503 responses.
+	// Defaults to 1.
+	RetryAfter int
+	// ResetAfter is the number of response body bytes written by
+	// FaultReset before the connection is dropped.
+	ResetAfter int64
+	// Latency is the delay added by FaultLatency.
+	Latency time.Duration
+	// Fired is the number of times the rule fired. It is only set in the
+	// rules returned by Faults.
+	Fired int
+}
+
+type faultRuleJSON struct {
+	Route       string  `json:"route,omitempty"`
+	Fault       Fault   `json:"fault"`
+	Probability float64 `json:"probability,omitempty"`
+	Skip        int     `json:"skip,omitempty"`
+	Times       int     `json:"times,omitempty"`
+	RetryAfter  int     `json:"retry_after,omitempty"`
+	ResetAfter  int64   `json:"reset_after,omitempty"`
+	Latency     string  `json:"latency,omitempty"`
+	Fired       int     `json:"fired,omitempty"`
+}
+
+// MarshalJSON encodes the rule with snake_case keys and Latency as a
+// duration string, e.g. "250ms".
+func (r *FaultRule) MarshalJSON() ([]byte, error) {
+	v := faultRuleJSON{
+		Route:       r.Route,
+		Fault:       r.Fault,
+		Probability: r.Probability,
+		Skip:        r.Skip,
+		Times:       r.Times,
+		RetryAfter:  r.RetryAfter,
+		ResetAfter:  r.ResetAfter,
+		Fired:       r.Fired,
+	}
+	if r.Latency != 0 {
+		v.Latency = r.Latency.String()
+	}
+	return json.Marshal(v)
+}
+
+func (r *FaultRule) UnmarshalJSON(data []byte) error {
+	v := faultRuleJSON{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*r = FaultRule{
+		Route:       v.Route,
+		Fault:       v.Fault,
+		Probability: v.Probability,
+		Skip:        v.Skip,
+		Times:       v.Times,
+		RetryAfter:  v.RetryAfter,
+		ResetAfter:  v.ResetAfter,
+		Fired:       v.Fired,
+	}
+	if v.Latency != "" {
+		latency, err := time.ParseDuration(v.Latency)
+		if err != nil {
+			return err
+		}
+		r.Latency = latency
+	}
+	return r.validate()
+}
+
+func (r *FaultRule) validate() error {
+	switch r.Fault {
+	case FaultTooManyRequests, FaultTooManyWriteOperations, FaultInternalServerError,
+		FaultServiceUnavailable, FaultReset, FaultLatency:
+	default:
+		return fmt.Errorf("mockdropbox: unknown fault %q", r.Fault)
+	}
+	if r.Probability < 0 || r.Probability > 1 {
+		return fmt.Errorf("mockdropbox: invalid fault probability %v", r.Probability)
+	}
+	return nil
+}
+
+// ParseFaultRule parses a rule from comma separated key=value pairs with the
+// JSON keys of FaultRule, e.g.
+// "route=files/download,fault=reset,reset_after=1024,times=1".
+func ParseFaultRule(s string) (*FaultRule, error) {
+	v := map[string]interface{}{}
+
+	for _, pair := range strings.Split(s, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			return nil, fmt.Errorf("mockdropbox: invalid fault rule %q: missing '=' in %q", s, pair)
+		}
+		switch key {
+		case "route", "fault", "latency":
+			v[key] = value
+		default:
+			n, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return nil, fmt.Errorf("mockdropbox: invalid fault rule %q: %s: %w", s, key, err)
+			}
+			v[key] = n
+		}
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	rule := &FaultRule{}
+	if err := json.Unmarshal(data, rule); err != nil {
+		return nil, fmt.Errorf("mockdropbox: invalid fault rule %q: %w", s, err)
+	}
+
+	return rule, nil
+}
+
+type faultState struct {
+	rule    FaultRule
+	matched int
+}
+
+type faults struct {
+	seed  int64
+	rules []*faultState
+	rand  *rand.Rand
+	mutex sync.Mutex
+}
+
+func newFaults() *faults {
+	return &faults{
+		seed: DefaultFaultSeed,
+		rand: rand.New(rand.NewSource(DefaultFaultSeed)),
+	}
+}
+
+// SetFaults replaces the fault rules and reseeds their probabilities, so
+// that the same sequence of requests fails the same way.
+func (d *MockDropbox) SetFaults(seed int64, rules ...*FaultRule) {
+	states := make([]*faultState, len(rules))
+	for i, rule := range rules {
+		states[i] = &faultState{rule: *rule}
+		states[i].rule.Fired = 0
+	}
+
+	d.faults.mutex.Lock()
+	defer d.faults.mutex.Unlock()
+
+	d.faults.rules = states
+	d.faults.seed = seed
+	d.faults.rand = rand.New(rand.NewSource(seed))
+}
+
+// AddFault appends a fault rule. Rules are evaluated in order and the first
+// one that fires fails the request.
+func (d *MockDropbox) AddFault(rule *FaultRule) {
+	state := &faultState{rule: *rule}
+	state.rule.Fired = 0
+
+	d.faults.mutex.Lock()
+	defer d.faults.mutex.Unlock()
+
+	d.faults.rules = append(d.faults.rules, state)
+}
+
+// ClearFaults removes all fault rules.
+func (d *MockDropbox) ClearFaults() {
+	d.faults.mutex.Lock()
+	defer d.faults.mutex.Unlock()
+
+	d.faults.rules = nil
+}
+
+// Faults returns copies of the fault rules with their Fired counts.
+func (d *MockDropbox) Faults() []*FaultRule {
+	d.faults.mutex.Lock()
+	defer d.faults.mutex.Unlock()
+
+	rules := make([]*FaultRule, len(d.faults.rules))
+	for i, state := range d.faults.rules {
+		rule := state.rule
+		rules[i] = &rule
+	}
+
+	return rules
+}
+
+// match returns the total latency and the first failing rule for route.
+func (f *faults) match(route string) (latency time.Duration, fault *FaultRule) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	for _, state := range f.rules {
+		rule := &state.rule
+
+		if rule.Route != "" && rule.Route != route {
+			continue
+		}
+		if fault != nil && rule.Fault != FaultLatency {
+			continue
+		}
+		if rule.Times > 0 && rule.Fired >= rule.Times {
+			continue
+		}
+
+		state.matched++
+		if state.matched <= rule.Skip {
+			continue
+		}
+		if rule.Probability > 0 && f.rand.Float64() >= rule.Probability {
+			continue
+		}
+
+		rule.Fired++
+
+		if rule.Fault == FaultLatency {
+			latency += rule.Latency
+		} else {
+			r := *rule
+			fault = &r
+		}
+	}
+
+	return latency, fault
+}
+
+func rateLimitError(reason string, retryAfter int) *Error {
+	return &Error{
+		StatusCode: http.StatusTooManyRequests,
+		Dropbox: &dropboxclient.DropboxError{
+			ErrorSummary: reason + "/..",
+			Err: dropboxclient.DropboxErrorDetails{
+				Reason: &dropboxclient.LookupError{
+					Tag: reason,
+				},
+				RetryAfter: retryAfter,
+			},
+		},
+	}
+}
+
+// injectFault applies the fault rules to r. It returns the writer the
+// request should be served with, or false if the request was answered.
+func (d *MockDropbox) injectFault(w http.ResponseWriter, r *http.Request) (http.ResponseWriter, bool) {
+	latency, fault := d.faults.match(strings.TrimPrefix(r.URL.Path, "/2/"))
+
+	if latency > 0 {
+		timer := time.NewTimer(latency)
+		select {
+		case <-timer.C:
+		case <-r.Context().Done():
+			timer.Stop()
+			return nil, false
+		}
+	}
+
+	if fault == nil {
+		return w, true
+	}
+
+	retryAfter := fault.RetryAfter
+	if retryAfter <= 0 {
+		retryAfter = 1
+	}
+
+	switch fault.Fault {
+	case FaultTooManyRequests, FaultTooManyWriteOperations:
+		w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+		d.err(w, rateLimitError(string(fault.Fault), retryAfter))
+	case FaultInternalServerError:
+		d.err(w, internalServerError())
+	case FaultServiceUnavailable:
+		w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+		d.err(w, textError(http.StatusServiceUnavailable, "Service unavailable"))
+	case FaultReset:
+		return &resetResponseWriter{
+			ResponseWriter: w,
+			remaining:      fault.ResetAfter,
+		}, true
+	}
+
+	return nil, false
+}
+
+// resetResponseWriter aborts the handler once remaining bytes of the body
+// have been written. A response shorter than that is served whole.
+type resetResponseWriter struct {
+	http.ResponseWriter
+	remaining int64
+}
+
+func (w *resetResponseWriter) WriteHeader(status int) {
+	if w.remaining <= 0 {
+		panic(http.ErrAbortHandler)
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *resetResponseWriter) Write(p []byte) (int, error) {
+	if int64(len(p)) < w.remaining {
+		n, err := w.ResponseWriter.Write(p)
+		w.remaining -= int64(n)
+		return n, err
+	}
+
+	if w.remaining > 0 {
+		w.ResponseWriter.Write(p[:w.remaining])
+		w.remaining = 0
+	}
+	w.Flush()
+	panic(http.ErrAbortHandler)
+}
+
+func (w *resetResponseWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// FaultsControl serves the fault rules at /_mock/faults:
+//
+//	GET    returns {"seed": ..., "rules": [...]} with the Fired counts
+//	PUT    replaces the rules and the seed with the same JSON
+//	POST   appends a single rule
+//	DELETE removes all rules
+func (d *MockDropbox) FaultsControl(w http.ResponseWriter, r *http.Request) {
+	type config struct {
+		Seed  int64        `json:"seed"`
+		Rules []*FaultRule `json:"rules"`
+	}
+
+	switch r.Method {
+	case "GET":
+		d.faults.mutex.Lock()
+		seed := d.faults.seed
+		d.faults.mutex.Unlock()
+		d.res(w, http.StatusOK, &config{Seed: seed, Rules: d.Faults()})
+	case "PUT":
+		c := &config{}
+		if !d.arg(w, r, c) {
+			return
+		}
+		d.SetFaults(c.Seed, c.Rules...)
+		w.WriteHeader(http.StatusNoContent)
+	case "POST":
+		rule := &FaultRule{}
+		if !d.arg(w, r, rule) {
+			return
+		}
+		d.AddFault(rule)
+		w.WriteHeader(http.StatusNoContent)
+	case "DELETE":
+		d.ClearFaults()
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Header().Set("Allow", "GET, PUT, POST, DELETE")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,274 @@
+package mockdropbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/koofr/go-dropboxclient"
+	"github.com/koofr/go-httpclient"
+	"github.com/koofr/go-ioutils"
+)
+
+// MemoryClient is a dropboxclient.Client that calls a Store directly,
+// without HTTP. Results and errors are the same as those of a Dropbox client
+// talking to MockDropbox.
+type MemoryClient struct {
+	Store *Store
+}
+
+var _ dropboxclient.Client = (*MemoryClient)(nil)
+
+func NewMemoryClient() *MemoryClient {
+	return NewMemoryClientWithStore(NewStore())
+}
+
+func NewMemoryClientWithStore(store *Store) *MemoryClient {
+	return &MemoryClient{
+		Store: store,
+	}
+}
+
+var expectedOK = []int{http.StatusOK}
+
+// clientError converts err to the error a Dropbox client returns for the
+// same response.
+func clientError(err *Error, expected []int) error {
+	headers := make(http.Header)
+	var content string
+
+	if err.Dropbox != nil {
+		data, jsonErr := json.Marshal(err.Dropbox)
+		if jsonErr != nil {
+			return jsonErr
+		}
+		headers.Set("Content-Type", "application/json")
+		content = string(data)
+	} else {
+		// same as http.Error
+		headers.Set("Content-Type", "text/plain; charset=utf-8")
+		headers.Set("X-Content-Type-Options", "nosniff")
+		content = err.Text + "\n"
+	}
+
+	ise := &httpclient.InvalidStatusError{
+		Expected: expected,
+		Got:      err.StatusCode,
+		Headers:  headers,
+		Content:  content,
+	}
+
+	dropboxErr := &dropboxclient.DropboxError{}
+
+	if err.Dropbox == nil || json.Unmarshal([]byte(content), &dropboxErr) != nil {
+		dropboxErr.ErrorSummary = content
+	}
+
+	if dropboxErr.ErrorSummary == "" {
+		dropboxErr.ErrorSummary = ise.Error()
+	}
+
+	dropboxErr.HttpClientError = ise
+
+	return dropboxErr
+}
+
+// decode copies src into dst through JSON, like a request or a response
+// would be.
+func decode(src interface{}, dst interface{}) error {
+	data, err := json.Marshal(src)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, dst)
+}
+
+func (c *MemoryClient) GetSpaceUsage(ctx context.Context) (result *dropboxclient.SpaceUsage, err error) {
+	if err = ctx.Err(); err != nil {
+		return nil, err
+	}
+	err = decode(c.Store.usersGetSpaceUsage(), &result)
+	return
+}
+
+func (c *MemoryClient) GetMetadata(ctx context.Context, arg *dropboxclient.GetMetadataArg) (result *dropboxclient.Metadata, err error) {
+	if err = ctx.Err(); err != nil {
+		return nil, err
+	}
+	req := &dropboxclient.GetMetadataArg{}
+	if err = decode(arg, &req); err != nil {
+		return nil, err
+	}
+	md, opErr := c.Store.filesGetMetadata(req)
+	if opErr != nil {
+		return nil, clientError(opErr, expectedOK)
+	}
+	err = decode(md, &result)
+	return
+}
+
+func (c *MemoryClient) ListFolder(ctx context.Context, arg *dropboxclient.ListFolderArg) (result *dropboxclient.ListFolderResult, err error) {
+	if err = ctx.Err(); err != nil {
+		return nil, err
+	}
+	req := &dropboxclient.ListFolderArg{}
+	if err = decode(arg, &req); err != nil {
+		return nil, err
+	}
+	res, opErr := c.Store.filesListFolder(req)
+	if opErr != nil {
+		return nil, clientError(opErr, expectedOK)
+	}
+	err = decode(res, &result)
+	return
+}
+
+func (c *MemoryClient) ListFolderContinue(ctx context.Context, arg *dropboxclient.ListFolderContinueArg) (result *dropboxclient.ListFolderResult, err error) {
+	if err = ctx.Err(); err != nil {
+		return nil, err
+	}
+	req := &dropboxclient.ListFolderContinueArg{}
+	if err = decode(arg, &req); err != nil {
+		return nil, err
+	}
+	res, opErr := c.Store.filesListFolderContinue(req)
+	if opErr != nil {
+		return nil, clientError(opErr, expectedOK)
+	}
+	err = decode(res, &result)
+	return
+}
+
+func (c *MemoryClient) CreateFolder(ctx context.Context, arg *dropboxclient.CreateFolderArg) (result *dropboxclient.Metadata, err error) {
+	if err = ctx.Err(); err != nil {
+		return nil, err
+	}
+	req := &dropboxclient.CreateFolderArg{}
+	if err = decode(arg, &req); err != nil {
+		return nil, err
+	}
+	md, opErr := c.Store.filesCreateFolder(req)
+	if opErr != nil {
+		return nil, clientError(opErr, expectedOK)
+	}
+	err = decode(md, &result)
+	return
+}
+
+func (c *MemoryClient) Delete(ctx context.Context, arg *dropboxclient.DeleteArg) (result *dropboxclient.Metadata, err error) {
+	if err = ctx.Err(); err != nil {
+		return nil, err
+	}
+	req := &dropboxclient.DeleteArg{}
+	if err = decode(arg, &req); err != nil {
+		return nil, err
+	}
+	md, opErr := c.Store.filesDelete(req)
+	if opErr != nil {
+		return nil, clientError(opErr, expectedOK)
+	}
+	err = decode(md, &result)
+	return
+}
+
+func (c *MemoryClient) Copy(ctx context.Context, arg *dropboxclient.RelocationArg) (result *dropboxclient.Metadata, err error) {
+	if err = ctx.Err(); err != nil {
+		return nil, err
+	}
+	req := &dropboxclient.RelocationArg{}
+	if err = decode(arg, &req); err != nil {
+		return nil, err
+	}
+	md, opErr := c.Store.filesCopy(req)
+	if opErr != nil {
+		return nil, clientError(opErr, expectedOK)
+	}
+	err = decode(md, &result)
+	return
+}
+
+func (c *MemoryClient) Move(ctx context.Context, arg *dropboxclient.RelocationArg) (result *dropboxclient.Metadata, err error) {
+	if err = ctx.Err(); err != nil {
+		return nil, err
+	}
+	req := &dropboxclient.RelocationArg{}
+	if err = decode(arg, &req); err != nil {
+		return nil, err
+	}
+	md, opErr := c.Store.filesMove(req)
+	if opErr != nil {
+		return nil, clientError(opErr, expectedOK)
+	}
+	err = decode(md, &result)
+	return
+}
+
+func (c *MemoryClient) Download(ctx context.Context, arg *dropboxclient.DownloadArg, span *ioutils.FileSpan) (reader io.ReadCloser, result *dropboxclient.Metadata, err error) {
+	if err = ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+	req := &dropboxclient.DownloadArg{}
+	if err = decode(arg, &req); err != nil {
+		return nil, nil, err
+	}
+	rng := ""
+	if span != nil {
+		rng = fmt.Sprintf("bytes=%d-%d", span.Start, span.End)
+	}
+	res, opErr := c.Store.filesDownload(req, rng)
+	if opErr != nil {
+		return nil, nil, clientError(opErr, []int{http.StatusOK, http.StatusPartialContent})
+	}
+	result = &dropboxclient.Metadata{}
+	if err = decode(res.Metadata, result); err != nil {
+		res.Content.Close()
+		return nil, nil, err
+	}
+	result.ETag = fmt.Sprintf(`W/"%s"`, res.Metadata.Rev)
+	result.ContentLength = res.Length
+	return res.Content, result, nil
+}
+
+func (c *MemoryClient) UploadSessionStart(ctx context.Context, reader io.Reader) (result *dropboxclient.UploadSessionStartResult, err error) {
+	if err = ctx.Err(); err != nil {
+		return nil, err
+	}
+	res, opErr := c.Store.filesUploadSessionStart(reader)
+	if opErr != nil {
+		return nil, clientError(opErr, expectedOK)
+	}
+	err = decode(res, &result)
+	return
+}
+
+func (c *MemoryClient) UploadSessionAppend(ctx context.Context, arg *dropboxclient.UploadSessionCursor, reader io.Reader) (err error) {
+	if err = ctx.Err(); err != nil {
+		return err
+	}
+	req := &dropboxclient.UploadSessionCursor{}
+	if err = decode(arg, &req); err != nil {
+		return err
+	}
+	if opErr := c.Store.filesUploadSessionAppend(req, reader); opErr != nil {
+		return clientError(opErr, expectedOK)
+	}
+	return nil
+}
+
+func (c *MemoryClient) UploadSessionFinish(ctx context.Context, arg *dropboxclient.UploadSessionFinishArg) (result *dropboxclient.Metadata, err error) {
+	if err = ctx.Err(); err != nil {
+		return nil, err
+	}
+	req := &dropboxclient.UploadSessionFinishArg{}
+	if err = decode(arg, &req); err != nil {
+		return nil, err
+	}
+	md, opErr := c.Store.filesUploadSessionFinish(req)
+	if opErr != nil {
+		return nil, clientError(opErr, expectedOK)
+	}
+	err = decode(md, &result)
+	return
+}
@@ -1,25 +1,17 @@
 package mockdropbox
 
 import (
-	"bytes"
-	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"log"
 	"net/http"
-	gopath "path"
-	"sort"
 	"strings"
 	"sync"
-	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/koofr/go-dropboxclient"
-	httputils "github.com/koofr/go-httputils"
-	ioutils "github.com/koofr/go-ioutils"
-	"github.com/koofr/go-pathutils"
 )
 
 type MockDropbox struct {
@@ -27,11 +19,34 @@ type MockDropbox struct {
 
 	stores      map[string]*Store
 	storesMutex sync.Mutex
+	newBackend  func(token string) (Backend, error)
+	storeOpts   []StoreOption
+
+	downloadCutAfter int64
+	downloadCutMutex sync.Mutex
+
+	faults *faults
+
+	webhook      *webhook
+	webhookMutex sync.Mutex
 }
 
-func New() *MockDropbox {
+// New returns a mock that keeps its stores in memory. The options are
+// applied to the store of every access token.
+func New(opts ...StoreOption) *MockDropbox {
+	return NewWithBackends(func(token string) (Backend, error) {
+		return NewMemoryBackend(), nil
+	}, opts...)
+}
+
+// NewWithBackends returns a mock that keeps the store of each access token
+// in the backend returned by newBackend, e.g. DiskBackends.
+func NewWithBackends(newBackend func(token string) (Backend, error), opts ...StoreOption) *MockDropbox {
 	d := &MockDropbox{
-		stores: map[string]*Store{},
+		stores:     map[string]*Store{},
+		newBackend: newBackend,
+		storeOpts:  opts,
+		faults:     newFaults(),
 	}
 
 	r := mux.NewRouter()
@@ -48,6 +63,14 @@ func New() *MockDropbox {
 	r.Methods("POST").Path("/2/files/upload_session/finish").HandlerFunc(d.FilesUploadSessionFinish)
 	r.Methods("POST").Path("/2/files/download").HandlerFunc(d.FilesDownload)
 
+	r.Path(controlPrefix + "faults").HandlerFunc(d.FaultsControl)
+	r.Methods("POST").Path(controlPrefix + "reset").HandlerFunc(d.AdminReset)
+	r.Methods("POST").Path(controlPrefix + "import").HandlerFunc(d.AdminImport)
+	r.Methods("GET").Path(controlPrefix + "export").HandlerFunc(d.AdminExport)
+	r.Methods("GET").Path(controlPrefix + "upload_sessions").HandlerFunc(d.AdminUploadSessions)
+	r.Methods("GET").Path(controlPrefix + "changes").HandlerFunc(d.AdminChanges)
+	r.Methods("POST").Path(controlPrefix + "compact").HandlerFunc(d.AdminCompact)
+
 	r.NotFoundHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Not found", http.StatusNotFound)
 	})
@@ -57,10 +80,44 @@ func New() *MockDropbox {
 	return d
 }
 
+// controlPrefix is the path prefix of the endpoints that control and
+// inspect the mock. Like the API they select the store by the access token.
+// Fault rules are not applied to them.
+const controlPrefix = "/_mock/"
+
 func (d *MockDropbox) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.URL.Path, controlPrefix) {
+		var ok bool
+		if w, ok = d.injectFault(w, r); !ok {
+			return
+		}
+	}
+
+	// open the store here so that Store does not fail in the handlers
+	if _, err := d.OpenStore(d.AccessToken(r)); err != nil {
+		log.Printf("MockDropbox store open error: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
 	d.handler.ServeHTTP(w, r)
 }
 
+// CutDownloadsAfter makes every download response drop the connection after
+// n bytes of the body have been written. Zero disables cutting.
+func (d *MockDropbox) CutDownloadsAfter(n int64) {
+	d.downloadCutMutex.Lock()
+	defer d.downloadCutMutex.Unlock()
+
+	d.downloadCutAfter = n
+}
+
+func (d *MockDropbox) getDownloadCutAfter() int64 {
+	d.downloadCutMutex.Lock()
+	defer d.downloadCutMutex.Unlock()
+
+	return d.downloadCutAfter
+}
+
 func (d *MockDropbox) AccessToken(r *http.Request) string {
 	auth := r.Header.Get("Authorization")
 	if auth == "" {
@@ -73,74 +130,59 @@ func (d *MockDropbox) AccessToken(r *http.Request) string {
 }
 
 func (d *MockDropbox) Store(r *http.Request) *Store {
+	return d.TokenStore(d.AccessToken(r))
+}
+
+// TokenStore returns the store of the given access token, opening it if
+// needed. It panics if the store cannot be opened, use OpenStore to handle
+// the error.
+func (d *MockDropbox) TokenStore(token string) *Store {
+	store, err := d.OpenStore(token)
+	if err != nil {
+		panic(err)
+	}
+	return store
+}
+
+// OpenStore returns the store of the given access token, opening it if
+// needed.
+func (d *MockDropbox) OpenStore(token string) (*Store, error) {
 	d.storesMutex.Lock()
 	defer d.storesMutex.Unlock()
 
-	token := d.AccessToken(r)
-
 	store, ok := d.stores[token]
 	if !ok {
-		store = NewStore()
+		backend, err := d.newBackend(token)
+		if err != nil {
+			return nil, fmt.Errorf("mockdropbox: open backend: %w", err)
+		}
+		opts := append(append([]StoreOption{}, d.storeOpts...), withSeedSalt(token))
+		store, err = NewStoreWithBackend(backend, opts...)
+		if err != nil {
+			backend.Close()
+			return nil, fmt.Errorf("mockdropbox: open store: %w", err)
+		}
+		store.onChange = d.notifyWebhook
 		d.stores[token] = store
 	}
 
-	return store
-}
-
-func (d *MockDropbox) validPath(w http.ResponseWriter, path string) bool {
-	if !pathutils.IsPathValid(path) {
-		http.Error(w, "Invalid path", http.StatusInternalServerError)
-		return false
-	}
-	return true
+	return store, nil
 }
 
-func (d *MockDropbox) validPathOrID(w http.ResponseWriter, path string) bool {
-	if isPathID(path) {
-		return true
-	}
-	if !pathutils.IsPathValid(path) {
-		http.Error(w, "Invalid path", http.StatusInternalServerError)
-		return false
-	}
-	return true
-}
+// Close closes the backends of all stores.
+func (d *MockDropbox) Close() error {
+	d.storesMutex.Lock()
+	defer d.storesMutex.Unlock()
 
-func (d *MockDropbox) buildCursor(id string, recursive bool, lastChangeID int64) string {
-	cursor := &Cursor{
-		ID:           id,
-		Recursive:    recursive,
-		LastChangeID: lastChangeID,
+	var firstErr error
+	for token, store := range d.stores {
+		if err := store.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		delete(d.stores, token)
 	}
-	data, _ := json.Marshal(cursor)
-	return base64.StdEncoding.EncodeToString(data)
-}
 
-func (d *MockDropbox) invalidCursor(w http.ResponseWriter) {
-	d.res(w, http.StatusConflict, &dropboxclient.DropboxError{
-		ErrorSummary: "path/not_found/..",
-		Err: dropboxclient.DropboxErrorDetails{
-			Tag: "path",
-			Path: &dropboxclient.LookupError{
-				Tag: "not_found",
-			},
-		},
-	})
-}
-
-func (d *MockDropbox) parseCursor(w http.ResponseWriter, cursor string) (c *Cursor, ok bool) {
-	data, err := base64.StdEncoding.DecodeString(cursor)
-	if err != nil {
-		http.Error(w, "Error in call to API function \"files/list_folder/continue\": Invalid \"cursor\" parameter: '"+cursor+"'", http.StatusBadRequest)
-		return nil, false
-	}
-	c = &Cursor{}
-	err = json.Unmarshal(data, &c)
-	if err != nil {
-		http.Error(w, "Error in call to API function \"files/list_folder/continue\": Invalid \"cursor\" parameter: '"+cursor+"'", http.StatusBadRequest)
-		return nil, false
-	}
-	return c, true
+	return firstErr
 }
 
 func (d *MockDropbox) arg(w http.ResponseWriter, r *http.Request, v interface{}) bool {
@@ -170,28 +212,12 @@ func (d *MockDropbox) headerArg(w http.ResponseWriter, r *http.Request, v interf
 	return true
 }
 
-func (d *MockDropbox) pathNotFound(w http.ResponseWriter) {
-	d.res(w, http.StatusConflict, &dropboxclient.DropboxError{
-		ErrorSummary: "path/not_found/..",
-		Err: dropboxclient.DropboxErrorDetails{
-			Tag: "path",
-			Path: &dropboxclient.LookupError{
-				Tag: "not_found",
-			},
-		},
-	})
-}
-
-func (d *MockDropbox) pathLookupNotFound(w http.ResponseWriter) {
-	d.res(w, http.StatusConflict, &dropboxclient.DropboxError{
-		ErrorSummary: "path_lookup/not_found/",
-		Err: dropboxclient.DropboxErrorDetails{
-			Tag: "path_lookup",
-			PathLookup: &dropboxclient.LookupError{
-				Tag: "not_found",
-			},
-		},
-	})
+func (d *MockDropbox) err(w http.ResponseWriter, err *Error) {
+	if err.Dropbox != nil {
+		d.res(w, err.StatusCode, err.Dropbox)
+		return
+	}
+	http.Error(w, err.Text, err.StatusCode)
 }
 
 func (d *MockDropbox) res(w http.ResponseWriter, statusCode int, v interface{}) {
@@ -218,15 +244,7 @@ func (d *MockDropbox) headerRes(w http.ResponseWriter, v interface{}) bool {
 }
 
 func (d *MockDropbox) UsersGetSpaceUsage(w http.ResponseWriter, r *http.Request) {
-	spaceUsed, spaceAllocated := d.Store(r).GetSpaceUsage()
-
-	d.res(w, http.StatusOK, &dropboxclient.SpaceUsage{
-		Used: spaceUsed,
-		Allocation: &dropboxclient.SpaceAllocation{
-			Tag:       ".individual",
-			Allocated: spaceAllocated,
-		},
-	})
+	d.res(w, http.StatusOK, d.Store(r).usersGetSpaceUsage())
 }
 
 func (d *MockDropbox) FilesCreateFolder(w http.ResponseWriter, r *http.Request) {
@@ -234,31 +252,12 @@ func (d *MockDropbox) FilesCreateFolder(w http.ResponseWriter, r *http.Request)
 	if !d.arg(w, r, &arg) {
 		return
 	}
-	if !d.validPath(w, arg.Path) {
-		return
-	}
-	parentPath := gopath.Dir(arg.Path)
-	parentItem, ok := d.Store(r).GetItemByPath(parentPath)
-	if !ok {
-		d.pathNotFound(w)
-		return
-	}
-	item, ok := d.Store(r).CreateFolder(parentItem, arg.Path)
-	if !ok {
-		d.res(w, http.StatusConflict, &dropboxclient.DropboxError{
-			ErrorSummary: "path/conflict/file/...",
-			Err: dropboxclient.DropboxErrorDetails{
-				Tag: "path",
-				Path: &dropboxclient.LookupError{
-					Tag: "conflict",
-				},
-			},
-		})
+	md, err := d.Store(r).filesCreateFolder(arg)
+	if err != nil {
+		d.err(w, err)
 		return
 	}
-	mdCopy := *item.Metadata
-	mdCopy.Tag = ""
-	d.res(w, http.StatusOK, mdCopy)
+	d.res(w, http.StatusOK, md)
 }
 
 func (d *MockDropbox) FilesGetMetadata(w http.ResponseWriter, r *http.Request) {
@@ -266,64 +265,12 @@ func (d *MockDropbox) FilesGetMetadata(w http.ResponseWriter, r *http.Request) {
 	if !d.arg(w, r, &arg) {
 		return
 	}
-	if !d.validPathOrID(w, arg.Path) {
-		return
-	}
-	item, ok := d.Store(r).GetItemByPathOrID(arg.Path)
-	if !ok {
-		d.pathNotFound(w)
-		return
-	}
-	if item.Metadata.Id == "" {
-		http.Error(w, "Error in call to API function \"files/get_metadata\": request body: path: The root folder is unsupported.", http.StatusBadRequest)
-		return
-	}
-	d.res(w, http.StatusOK, item.Metadata)
-}
-
-func (d *MockDropbox) listFolder(w http.ResponseWriter, r *http.Request, cursor *Cursor) {
-	nextChangeID := d.Store(r).GetCurrentChangeID()
-	item, ok := d.Store(r).GetItemByID(cursor.ID)
-	if !ok {
-		d.pathNotFound(w)
+	md, err := d.Store(r).filesGetMetadata(arg)
+	if err != nil {
+		d.err(w, err)
 		return
 	}
-	items := []*Item{}
-	addEntry := func(item *Item) {
-		if item.ChangeID > cursor.LastChangeID {
-			items = append(items, item)
-		}
-	}
-	var addEntries func(item *Item)
-	addEntries = func(item *Item) {
-		for _, child := range item.Children {
-			addEntry(child)
-			if cursor.Recursive {
-				addEntries(child)
-			}
-		}
-	}
-	if cursor.Recursive && item.Metadata.Id != "" {
-		addEntry(item)
-	}
-	addEntries(item)
-	if cursor.LastChangeID != 0 {
-		for _, item := range d.Store(r).GetDeletedItems() {
-			addEntry(item)
-		}
-	}
-	sort.Slice(items, func(i, j int) bool {
-		return items[i].ChangeID < items[j].ChangeID
-	})
-	entries := make([]*dropboxclient.Metadata, len(items))
-	for i, item := range items {
-		entries[i] = item.Metadata
-	}
-	d.res(w, http.StatusOK, &dropboxclient.ListFolderResult{
-		Entries: entries,
-		HasMore: false,
-		Cursor:  d.buildCursor(cursor.ID, cursor.Recursive, nextChangeID),
-	})
+	d.res(w, http.StatusOK, md)
 }
 
 func (d *MockDropbox) FilesListFolder(w http.ResponseWriter, r *http.Request) {
@@ -331,20 +278,12 @@ func (d *MockDropbox) FilesListFolder(w http.ResponseWriter, r *http.Request) {
 	if !d.arg(w, r, &arg) {
 		return
 	}
-	if !d.validPathOrID(w, arg.Path) {
-		return
-	}
-	item, ok := d.Store(r).GetItemByPathOrID(arg.Path)
-	if !ok {
-		d.pathNotFound(w)
+	result, err := d.Store(r).filesListFolder(arg)
+	if err != nil {
+		d.err(w, err)
 		return
 	}
-	cursor := &Cursor{
-		ID:           item.Metadata.Id,
-		Recursive:    arg.Recursive,
-		LastChangeID: 0,
-	}
-	d.listFolder(w, r, cursor)
+	d.res(w, http.StatusOK, result)
 }
 
 func (d *MockDropbox) FilesListFolderContinue(w http.ResponseWriter, r *http.Request) {
@@ -352,11 +291,12 @@ func (d *MockDropbox) FilesListFolderContinue(w http.ResponseWriter, r *http.Req
 	if !d.arg(w, r, &arg) {
 		return
 	}
-	cursor, ok := d.parseCursor(w, arg.Cursor)
-	if !ok {
+	result, err := d.Store(r).filesListFolderContinue(arg)
+	if err != nil {
+		d.err(w, err)
 		return
 	}
-	d.listFolder(w, r, cursor)
+	d.res(w, http.StatusOK, result)
 }
 
 func (d *MockDropbox) FilesDelete(w http.ResponseWriter, r *http.Request) {
@@ -364,16 +304,12 @@ func (d *MockDropbox) FilesDelete(w http.ResponseWriter, r *http.Request) {
 	if !d.arg(w, r, &arg) {
 		return
 	}
-	if !d.validPathOrID(w, arg.Path) {
-		return
-	}
-	item, ok := d.Store(r).GetItemByPathOrID(arg.Path)
-	if !ok {
-		d.pathLookupNotFound(w)
+	md, err := d.Store(r).filesDelete(arg)
+	if err != nil {
+		d.err(w, err)
 		return
 	}
-	d.Store(r).Delete(item)
-	d.res(w, http.StatusOK, item.Metadata)
+	d.res(w, http.StatusOK, md)
 }
 
 func (d *MockDropbox) FilesCopy(w http.ResponseWriter, r *http.Request) {
@@ -381,24 +317,12 @@ func (d *MockDropbox) FilesCopy(w http.ResponseWriter, r *http.Request) {
 	if !d.arg(w, r, &arg) {
 		return
 	}
-	if !d.validPathOrID(w, arg.FromPath) {
-		return
-	}
-	if !d.validPath(w, arg.ToPath) {
-		return
-	}
-	item, ok := d.Store(r).GetItemByPathOrID(arg.FromPath)
-	if !ok {
-		d.pathLookupNotFound(w)
-		return
-	}
-	newParentItem, ok := d.Store(r).GetItemByPath(gopath.Dir(arg.ToPath))
-	if !ok {
-		d.pathLookupNotFound(w)
+	md, err := d.Store(r).filesCopy(arg)
+	if err != nil {
+		d.err(w, err)
 		return
 	}
-	newItem := d.Store(r).Copy(item, newParentItem, arg.ToPath)
-	d.res(w, http.StatusOK, newItem.Metadata)
+	d.res(w, http.StatusOK, md)
 }
 
 func (d *MockDropbox) FilesMove(w http.ResponseWriter, r *http.Request) {
@@ -406,40 +330,21 @@ func (d *MockDropbox) FilesMove(w http.ResponseWriter, r *http.Request) {
 	if !d.arg(w, r, &arg) {
 		return
 	}
-	if !d.validPathOrID(w, arg.FromPath) {
-		return
-	}
-	if !d.validPath(w, arg.ToPath) {
-		return
-	}
-	item, ok := d.Store(r).GetItemByPathOrID(arg.FromPath)
-	if !ok {
-		d.pathLookupNotFound(w)
-		return
-	}
-	newParentItem, ok := d.Store(r).GetItemByPath(gopath.Dir(arg.ToPath))
-	if !ok {
-		d.pathLookupNotFound(w)
+	md, err := d.Store(r).filesMove(arg)
+	if err != nil {
+		d.err(w, err)
 		return
 	}
-	d.Store(r).Move(item, newParentItem, arg.ToPath)
-	d.res(w, http.StatusOK, item.Metadata)
+	d.res(w, http.StatusOK, md)
 }
 
 func (d *MockDropbox) FilesUploadSessionStart(w http.ResponseWriter, r *http.Request) {
-	session := &UploadSession{
-		Id:     randomString(),
-		Buffer: bytes.NewBuffer(nil),
-	}
-	_, err := io.Copy(session.Buffer, r.Body)
+	result, err := d.Store(r).filesUploadSessionStart(r.Body)
 	if err != nil {
-		http.Error(w, "Upload copy error", http.StatusInternalServerError)
+		d.err(w, err)
 		return
 	}
-	d.Store(r).AddSession(session)
-	d.res(w, http.StatusOK, &dropboxclient.UploadSessionStartResult{
-		SessionId: session.Id,
-	})
+	d.res(w, http.StatusOK, result)
 }
 
 func (d *MockDropbox) FilesUploadSessionAppend(w http.ResponseWriter, r *http.Request) {
@@ -447,15 +352,8 @@ func (d *MockDropbox) FilesUploadSessionAppend(w http.ResponseWriter, r *http.Re
 	if !d.headerArg(w, r, &arg) {
 		return
 	}
-	session, ok := d.Store(r).GetSession(arg.SessionId)
-	if !ok {
-		http.Error(w, fmt.Sprintf("Invalid session id: %s", arg.SessionId), http.StatusInternalServerError)
-		return
-	}
-	session.Buffer.Truncate(int(arg.Offset))
-	_, err := io.Copy(session.Buffer, r.Body)
-	if err != nil {
-		http.Error(w, "Upload copy error", http.StatusInternalServerError)
+	if err := d.Store(r).filesUploadSessionAppend(arg, r.Body); err != nil {
+		d.err(w, err)
 		return
 	}
 	d.res(w, http.StatusOK, nil)
@@ -466,81 +364,12 @@ func (d *MockDropbox) FilesUploadSessionFinish(w http.ResponseWriter, r *http.Re
 	if !d.headerArg(w, r, &arg) {
 		return
 	}
-	session, ok := d.Store(r).GetSession(arg.Cursor.SessionId)
-	if !ok {
-		http.Error(w, fmt.Sprintf("Invalid session id: %s", arg.Cursor.SessionId), http.StatusInternalServerError)
-		return
-	}
-	if !d.validPath(w, arg.Commit.Path) {
-		return
-	}
-	parentItem, ok := d.Store(r).GetItemByPath(gopath.Dir(arg.Commit.Path))
-	if !ok {
-		d.pathLookupNotFound(w)
-		return
-	}
-	var clientModifiedOpt *time.Time
-	if arg.Commit.ClientModified != nil {
-		clientModified, err := time.Parse(dropboxclient.DropboxClientModifiedFormat, *arg.Commit.ClientModified)
-		if err != nil {
-			http.Error(w, fmt.Sprintf("Invalid client modified time format: %s", err), http.StatusInternalServerError)
-			return
-		}
-		clientModifiedOpt = &clientModified
-	}
-	item, ok, isConflict := d.Store(r).CreateFile(session, parentItem, arg.Commit.Path, arg.Commit.Autorename, clientModifiedOpt, arg.Commit.Mode.Tag, arg.Commit.Mode.Update)
-	if !ok {
-		if isConflict {
-			d.res(w, http.StatusConflict, &dropboxclient.DropboxError{
-				ErrorSummary: "path/conflict/file/...",
-				Err: dropboxclient.DropboxErrorDetails{
-					Tag: "path",
-					Path: &dropboxclient.LookupError{
-						Tag: "conflict",
-					},
-				},
-			})
-		} else {
-			d.res(w, http.StatusConflict, &dropboxclient.DropboxError{
-				ErrorSummary: "other/...",
-				Err: dropboxclient.DropboxErrorDetails{
-					Tag: "other",
-				},
-			})
-		}
-		return
-	}
-	d.Store(r).DeleteSession(session)
-	mdCopy := *item.Metadata
-	mdCopy.Tag = ""
-	d.res(w, http.StatusOK, mdCopy)
-}
-
-func (d *MockDropbox) setupRange(w http.ResponseWriter, r *http.Request, md *dropboxclient.Metadata) (span *ioutils.FileSpan, ok bool) {
-	rng := r.Header.Get("Range")
-	if rng == "" {
-		return nil, true
-	}
-
-	spans, _, err := httputils.ParseRange(rng, md.Size)
+	md, err := d.Store(r).filesUploadSessionFinish(arg)
 	if err != nil {
-		log.Printf("setupRange error: %s", err)
-		http.Error(w, "Invalid range", http.StatusRequestedRangeNotSatisfiable)
-		return nil, false
-	}
-
-	if len(spans) != 1 {
-		log.Printf("setupRange multiple ranges not supported")
-		http.Error(w, "Multiple ranges not supported", http.StatusBadRequest)
-		return nil, false
+		d.err(w, err)
+		return
 	}
-
-	span = &spans[0]
-
-	contentRange := fmt.Sprintf("bytes %d-%d/%d", span.Start, span.End, md.Size)
-	w.Header().Set("Content-Range", contentRange)
-
-	return span, true
+	d.res(w, http.StatusOK, md)
 }
 
 func (d *MockDropbox) FilesDownload(w http.ResponseWriter, r *http.Request) {
@@ -548,48 +377,32 @@ func (d *MockDropbox) FilesDownload(w http.ResponseWriter, r *http.Request) {
 	if !d.headerArg(w, r, &arg) {
 		return
 	}
-	if !d.validPathOrID(w, arg.Path) {
-		return
-	}
-	item, ok := d.Store(r).GetItemByPathOrID(arg.Path)
-	if !ok {
-		d.pathNotFound(w)
+	result, err := d.Store(r).filesDownload(arg, r.Header.Get("Range"))
+	if err != nil {
+		d.err(w, err)
 		return
 	}
-	if item.Metadata.Tag != "file" {
-		d.res(w, http.StatusConflict, &dropboxclient.DropboxError{
-			ErrorSummary: "unsupported_file/...",
-			Err: dropboxclient.DropboxErrorDetails{
-				Tag: "unsupported_file",
-			},
-		})
-	}
-	bytesReader := bytes.NewReader(item.Data)
-	var reader io.Reader = bytesReader
-	length := int64(len(item.Data))
-	span, ok := d.setupRange(w, r, item.Metadata)
-	if !ok {
+	if !d.headerRes(w, result.Metadata) {
 		return
 	}
-	if span != nil {
-		_, err := bytesReader.Seek(span.Start, io.SeekStart)
-		if err != nil {
-			log.Printf("reader seek error: %s", err)
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
-			return
-		}
-
-		length = span.End - span.Start + 1
-
-		reader = io.LimitReader(reader, length)
-	}
-	if !d.headerRes(w, item.Metadata) {
-		return
+	defer result.Content.Close()
+	length := result.Length
+	reader := result.Content
+	if result.ContentRange != "" {
+		w.Header().Set("Content-Range", result.ContentRange)
 	}
 	w.Header().Set("Content-Length", fmt.Sprintf("%d", length))
-	w.Header().Set("Etag", fmt.Sprintf(`W/"%s"`, item.Metadata.Rev))
+	w.Header().Set("Etag", fmt.Sprintf(`W/"%s"`, result.Metadata.Rev))
 
 	w.WriteHeader(http.StatusOK)
 
+	if cutAfter := d.getDownloadCutAfter(); cutAfter > 0 && cutAfter < length {
+		io.CopyN(w, reader, cutAfter)
+		if flusher, ok := w.(http.Flusher); ok {
+			flusher.Flush()
+		}
+		panic(http.ErrAbortHandler)
+	}
+
 	io.Copy(w, reader)
 }
@@ -4,16 +4,89 @@ import (
 	"flag"
 	"log"
 	"net/http"
+	"strings"
+	"time"
 
+	"github.com/koofr/go-dropboxclient"
 	"github.com/koofr/go-dropboxclient/mockdropbox"
 )
 
+type faultsFlag []*mockdropbox.FaultRule
+
+func (f *faultsFlag) String() string {
+	rules := []string{}
+	for _, rule := range *f {
+		rules = append(rules, string(rule.Fault))
+	}
+	return strings.Join(rules, " ")
+}
+
+func (f *faultsFlag) Set(value string) error {
+	rule, err := mockdropbox.ParseFaultRule(value)
+	if err != nil {
+		return err
+	}
+	*f = append(*f, rule)
+	return nil
+}
+
 func main() {
 	var addr string
+	var webhookURL string
+	var webhookSecret string
+	var dataDir string
+	var faults faultsFlag
+	var faultSeed int64
+	var seed int64
+	var clockStart string
+	var clockStep time.Duration
+	var quota int64
+	var allocation string
 	flag.StringVar(&addr, "addr", "localhost:7162", "Listen address")
+	flag.StringVar(&webhookURL, "webhook-url", "", "URL notified of changes")
+	flag.StringVar(&webhookSecret, "webhook-secret", "", "App secret used to sign webhook notifications")
+	flag.StringVar(&dataDir, "data-dir", "", "Directory where the stores are persisted (in memory if empty)")
+	flag.Var(&faults, "fault", "Fault rule, e.g. route=files/download,fault=reset,reset_after=1024 (repeatable)")
+	flag.Int64Var(&faultSeed, "fault-seed", mockdropbox.DefaultFaultSeed, "Seed of the fault probabilities")
+	flag.Int64Var(&seed, "seed", 0, "Seed of the generated IDs and revs (random if 0)")
+	flag.StringVar(&clockStart, "clock-start", "", "Start the clock at this RFC 3339 time instead of using the wall clock")
+	flag.DurationVar(&clockStep, "clock-step", time.Second, "Advance the -clock-start clock by this much on every read")
+	flag.Int64Var(&quota, "quota", mockdropbox.DefaultSpaceAllocated, "Space allocated to every account in bytes")
+	flag.StringVar(&allocation, "allocation", dropboxclient.SpaceAllocationIndividual, "Space allocation type, individual or team")
 	flag.Parse()
 
-	handler := mockdropbox.New()
+	if allocation != dropboxclient.SpaceAllocationIndividual && allocation != dropboxclient.SpaceAllocationTeam {
+		log.Fatalf("Invalid -allocation: %s", allocation)
+	}
+
+	storeOpts := []mockdropbox.StoreOption{
+		mockdropbox.WithSpaceAllocation(allocation, quota),
+	}
+	if seed != 0 {
+		storeOpts = append(storeOpts, mockdropbox.WithSeed(seed))
+	}
+	if clockStart != "" {
+		start, err := time.Parse(time.RFC3339, clockStart)
+		if err != nil {
+			log.Fatalf("Invalid -clock-start: %s", err)
+		}
+		storeOpts = append(storeOpts, mockdropbox.WithClock(mockdropbox.NewFakeClock(start, clockStep)))
+	}
+
+	handler := mockdropbox.New(storeOpts...)
+	if dataDir != "" {
+		handler = mockdropbox.NewWithBackends(mockdropbox.DiskBackends(dataDir), storeOpts...)
+		log.Printf("MockDropbox data dir %s", dataDir)
+	}
+
+	handler.SetFaults(faultSeed, faults...)
+	for _, rule := range faults {
+		log.Printf("MockDropbox fault %s on %q", rule.Fault, rule.Route)
+	}
+
+	if webhookURL != "" {
+		handler.RegisterWebhook(webhookURL, webhookSecret)
+	}
 
 	log.Printf("MockDropbox server listening on %s", addr)
 	log.Fatal(http.ListenAndServe(addr, handler))
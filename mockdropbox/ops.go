@@ -0,0 +1,520 @@
+package mockdropbox
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	gopath "path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/koofr/go-dropboxclient"
+	httputils "github.com/koofr/go-httputils"
+	"github.com/koofr/go-pathutils"
+)
+
+// The operations in this file implement the API endpoints on top of a Store.
+// They are shared by the HTTP handlers and MemoryClient so that both return
+// the same results and errors.
+
+// Error is an error response of an operation. Dropbox errors are sent as
+// JSON, other errors as plain text.
+type Error struct {
+	StatusCode int
+	Dropbox    *dropboxclient.DropboxError
+	Text       string
+}
+
+func (e *Error) Error() string {
+	if e.Dropbox != nil {
+		return e.Dropbox.ErrorSummary
+	}
+	return e.Text
+}
+
+func textError(statusCode int, text string) *Error {
+	return &Error{
+		StatusCode: statusCode,
+		Text:       text,
+	}
+}
+
+func conflictError(summary string, details dropboxclient.DropboxErrorDetails) *Error {
+	return &Error{
+		StatusCode: http.StatusConflict,
+		Dropbox: &dropboxclient.DropboxError{
+			ErrorSummary: summary,
+			Err:          details,
+		},
+	}
+}
+
+func internalServerError() *Error {
+	return textError(http.StatusInternalServerError, "Internal server error")
+}
+
+func invalidPathError() *Error {
+	return textError(http.StatusInternalServerError, "Invalid path")
+}
+
+func pathError(tag string) *Error {
+	return conflictError("path/"+tag+"/..", dropboxclient.DropboxErrorDetails{
+		Tag: "path",
+		Path: &dropboxclient.LookupError{
+			Tag: tag,
+		},
+	})
+}
+
+func pathNotFoundError() *Error {
+	return pathError("not_found")
+}
+
+func pathLookupNotFoundError() *Error {
+	return conflictError("path_lookup/not_found/", dropboxclient.DropboxErrorDetails{
+		Tag: "path_lookup",
+		PathLookup: &dropboxclient.LookupError{
+			Tag: "not_found",
+		},
+	})
+}
+
+func fromLookupNotFoundError() *Error {
+	return conflictError("from_lookup/not_found/..", dropboxclient.DropboxErrorDetails{
+		Tag: "from_lookup",
+		FromLookup: &dropboxclient.LookupError{
+			Tag: "not_found",
+		},
+	})
+}
+
+func toConflictError(kind string) *Error {
+	return conflictError("to/conflict/"+kind+"/..", dropboxclient.DropboxErrorDetails{
+		Tag: "to",
+		To: &dropboxclient.LookupError{
+			Tag: "conflict",
+		},
+	})
+}
+
+func relocationError(tag string) *Error {
+	return conflictError(tag+"/..", dropboxclient.DropboxErrorDetails{
+		Tag: tag,
+	})
+}
+
+func pathConflictError() *Error {
+	return conflictError("path/conflict/file/...", dropboxclient.DropboxErrorDetails{
+		Tag: "path",
+		Path: &dropboxclient.LookupError{
+			Tag: "conflict",
+		},
+	})
+}
+
+func validPath(path string) *Error {
+	if !pathutils.IsPathValid(path) {
+		return invalidPathError()
+	}
+	return nil
+}
+
+func validPathOrID(path string) *Error {
+	if isPathID(path) {
+		return nil
+	}
+	return validPath(path)
+}
+
+func buildCursor(cursor *Cursor) string {
+	data, _ := json.Marshal(cursor)
+	return base64.StdEncoding.EncodeToString(data)
+}
+
+func parseCursor(route string, cursor string) (c *Cursor, err *Error) {
+	invalid := textError(http.StatusBadRequest, "Error in call to API function \""+route+"\": Invalid \"cursor\" parameter: '"+cursor+"'")
+	data, decodeErr := base64.StdEncoding.DecodeString(cursor)
+	if decodeErr != nil {
+		return nil, invalid
+	}
+	c = &Cursor{}
+	if jsonErr := json.Unmarshal(data, &c); jsonErr != nil {
+		return nil, invalid
+	}
+	return c, nil
+}
+
+func (s *Store) usersGetSpaceUsage() *dropboxclient.SpaceUsage {
+	spaceUsed, _ := s.GetSpaceUsage()
+	allocation, spaceAllocated := s.GetSpaceAllocation()
+
+	usage := &dropboxclient.SpaceUsage{
+		Used: spaceUsed,
+		Allocation: &dropboxclient.SpaceAllocation{
+			Tag:       allocation,
+			Allocated: spaceAllocated,
+		},
+	}
+	if allocation == dropboxclient.SpaceAllocationTeam {
+		// the account is the only member of the team
+		usage.Allocation.Used = spaceUsed
+	}
+	return usage
+}
+
+func (s *Store) filesCreateFolder(arg *dropboxclient.CreateFolderArg) (*dropboxclient.Metadata, *Error) {
+	if err := validPath(arg.Path); err != nil {
+		return nil, err
+	}
+	parentItem, ok := s.GetItemByPath(gopath.Dir(arg.Path))
+	if !ok {
+		return nil, pathNotFoundError()
+	}
+	item, ok := s.CreateFolder(parentItem, arg.Path)
+	if !ok {
+		return nil, pathConflictError()
+	}
+	mdCopy := *item.Metadata
+	mdCopy.Tag = ""
+	return &mdCopy, nil
+}
+
+func (s *Store) filesGetMetadata(arg *dropboxclient.GetMetadataArg) (*dropboxclient.Metadata, *Error) {
+	if err := validPathOrID(arg.Path); err != nil {
+		return nil, err
+	}
+	item, ok := s.GetItemByPathOrID(arg.Path)
+	if !ok {
+		return nil, pathNotFoundError()
+	}
+	if item.Metadata.Id == "" {
+		return nil, textError(http.StatusBadRequest, "Error in call to API function \"files/get_metadata\": request body: path: The root folder is unsupported.")
+	}
+	return item.Metadata, nil
+}
+
+func cursorResetError() *Error {
+	return conflictError("reset/..", dropboxclient.DropboxErrorDetails{
+		Tag: "reset",
+	})
+}
+
+// inListing reports whether a tombstone at pathLower is listed for the
+// folder at folderPathLower: a child of the folder, or any descendant if
+// recursive is set.
+func inListing(folderPathLower string, recursive bool, pathLower string) bool {
+	prefix := folderPathLower + "/"
+	if !strings.HasPrefix(pathLower, prefix) {
+		return false
+	}
+	return recursive || !strings.Contains(pathLower[len(prefix):], "/")
+}
+
+// listFolder lists the changes of the folder of cursor after its
+// LastChangeID. Tombstones are listed when a cursor is continued, and on the
+// initial listing (initial is set) only if includeDeleted is set, for paths
+// with no current item.
+func (s *Store) listFolder(cursor *Cursor, initial bool, includeDeleted bool) (*dropboxclient.ListFolderResult, *Error) {
+	nextChangeID := s.GetCurrentChangeID()
+	item, ok := s.GetItemByID(cursor.ID)
+	if !ok {
+		return nil, pathNotFoundError()
+	}
+	if !initial && cursor.LastChangeID < s.GetDeletedSince() {
+		return nil, cursorResetError()
+	}
+	items := []*Item{}
+	addEntry := func(item *Item) {
+		if item.ChangeID > cursor.LastChangeID {
+			items = append(items, item)
+		}
+	}
+	var addEntries func(item *Item)
+	addEntries = func(item *Item) {
+		for _, child := range item.Children {
+			addEntry(child)
+			if cursor.Recursive {
+				addEntries(child)
+			}
+		}
+	}
+	if cursor.Recursive && item.Metadata.Id != "" {
+		addEntry(item)
+	}
+	addEntries(item)
+	folderPathLower := item.Metadata.PathLower
+	if !initial {
+		for _, deletedItem := range s.GetDeletedItems() {
+			if inListing(folderPathLower, cursor.Recursive, deletedItem.Metadata.PathLower) {
+				addEntry(deletedItem)
+			}
+		}
+	} else if includeDeleted {
+		latest := map[string]*Item{}
+		for _, deletedItem := range s.GetDeletedItems() {
+			pathLower := deletedItem.Metadata.PathLower
+			if !inListing(folderPathLower, cursor.Recursive, pathLower) {
+				continue
+			}
+			if _, ok := s.GetItemByPath(pathLower); ok {
+				continue
+			}
+			latest[pathLower] = deletedItem
+		}
+		for _, deletedItem := range latest {
+			addEntry(deletedItem)
+		}
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].ChangeID < items[j].ChangeID
+	})
+	entries := make([]*dropboxclient.Metadata, len(items))
+	for i, item := range items {
+		entries[i] = item.Metadata
+	}
+	return &dropboxclient.ListFolderResult{
+		Entries: entries,
+		HasMore: false,
+		Cursor: buildCursor(&Cursor{
+			AccountID:    s.AccountID(),
+			ID:           cursor.ID,
+			Recursive:    cursor.Recursive,
+			LastChangeID: nextChangeID,
+		}),
+	}, nil
+}
+
+func (s *Store) filesListFolder(arg *dropboxclient.ListFolderArg) (*dropboxclient.ListFolderResult, *Error) {
+	if err := validPathOrID(arg.Path); err != nil {
+		return nil, err
+	}
+	item, ok := s.GetItemByPathOrID(arg.Path)
+	if !ok {
+		return nil, pathNotFoundError()
+	}
+	if item.Metadata.Tag == dropboxclient.MetadataFile {
+		return nil, pathError("not_folder")
+	}
+	return s.listFolder(&Cursor{
+		ID:           item.Metadata.Id,
+		Recursive:    arg.Recursive,
+		LastChangeID: 0,
+	}, true, arg.IncludeDeleted)
+}
+
+func (s *Store) filesListFolderContinue(arg *dropboxclient.ListFolderContinueArg) (*dropboxclient.ListFolderResult, *Error) {
+	cursor, err := parseCursor("files/list_folder/continue", arg.Cursor)
+	if err != nil {
+		return nil, err
+	}
+	return s.listFolder(cursor, false, false)
+}
+
+func (s *Store) filesDelete(arg *dropboxclient.DeleteArg) (*dropboxclient.Metadata, *Error) {
+	if err := validPathOrID(arg.Path); err != nil {
+		return nil, err
+	}
+	item, ok := s.GetItemByPathOrID(arg.Path)
+	if !ok {
+		return nil, pathLookupNotFoundError()
+	}
+	s.Delete(item)
+	return item.Metadata, nil
+}
+
+func (s *Store) relocationItems(arg *dropboxclient.RelocationArg) (item *Item, newParentItem *Item, err *Error) {
+	if err := validPathOrID(arg.FromPath); err != nil {
+		return nil, nil, err
+	}
+	if err := validPath(arg.ToPath); err != nil {
+		return nil, nil, err
+	}
+	item, ok := s.GetItemByPathOrID(arg.FromPath)
+	if !ok {
+		return nil, nil, fromLookupNotFoundError()
+	}
+	newParentItem, ok = s.GetItemByPath(gopath.Dir(arg.ToPath))
+	if !ok {
+		return nil, nil, pathLookupNotFoundError()
+	}
+	if item.Metadata.Tag == dropboxclient.MetadataFolder && strings.HasPrefix(pathToLower(normalizePath(arg.ToPath)), item.Metadata.PathLower+"/") {
+		return nil, nil, relocationError("cant_move_folder_into_itself")
+	}
+	return item, newParentItem, nil
+}
+
+// relocationConflictError returns the to/conflict error for the item at
+// path.
+func (s *Store) relocationConflictError(path string) *Error {
+	kind := "file"
+	if item, ok := s.GetItemByPath(path); ok && item.Metadata.Tag == dropboxclient.MetadataFolder {
+		kind = "folder"
+	}
+	return toConflictError(kind)
+}
+
+func (s *Store) filesCopy(arg *dropboxclient.RelocationArg) (*dropboxclient.Metadata, *Error) {
+	item, newParentItem, err := s.relocationItems(arg)
+	if err != nil {
+		return nil, err
+	}
+	newItem, copyErr := s.Copy(item, newParentItem, arg.ToPath, arg.Autorename)
+	if copyErr == errInsufficientSpace {
+		return nil, relocationError("insufficient_quota")
+	}
+	if copyErr != nil {
+		return nil, s.relocationConflictError(arg.ToPath)
+	}
+	return newItem.Metadata, nil
+}
+
+func (s *Store) filesMove(arg *dropboxclient.RelocationArg) (*dropboxclient.Metadata, *Error) {
+	item, newParentItem, err := s.relocationItems(arg)
+	if err != nil {
+		return nil, err
+	}
+	toPath := normalizePath(arg.ToPath)
+	if pathToLower(toPath) == item.Metadata.PathLower && gopath.Base(toPath) == item.Metadata.Name {
+		return nil, relocationError("duplicated_or_nested_paths")
+	}
+	if !s.Move(item, newParentItem, arg.ToPath, arg.Autorename) {
+		return nil, s.relocationConflictError(arg.ToPath)
+	}
+	return item.Metadata, nil
+}
+
+func (s *Store) filesUploadSessionStart(reader io.Reader) (*dropboxclient.UploadSessionStartResult, *Error) {
+	upload, err := s.NewUpload()
+	if err != nil {
+		log.Printf("upload create error: %s", err)
+		return nil, internalServerError()
+	}
+	session := &UploadSession{
+		Id:     s.randomString(),
+		Upload: upload,
+	}
+	if _, err := io.Copy(session.Upload, reader); err != nil {
+		upload.Discard()
+		return nil, textError(http.StatusInternalServerError, "Upload copy error")
+	}
+	s.AddSession(session)
+	return &dropboxclient.UploadSessionStartResult{
+		SessionId: session.Id,
+	}, nil
+}
+
+func (s *Store) filesUploadSessionAppend(arg *dropboxclient.UploadSessionCursor, reader io.Reader) *Error {
+	session, ok := s.GetSession(arg.SessionId)
+	if !ok {
+		return textError(http.StatusInternalServerError, fmt.Sprintf("Invalid session id: %s", arg.SessionId))
+	}
+	if err := session.Upload.Truncate(arg.Offset); err != nil {
+		return textError(http.StatusInternalServerError, fmt.Sprintf("Invalid offset: %d", arg.Offset))
+	}
+	if _, err := io.Copy(session.Upload, reader); err != nil {
+		return textError(http.StatusInternalServerError, "Upload copy error")
+	}
+	return nil
+}
+
+func (s *Store) filesUploadSessionFinish(arg *dropboxclient.UploadSessionFinishArg) (*dropboxclient.Metadata, *Error) {
+	session, ok := s.GetSession(arg.Cursor.SessionId)
+	if !ok {
+		return nil, textError(http.StatusInternalServerError, fmt.Sprintf("Invalid session id: %s", arg.Cursor.SessionId))
+	}
+	if err := validPath(arg.Commit.Path); err != nil {
+		return nil, err
+	}
+	parentItem, ok := s.GetItemByPath(gopath.Dir(arg.Commit.Path))
+	if !ok {
+		return nil, pathLookupNotFoundError()
+	}
+	var clientModifiedOpt *time.Time
+	if arg.Commit.ClientModified != nil {
+		clientModified, err := time.Parse(dropboxclient.DropboxClientModifiedFormat, *arg.Commit.ClientModified)
+		if err != nil {
+			return nil, textError(http.StatusInternalServerError, fmt.Sprintf("Invalid client modified time format: %s", err))
+		}
+		clientModifiedOpt = &clientModified
+	}
+	blob, err := s.CommitUpload(session.Upload)
+	if err != nil {
+		log.Printf("upload commit error: %s", err)
+		return nil, internalServerError()
+	}
+	defer s.ReleaseBlob(blob)
+	item, err := s.CreateFile(blob, parentItem, arg.Commit.Path, arg.Commit.Autorename, clientModifiedOpt, arg.Commit.Mode.Tag, arg.Commit.Mode.Update)
+	switch err {
+	case nil:
+	case errConflict:
+		return nil, pathConflictError()
+	case errInsufficientSpace:
+		return nil, pathError("insufficient_space")
+	default:
+		return nil, conflictError("other/...", dropboxclient.DropboxErrorDetails{
+			Tag: "other",
+		})
+	}
+	s.DeleteSession(session)
+	mdCopy := *item.Metadata
+	mdCopy.Tag = ""
+	return &mdCopy, nil
+}
+
+// download is the result of files/download. Content must be closed.
+// ContentRange is set if a range was requested.
+type download struct {
+	Metadata     *dropboxclient.Metadata
+	Content      io.ReadCloser
+	Length       int64
+	ContentRange string
+}
+
+type blobReader struct {
+	*io.SectionReader
+	io.Closer
+}
+
+func (s *Store) filesDownload(arg *dropboxclient.DownloadArg, rng string) (*download, *Error) {
+	if err := validPathOrID(arg.Path); err != nil {
+		return nil, err
+	}
+	item, ok := s.GetItemByPathOrID(arg.Path)
+	if !ok {
+		return nil, pathNotFoundError()
+	}
+	if item.Metadata.Tag != dropboxclient.MetadataFile {
+		return nil, conflictError("unsupported_file/...", dropboxclient.DropboxErrorDetails{
+			Tag: "unsupported_file",
+		})
+	}
+	start, length := int64(0), item.Metadata.Size
+	contentRange := ""
+	if rng != "" {
+		spans, _, err := httputils.ParseRange(rng, item.Metadata.Size)
+		if err != nil {
+			return nil, textError(http.StatusRequestedRangeNotSatisfiable, "Invalid range")
+		}
+		if len(spans) != 1 {
+			return nil, textError(http.StatusBadRequest, "Multiple ranges not supported")
+		}
+		span := spans[0]
+		start, length = span.Start, span.End-span.Start+1
+		contentRange = fmt.Sprintf("bytes %d-%d/%d", span.Start, span.End, item.Metadata.Size)
+	}
+	blob, err := s.OpenBlob(item)
+	if err != nil {
+		log.Printf("blob open error: %s", err)
+		return nil, internalServerError()
+	}
+	return &download{
+		Metadata:     item.Metadata,
+		Content:      blobReader{io.NewSectionReader(blob, start, length), blob},
+		Length:       length,
+		ContentRange: contentRange,
+	}, nil
+}
@@ -0,0 +1,143 @@
+package mockdropbox
+
+import (
+	"hash/fnv"
+	"sync"
+	"time"
+
+	dropboxclient "github.com/koofr/go-dropboxclient"
+)
+
+// Clock returns the time used for server_modified and default
+// client_modified times.
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// SystemClock is the wall clock.
+var SystemClock Clock = systemClock{}
+
+// FakeClock is a Clock that only moves when it is set or advanced, and
+// optionally by Step after every call to Now.
+type FakeClock struct {
+	now   time.Time
+	step  time.Duration
+	mutex sync.Mutex
+}
+
+// NewFakeClock returns a clock that starts at start and advances by step
+// after every call to Now.
+func NewFakeClock(start time.Time, step time.Duration) *FakeClock {
+	return &FakeClock{
+		now:  start,
+		step: step,
+	}
+}
+
+func (c *FakeClock) Now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	now := c.now
+	c.now = c.now.Add(c.step)
+	return now
+}
+
+func (c *FakeClock) Set(now time.Time) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.now = now
+}
+
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.now = c.now.Add(d)
+}
+
+// DefaultSpaceAllocated is the quota of a store, 2 GiB.
+const DefaultSpaceAllocated int64 = 2 * 1024 * 1024 * 1024
+
+type storeOptions struct {
+	clock           Clock
+	seed            int64
+	seeded          bool
+	seedSalt        string
+	spaceAllocation string
+	spaceAllocated  int64
+	deletedLimit    int
+}
+
+type StoreOption func(o *storeOptions)
+
+// WithClock makes the store take times from clock instead of the wall
+// clock.
+func WithClock(clock Clock) StoreOption {
+	return func(o *storeOptions) {
+		o.clock = clock
+	}
+}
+
+// WithSeed seeds the generation of account IDs, file IDs, revs and upload
+// session IDs. Together with WithClock the same sequence of operations
+// yields identical responses.
+func WithSeed(seed int64) StoreOption {
+	return func(o *storeOptions) {
+		o.seed = seed
+		o.seeded = true
+	}
+}
+
+// WithSpaceAllocation sets the allocation type reported by
+// users/get_space_usage, dropboxclient.SpaceAllocationIndividual or
+// dropboxclient.SpaceAllocationTeam, and the quota in bytes. Uploads and
+// copies that do not fit in the quota fail.
+func WithSpaceAllocation(allocation string, spaceAllocated int64) StoreOption {
+	return func(o *storeOptions) {
+		o.spaceAllocation = allocation
+		o.spaceAllocated = spaceAllocated
+	}
+}
+
+// WithDeletedLimit keeps at most limit tombstones. Older ones are dropped,
+// and continuing a cursor from before them fails with a reset error.
+func WithDeletedLimit(limit int) StoreOption {
+	return func(o *storeOptions) {
+		o.deletedLimit = limit
+	}
+}
+
+// withSeedSalt derives the seed from salt as well, so that the stores of
+// different access tokens in a seeded mock have different IDs.
+func withSeedSalt(salt string) StoreOption {
+	return func(o *storeOptions) {
+		o.seedSalt = salt
+	}
+}
+
+func newStoreOptions(opts []StoreOption) *storeOptions {
+	o := &storeOptions{
+		clock:           SystemClock,
+		spaceAllocation: dropboxclient.SpaceAllocationIndividual,
+		spaceAllocated:  DefaultSpaceAllocated,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if !o.seeded {
+		o.seed = time.Now().UnixNano()
+	} else if o.seedSalt != "" {
+		h := fnv.New64a()
+		h.Write([]byte(o.seedSalt))
+		o.seed ^= int64(h.Sum64())
+	}
+	return o
+}
@@ -0,0 +1,341 @@
+package mockdropbox
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+const snapshotFileName = "snapshot.json"
+
+// Snapshot is a copy of the state of a Store. File content is referenced by
+// blob hash, so a snapshot can only be restored into a store with the same
+// backend unless it is written with WriteSnapshot and read with
+// ReadSnapshot.
+type Snapshot struct {
+	ChangeID int64 `json:"change_id"`
+	// Items are ordered so that parents come before their children.
+	Items   []*ItemRecord `json:"items"`
+	Deleted []*ItemRecord `json:"deleted"`
+	// DeletedSince is the change ID up to which tombstones were dropped.
+	DeletedSince int64            `json:"deleted_since,omitempty"`
+	Sessions     []*SessionRecord `json:"sessions"`
+}
+
+// SessionRecord is an upload session in a Snapshot.
+type SessionRecord struct {
+	Id   string `json:"id"`
+	Hash string `json:"hash"`
+}
+
+func copyItemRecord(rec *ItemRecord) *ItemRecord {
+	md := *rec.Metadata
+	return &ItemRecord{
+		Metadata: &md,
+		ParentId: rec.ParentId,
+		Hash:     rec.Hash,
+		ChangeID: rec.ChangeID,
+	}
+}
+
+// hashes returns the blob hashes referenced by the snapshot.
+func (snapshot *Snapshot) hashes() []string {
+	seen := map[string]bool{}
+	hashes := []string{}
+	add := func(hash string) {
+		if hash != "" && !seen[hash] {
+			seen[hash] = true
+			hashes = append(hashes, hash)
+		}
+	}
+	for _, rec := range snapshot.Items {
+		add(rec.Hash)
+	}
+	for _, session := range snapshot.Sessions {
+		add(session.Hash)
+	}
+	return hashes
+}
+
+// Snapshot returns a deep copy of the items, deleted items, change ID and
+// upload sessions of the store. The content of upload sessions is committed
+// to blobs. The blobs of the snapshot are kept while the store is open so
+// that it can be restored.
+func (s *Store) Snapshot() (*Snapshot, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	snapshot := &Snapshot{
+		ChangeID:     s.currentChangeID,
+		Items:        []*ItemRecord{},
+		Deleted:      []*ItemRecord{},
+		DeletedSince: s.deletedSince,
+		Sessions:     []*SessionRecord{},
+	}
+
+	var walk func(item *Item)
+	walk = func(item *Item) {
+		for _, child := range item.Children {
+			snapshot.Items = append(snapshot.Items, copyItemRecord(&ItemRecord{
+				Metadata: child.Metadata,
+				ParentId: child.ParentId,
+				Hash:     child.Hash,
+				ChangeID: child.ChangeID,
+			}))
+			walk(child)
+		}
+	}
+	walk(s.itemsByIds[""])
+
+	for _, item := range s.deletedItems {
+		snapshot.Deleted = append(snapshot.Deleted, copyItemRecord(&ItemRecord{
+			Metadata: item.Metadata,
+			ChangeID: item.ChangeID,
+		}))
+	}
+
+	for _, session := range s.uploadSessions {
+		blob, err := session.Upload.Commit()
+		if err != nil {
+			return nil, err
+		}
+		snapshot.Sessions = append(snapshot.Sessions, &SessionRecord{
+			Id:   session.Id,
+			Hash: blob.Hash,
+		})
+	}
+
+	for _, hash := range snapshot.hashes() {
+		s.retainBlob(hash)
+	}
+
+	return snapshot, nil
+}
+
+// Restore replaces the state of the store with a copy of snapshot. Upload
+// sessions started after the snapshot are discarded. If the store changed
+// since the snapshot, the change ID is not rewound and continuing a cursor
+// from before the restore fails with a reset error. The snapshot can be
+// restored again.
+func (s *Store) Restore(snapshot *Snapshot) error {
+	for _, hash := range snapshot.hashes() {
+		blob, err := s.backend.OpenBlob(hash)
+		if err != nil {
+			return fmt.Errorf("mockdropbox: restore blob %s: %w", hash, err)
+		}
+		blob.Close()
+	}
+
+	sessions := map[string]*UploadSession{}
+	for _, rec := range snapshot.Sessions {
+		session, err := s.restoreSession(rec)
+		if err != nil {
+			for _, session := range sessions {
+				session.Upload.Discard()
+			}
+			return err
+		}
+		sessions[session.Id] = session
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, session := range s.uploadSessions {
+		session.Upload.Discard()
+	}
+	s.uploadSessions = sessions
+
+	// the snapshot may be restored again
+	for _, hash := range snapshot.hashes() {
+		s.retainBlob(hash)
+	}
+
+	changeID := snapshot.ChangeID
+	deletedSince := snapshot.DeletedSince
+	if s.currentChangeID > changeID {
+		// cursors can not list the rolled back changes, so change IDs keep
+		// increasing and the cursors from before the restore are reset
+		changeID = s.nextChangeID()
+		deletedSince = changeID
+	}
+
+	entries := []*JournalEntry{{Reset: &changeID}}
+	for _, rec := range snapshot.Items {
+		entries = append(entries, &JournalEntry{Put: copyItemRecord(rec)})
+	}
+	for _, rec := range snapshot.Deleted {
+		entries = append(entries, &JournalEntry{Deleted: copyItemRecord(rec)})
+	}
+	if deletedSince > 0 {
+		entries = append(entries, &JournalEntry{Compact: &deletedSince})
+	}
+
+	for _, entry := range entries {
+		if err := s.apply(entry); err != nil {
+			return fmt.Errorf("mockdropbox: restore: %w", err)
+		}
+		s.journal(entry)
+	}
+
+	return nil
+}
+
+func (s *Store) restoreSession(rec *SessionRecord) (*UploadSession, error) {
+	blob, err := s.backend.OpenBlob(rec.Hash)
+	if err != nil {
+		return nil, err
+	}
+	defer blob.Close()
+
+	upload, err := s.backend.NewUpload()
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := io.Copy(upload, io.NewSectionReader(blob, 0, blob.Size())); err != nil {
+		upload.Discard()
+		return nil, err
+	}
+
+	return &UploadSession{
+		Id:     rec.Id,
+		Upload: upload,
+	}, nil
+}
+
+// WriteSnapshot writes snapshot with the content of its blobs as a tar
+// archive.
+func (s *Store) WriteSnapshot(snapshot *Snapshot, w io.Writer) error {
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+
+	tw := tar.NewWriter(w)
+
+	err = tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     snapshotFileName,
+		Mode:     0644,
+		Size:     int64(len(data)),
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := tw.Write(data); err != nil {
+		return err
+	}
+
+	for _, hash := range snapshot.hashes() {
+		blob, err := s.backend.OpenBlob(hash)
+		if err != nil {
+			return err
+		}
+		err = tw.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     "blobs/" + hash,
+			Mode:     0644,
+			Size:     blob.Size(),
+		})
+		if err == nil {
+			_, err = io.Copy(tw, io.NewSectionReader(blob, 0, blob.Size()))
+		}
+		blob.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	return tw.Close()
+}
+
+// ReadSnapshot reads a snapshot written by WriteSnapshot and stores its
+// blobs in the backend of the store, where they are kept while the store is
+// open.
+func (s *Store) ReadSnapshot(r io.Reader) (*Snapshot, error) {
+	var snapshot *Snapshot
+
+	tr := tar.NewReader(r)
+
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case header.Name == snapshotFileName:
+			snapshot = &Snapshot{}
+			if err := json.NewDecoder(tr).Decode(snapshot); err != nil {
+				return nil, fmt.Errorf("mockdropbox: read snapshot: %w", err)
+			}
+
+		case strings.HasPrefix(header.Name, "blobs/"):
+			if err := s.readBlob(strings.TrimPrefix(header.Name, "blobs/"), tr); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if snapshot == nil {
+		return nil, fmt.Errorf("mockdropbox: read snapshot: %s missing", snapshotFileName)
+	}
+
+	return snapshot, nil
+}
+
+func (s *Store) readBlob(hash string, r io.Reader) error {
+	upload, err := s.backend.NewUpload()
+	if err != nil {
+		return err
+	}
+	defer upload.Discard()
+
+	if _, err := io.Copy(upload, r); err != nil {
+		return err
+	}
+
+	blob, err := s.CommitUpload(upload)
+	if err != nil {
+		return err
+	}
+	if blob.Hash != hash {
+		s.ReleaseBlob(blob)
+		return fmt.Errorf("mockdropbox: read snapshot: blob %s has hash %s", hash, blob.Hash)
+	}
+
+	return nil
+}
+
+// SaveSnapshot writes snapshot to the file at path.
+func (s *Store) SaveSnapshot(snapshot *Snapshot, path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if err := s.WriteSnapshot(snapshot, f); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// LoadSnapshot reads a snapshot from the file at path.
+func (s *Store) LoadSnapshot(path string) (*Snapshot, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return s.ReadSnapshot(f)
+}
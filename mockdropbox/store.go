@@ -1,9 +1,9 @@
 package mockdropbox
 
 import (
-	"bytes"
-	"crypto/md5"
-	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
 	"math/rand"
 	gopath "path"
 	"regexp"
@@ -19,16 +19,21 @@ var idRegexp = regexp.MustCompile("^id:.*$")
 
 var randomIdRunes = []rune("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ")
 
+var errConflict = errors.New("mockdropbox: conflict")
+var errInsufficientSpace = errors.New("mockdropbox: insufficient space")
+
 type Item struct {
 	Metadata *dropboxclient.Metadata
 	ParentId string
 	Children []*Item
-	Data     []byte
+	// Hash is the MD5 hash of the content of a file and the name of its
+	// blob.
 	Hash     string
 	ChangeID int64
 }
 
 type Cursor struct {
+	AccountID    string
 	ID           string
 	Recursive    bool
 	LastChangeID int64
@@ -36,7 +41,7 @@ type Cursor struct {
 
 type UploadSession struct {
 	Id     string
-	Buffer *bytes.Buffer
+	Upload Upload
 }
 
 func normalizePath(path string) string {
@@ -51,43 +56,60 @@ func pathToLower(path string) string {
 	return strings.ToLower(path)
 }
 
-func randomString() string {
-	str := make([]rune, 22)
-	for i := range str {
-		str[i] = randomIdRunes[rand.Intn(len(randomIdRunes))]
-	}
-	return string(str)
-}
-
-func generateId() string {
-	return "id:" + randomString()
-}
-
 func isPathID(path string) bool {
 	return idRegexp.MatchString(path)
 }
 
 type Store struct {
+	accountID       string
+	clock           Clock
+	rand            *rand.Rand
+	randMutex       sync.Mutex
+	onChange        func(accountID string)
+	backend         Backend
 	itemsByIds      map[string]*Item
 	itemsByPaths    map[string]*Item
 	deletedItems    []*Item
+	deletedSince    int64
+	deletedLimit    int
 	uploadSessions  map[string]*UploadSession
 	currentChangeID int64
 	spaceUsed       int64
+	spaceAllocation string
 	spaceAllocated  int64
 
+	// blobRefs counts the files, snapshots and pending commits that
+	// reference each blob. A blob is removed when its count drops to zero.
+	blobRefs  map[string]int
+	replaying bool
+
 	mutex sync.RWMutex
 }
 
-func NewStore() *Store {
+// NewStore returns an empty store kept in memory.
+func NewStore(opts ...StoreOption) *Store {
+	s, _ := NewStoreWithBackend(NewMemoryBackend(), opts...)
+	return s
+}
+
+// NewStoreWithBackend opens a store kept in backend, replaying its journal.
+func NewStoreWithBackend(backend Backend, opts ...StoreOption) (*Store, error) {
+	o := newStoreOptions(opts)
+
 	s := &Store{
+		clock:           o.clock,
+		rand:            rand.New(rand.NewSource(o.seed)),
+		backend:         backend,
 		itemsByIds:      map[string]*Item{},
 		itemsByPaths:    map[string]*Item{},
 		deletedItems:    []*Item{},
+		deletedLimit:    o.deletedLimit,
 		uploadSessions:  map[string]*UploadSession{},
+		blobRefs:        map[string]int{},
 		currentChangeID: 0,
 		spaceUsed:       0,
-		spaceAllocated:  2 * 1024 * 1024 * 1024,
+		spaceAllocation: o.spaceAllocation,
+		spaceAllocated:  o.spaceAllocated,
 	}
 
 	rootItem := &Item{
@@ -104,18 +126,235 @@ func NewStore() *Store {
 	s.itemsByIds[""] = rootItem
 	s.itemsByPaths[""] = rootItem
 
-	return s
+	s.replaying = true
+	if err := backend.ReplayJournal(s.apply); err != nil {
+		return nil, err
+	}
+	s.replaying = false
+
+	// blobs are only removed once the replay settled which are still used
+	for hash, refs := range s.blobRefs {
+		if refs <= 0 {
+			s.removeBlob(hash)
+		}
+	}
+
+	if s.currentChangeID > 0 {
+		// the replay does not advance the generator, continue from a
+		// different sequence so that new IDs do not repeat the replayed ones
+		s.rand = rand.New(rand.NewSource(o.seed + s.currentChangeID))
+	}
+
+	if s.accountID == "" {
+		s.accountID = "dbid:" + s.randomString()
+		if err := backend.AppendJournal(&JournalEntry{AccountID: s.accountID}); err != nil {
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+// Close closes the backend of the store.
+func (s *Store) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.backend.Close()
+}
+
+// apply applies a replayed journal entry.
+func (s *Store) apply(entry *JournalEntry) error {
+	var changeID int64
+
+	switch {
+	case entry.AccountID != "":
+		s.accountID = entry.AccountID
+
+	case entry.Put != nil:
+		rec := entry.Put
+		parentItem, ok := s.itemsByIds[rec.ParentId]
+		if !ok {
+			return fmt.Errorf("parent of %s not found: %s", rec.Metadata.Id, rec.ParentId)
+		}
+		item, ok := s.itemsByIds[rec.Metadata.Id]
+		s.retainBlob(rec.Hash)
+		if ok {
+			s.releaseBlob(item.Hash)
+			s.spaceUsed -= fileSize(item.Metadata)
+			if item.ParentId != rec.ParentId {
+				s.unlink(item)
+				parentItem.Children = append(parentItem.Children, item)
+			}
+			if s.itemsByPaths[item.Metadata.PathLower] == item {
+				delete(s.itemsByPaths, item.Metadata.PathLower)
+			}
+		} else {
+			item = &Item{
+				Children: []*Item{},
+			}
+			parentItem.Children = append(parentItem.Children, item)
+			s.itemsByIds[rec.Metadata.Id] = item
+		}
+		item.Metadata = rec.Metadata
+		s.spaceUsed += fileSize(item.Metadata)
+		item.ParentId = rec.ParentId
+		item.Hash = rec.Hash
+		item.ChangeID = rec.ChangeID
+		s.itemsByPaths[item.Metadata.PathLower] = item
+		changeID = rec.ChangeID
+
+	case entry.Remove != "":
+		item, ok := s.itemsByIds[entry.Remove]
+		if !ok {
+			return fmt.Errorf("removed item not found: %s", entry.Remove)
+		}
+		s.unlink(item)
+		s.spaceUsed -= fileSize(item.Metadata)
+		s.releaseBlob(item.Hash)
+		delete(s.itemsByIds, item.Metadata.Id)
+		if s.itemsByPaths[item.Metadata.PathLower] == item {
+			delete(s.itemsByPaths, item.Metadata.PathLower)
+		}
+
+	case entry.Deleted != nil:
+		s.deletedItems = append(s.deletedItems, &Item{
+			Metadata: entry.Deleted.Metadata,
+			ChangeID: entry.Deleted.ChangeID,
+		})
+		changeID = entry.Deleted.ChangeID
+
+	case entry.Reset != nil:
+		s.reset()
+		s.currentChangeID = *entry.Reset
+
+	case entry.Compact != nil:
+		s.compact(*entry.Compact)
+	}
+
+	if changeID > s.currentChangeID {
+		s.currentChangeID = changeID
+	}
+
+	return nil
+}
+
+// reset removes all items except the root.
+func (s *Store) reset() {
+	for _, item := range s.itemsByIds {
+		s.releaseBlob(item.Hash)
+	}
+	rootItem := s.itemsByIds[""]
+	rootItem.Children = []*Item{}
+	s.itemsByIds = map[string]*Item{"": rootItem}
+	s.itemsByPaths = map[string]*Item{"": rootItem}
+	s.deletedItems = []*Item{}
+	s.deletedSince = 0
+	s.spaceUsed = 0
+}
+
+// compact drops the tombstones up to and including changeID. Cursors from
+// before changeID can not be continued any more.
+func (s *Store) compact(changeID int64) {
+	deletedItems := []*Item{}
+	for _, item := range s.deletedItems {
+		if item.ChangeID > changeID {
+			deletedItems = append(deletedItems, item)
+		}
+	}
+	s.deletedItems = deletedItems
+	s.deletedSince = changeID
+}
+
+// unlink removes item from the children of its parent.
+func (s *Store) unlink(item *Item) {
+	parentItem, ok := s.itemsByIds[item.ParentId]
+	if !ok {
+		return
+	}
+	newChildren := []*Item{}
+	for _, child := range parentItem.Children {
+		if child != item {
+			newChildren = append(newChildren, child)
+		}
+	}
+	parentItem.Children = newChildren
+}
+
+func (s *Store) retainBlob(hash string) {
+	if hash != "" {
+		s.blobRefs[hash]++
+	}
+}
+
+// releaseBlob drops a reference to the blob and removes it if it is not
+// referenced any more. During the replay of the journal the blob is kept
+// because a later entry may reference it again.
+func (s *Store) releaseBlob(hash string) {
+	if hash == "" {
+		return
+	}
+	s.blobRefs[hash]--
+	if s.blobRefs[hash] <= 0 && !s.replaying {
+		s.removeBlob(hash)
+	}
+}
+
+func (s *Store) removeBlob(hash string) {
+	delete(s.blobRefs, hash)
+	if err := s.backend.RemoveBlob(hash); err != nil {
+		log.Printf("MockDropbox blob remove error: %s", err)
+	}
+}
+
+func (s *Store) journal(entry *JournalEntry) {
+	if err := s.backend.AppendJournal(entry); err != nil {
+		log.Printf("MockDropbox journal error: %s", err)
+	}
+}
+
+func (s *Store) journalPut(item *Item) {
+	s.journal(&JournalEntry{
+		Put: &ItemRecord{
+			Metadata: item.Metadata,
+			ParentId: item.ParentId,
+			Hash:     item.Hash,
+			ChangeID: item.ChangeID,
+		},
+	})
 }
 
 func (s *Store) TimeNow() time.Time {
-	return time.Now().UTC()
+	return s.clock.Now().UTC()
+}
+
+func (s *Store) randomString() string {
+	s.randMutex.Lock()
+	defer s.randMutex.Unlock()
+
+	str := make([]rune, 22)
+	for i := range str {
+		str[i] = randomIdRunes[s.rand.Intn(len(randomIdRunes))]
+	}
+	return string(str)
+}
+
+func (s *Store) generateId() string {
+	return "id:" + s.randomString()
 }
 
 func (s *Store) nextChangeID() int64 {
 	s.currentChangeID++
+	if s.onChange != nil {
+		s.onChange(s.accountID)
+	}
 	return s.currentChangeID
 }
 
+func (s *Store) AccountID() string {
+	return s.accountID
+}
+
 func (s *Store) GetCurrentChangeID() int64 {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
@@ -130,15 +369,105 @@ func (s *Store) GetSpaceUsage() (spaceUsed int64, spaceAllocated int64) {
 	return s.spaceUsed, s.spaceAllocated
 }
 
+// GetSpaceAllocation returns the allocation type, SpaceAllocationIndividual
+// or SpaceAllocationTeam, and the quota in bytes.
+func (s *Store) GetSpaceAllocation() (allocation string, spaceAllocated int64) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return s.spaceAllocation, s.spaceAllocated
+}
+
+// SetSpaceAllocation changes the allocation type and the quota. Files
+// already stored are kept if they exceed the new quota, but further uploads
+// and copies fail. The allocation is not persisted in the backend.
+func (s *Store) SetSpaceAllocation(allocation string, spaceAllocated int64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.spaceAllocation = allocation
+	s.spaceAllocated = spaceAllocated
+}
+
+// fileSize returns the space used by the content of the item with md.
+func fileSize(md *dropboxclient.Metadata) int64 {
+	if md.Tag != dropboxclient.MetadataFile {
+		return 0
+	}
+	return md.Size
+}
+
+// treeSize returns the space used by item and its descendants.
+func treeSize(item *Item) int64 {
+	size := fileSize(item.Metadata)
+	for _, child := range item.Children {
+		size += treeSize(child)
+	}
+	return size
+}
+
+// hasSpace reports whether size more bytes fit in the quota.
+func (s *Store) hasSpace(size int64) bool {
+	return size <= 0 || s.spaceUsed+size <= s.spaceAllocated
+}
+
+// childDisplayPath returns the path_display of a child of parentItem.
+func childDisplayPath(parentItem *Item, name string) string {
+	return parentItem.Metadata.PathDisplay + "/" + name
+}
+
+// destinationName returns the name of an item relocated to newPath in
+// newParentItem. If another item than self has the name, an unused name is
+// returned if autorename is set and ok is false otherwise.
+func destinationName(newParentItem *Item, newPath string, autorename bool, self *Item) (name string, ok bool) {
+	name = gopath.Base(newPath)
+
+	existingNames := map[string]bool{}
+	for _, child := range newParentItem.Children {
+		if child != self {
+			existingNames[pathToLower(child.Metadata.Name)] = true
+		}
+	}
+	if !existingNames[pathToLower(name)] {
+		return name, true
+	}
+	if !autorename {
+		return "", false
+	}
+
+	nameExists := func(name string) bool {
+		return existingNames[pathToLower(name)]
+	}
+	name, err := pathutils.UnusedFilename(nameExists, name, 1000)
+	if err != nil {
+		return "", false
+	}
+	return name, true
+}
+
 func (s *Store) deleteMetadata(md *dropboxclient.Metadata) {
-	s.deletedItems = append(s.deletedItems, &Item{
+	item := &Item{
 		Metadata: &dropboxclient.Metadata{
-			Tag:       dropboxclient.MetadataDeleted,
-			Name:      md.Name,
-			PathLower: md.PathLower,
+			Tag:         dropboxclient.MetadataDeleted,
+			Name:        md.Name,
+			PathLower:   md.PathLower,
+			PathDisplay: md.PathDisplay,
 		},
 		ChangeID: s.nextChangeID(),
+	}
+	s.deletedItems = append(s.deletedItems, item)
+	s.journal(&JournalEntry{
+		Deleted: &ItemRecord{
+			Metadata: item.Metadata,
+			ChangeID: item.ChangeID,
+		},
 	})
+
+	if s.deletedLimit > 0 && len(s.deletedItems) > s.deletedLimit {
+		changeID := s.deletedItems[len(s.deletedItems)-s.deletedLimit-1].ChangeID
+		s.compact(changeID)
+		s.journal(&JournalEntry{Compact: &changeID})
+	}
 }
 
 func (s *Store) CreateFolder(parentItem *Item, path string) (item *Item, ok bool) {
@@ -157,10 +486,11 @@ func (s *Store) CreateFolder(parentItem *Item, path string) (item *Item, ok bool
 	}
 
 	md := &dropboxclient.Metadata{
-		Tag:       "folder",
-		Id:        generateId(),
-		Name:      name,
-		PathLower: pathLower,
+		Tag:         "folder",
+		Id:          s.generateId(),
+		Name:        name,
+		PathLower:   pathLower,
+		PathDisplay: childDisplayPath(parentItem, name),
 	}
 
 	childItem := &Item{
@@ -172,24 +502,27 @@ func (s *Store) CreateFolder(parentItem *Item, path string) (item *Item, ok bool
 	parentItem.Children = append(parentItem.Children, childItem)
 	s.itemsByIds[md.Id] = childItem
 	s.itemsByPaths[md.PathLower] = childItem
+	s.journalPut(childItem)
 
 	return childItem, true
 }
 
-func (s *Store) CreateFile(session *UploadSession, parentItem *Item, path string, autorename bool, clientModifiedOpt *time.Time, mode string, modeUpdate string) (newItem *Item, ok bool, isConflict bool) {
+// CreateFile creates a file with the content of a committed upload. It
+// returns errConflict if the file exists and is not replaced and
+// errInsufficientSpace if the content does not fit in the quota.
+func (s *Store) CreateFile(blob *BlobInfo, parentItem *Item, path string, autorename bool, clientModifiedOpt *time.Time, mode string, modeUpdate string) (newItem *Item, err error) {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 
-	data := session.Buffer.Bytes()
-	md5Bytes := md5.Sum(data)
-	hash := hex.EncodeToString(md5Bytes[:])
+	hash := blob.Hash
+	contentHashHex := blob.ContentHash
 	path = pathutils.NormalizeName(path)
 	parentPath := gopath.Dir(path)
 	pathLower := pathToLower(path)
 	name := gopath.Base(path)
 	modified := s.TimeNow()
-	rev := randomString()
-	size := int64(len(data))
+	rev := s.randomString()
+	size := blob.Size
 
 	clientModified := modified
 	if clientModifiedOpt != nil {
@@ -205,16 +538,24 @@ func (s *Store) CreateFile(session *UploadSession, parentItem *Item, path string
 		}
 	}
 
-	if existingItem != nil && (mode == dropboxclient.WriteModeOverwrite || existingItem.Hash == hash) {
+	isUpdate := mode == dropboxclient.WriteModeUpdate && existingItem != nil && existingItem.Metadata.Rev == modeUpdate
+
+	if existingItem != nil && (mode == dropboxclient.WriteModeOverwrite || isUpdate || existingItem.Hash == hash) {
 		if existingItem.Metadata.Tag == dropboxclient.MetadataFolder {
-			return nil, false, true
+			return nil, errConflict
+		}
+		if !s.hasSpace(size - existingItem.Metadata.Size) {
+			return nil, errInsufficientSpace
 		}
+		s.spaceUsed += size - existingItem.Metadata.Size
+		s.retainBlob(hash)
+		s.releaseBlob(existingItem.Hash)
 		newItem = existingItem
 		newItem.Metadata.ClientModified = clientModified
 		newItem.Metadata.ServerModified = modified
 		newItem.Metadata.Rev = rev
 		newItem.Metadata.Size = size
-		newItem.Data = data
+		newItem.Metadata.ContentHash = contentHashHex
 		newItem.Hash = hash
 		newItem.ChangeID = s.nextChangeID()
 	} else {
@@ -224,31 +565,37 @@ func (s *Store) CreateFile(session *UploadSession, parentItem *Item, path string
 					_, ok := existingNames[pathToLower(name)]
 					return ok
 				}
-				var err error
 				name, err = pathutils.UnusedFilename(nameExists, name, 1000)
 				if err != nil {
-					return nil, false, false
+					return nil, err
 				}
 			} else {
-				return nil, false, true
+				return nil, errConflict
 			}
 		}
 
+		if !s.hasSpace(size) {
+			return nil, errInsufficientSpace
+		}
+		s.spaceUsed += size
+		s.retainBlob(hash)
+
 		md := &dropboxclient.Metadata{
 			Tag:            "file",
-			Id:             generateId(),
+			Id:             s.generateId(),
 			Name:           name,
 			PathLower:      pathToLower(gopath.Join(parentPath, name)),
+			PathDisplay:    childDisplayPath(parentItem, name),
 			ClientModified: clientModified,
 			ServerModified: modified,
 			Rev:            rev,
 			Size:           size,
+			ContentHash:    contentHashHex,
 		}
 		newItem = &Item{
 			Metadata: md,
 			ParentId: parentItem.Metadata.Id,
 			Children: []*Item{},
-			Data:     data,
 			Hash:     hash,
 			ChangeID: s.nextChangeID(),
 		}
@@ -257,7 +604,9 @@ func (s *Store) CreateFile(session *UploadSession, parentItem *Item, path string
 		s.itemsByPaths[md.PathLower] = newItem
 	}
 
-	return newItem, true, false
+	s.journalPut(newItem)
+
+	return newItem, nil
 }
 
 func (s *Store) Delete(item *Item) {
@@ -277,6 +626,9 @@ func (s *Store) Delete(item *Item) {
 	deleteFromItems = func(item *Item) {
 		delete(s.itemsByIds, item.Metadata.Id)
 		delete(s.itemsByPaths, item.Metadata.PathLower)
+		s.spaceUsed -= fileSize(item.Metadata)
+		s.releaseBlob(item.Hash)
+		s.journal(&JournalEntry{Remove: item.Metadata.Id})
 		s.deleteMetadata(item.Metadata)
 
 		for _, child := range item.Children {
@@ -286,97 +638,160 @@ func (s *Store) Delete(item *Item) {
 	deleteFromItems(item)
 }
 
-func (s *Store) copyMetadata(md *dropboxclient.Metadata, newPath string) *dropboxclient.Metadata {
-	var newModified time.Time
-	if md.Tag == dropboxclient.MetadataFile {
-		newModified = s.TimeNow()
+// Reset removes all files, folders, deleted entries and upload sessions.
+// The account ID is kept and change IDs keep increasing.
+func (s *Store) Reset() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, session := range s.uploadSessions {
+		if err := session.Upload.Discard(); err != nil {
+			log.Printf("MockDropbox upload discard error: %s", err)
+		}
 	}
-	newPath = pathutils.NormalizeName(newPath)
-	return &dropboxclient.Metadata{
-		Tag:            md.Tag,
-		Id:             generateId(),
-		Name:           gopath.Base(newPath),
-		PathLower:      pathToLower(newPath),
-		ClientModified: md.ClientModified,
-		ServerModified: newModified,
+	s.uploadSessions = map[string]*UploadSession{}
+
+	s.reset()
+	changeID := s.nextChangeID()
+	s.journal(&JournalEntry{Reset: &changeID})
+
+	// the tombstones are gone, older cursors must be reset
+	s.compact(changeID)
+	s.journal(&JournalEntry{Compact: &changeID})
+}
+
+// CompactDeleted drops the tombstones up to and including changeID, or all
+// of them if changeID is 0, as Dropbox eventually does. Continuing a cursor
+// from before the dropped tombstones fails with a reset error.
+func (s *Store) CompactDeleted(changeID int64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if changeID == 0 || changeID > s.currentChangeID {
+		changeID = s.currentChangeID
 	}
+	if changeID <= s.deletedSince {
+		return
+	}
+
+	s.compact(changeID)
+	s.journal(&JournalEntry{Compact: &changeID})
 }
 
-func (s *Store) Copy(item *Item, newParentItem *Item, newPath string) *Item {
+// GetDeletedSince returns the change ID up to which tombstones were
+// dropped.
+func (s *Store) GetDeletedSince() int64 {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return s.deletedSince
+}
+
+func (s *Store) copyMetadata(md *dropboxclient.Metadata, newParentItem *Item, name string) *dropboxclient.Metadata {
+	newMd := &dropboxclient.Metadata{
+		Tag:         md.Tag,
+		Id:          s.generateId(),
+		Name:        name,
+		PathLower:   pathToLower(newParentItem.Metadata.PathLower + "/" + name),
+		PathDisplay: childDisplayPath(newParentItem, name),
+	}
+	if md.Tag == dropboxclient.MetadataFile {
+		newMd.ClientModified = md.ClientModified
+		newMd.ServerModified = s.TimeNow()
+		newMd.Rev = s.randomString()
+		newMd.Size = md.Size
+		newMd.ContentHash = md.ContentHash
+	}
+	return newMd
+}
+
+// Copy copies item and its descendants to newPath in newParentItem. Files
+// keep their content and get new revs. If newPath exists, the copy is
+// renamed if autorename is set and errConflict is returned otherwise. The
+// copies must fit in the quota or errInsufficientSpace is returned.
+func (s *Store) Copy(item *Item, newParentItem *Item, newPath string, autorename bool) (newItem *Item, err error) {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 
-	newPath = pathutils.NormalizeName(newPath)
+	name, ok := destinationName(newParentItem, pathutils.NormalizeName(newPath), autorename, nil)
+	if !ok {
+		return nil, errConflict
+	}
 
-	var cp func(item *Item, newParentItem *Item, newPath string) *Item
-	var copyChildren func(item *Item, newItem *Item)
+	size := treeSize(item)
+	if !s.hasSpace(size) {
+		return nil, errInsufficientSpace
+	}
+	s.spaceUsed += size
+
+	var cp func(item *Item, newParentItem *Item, name string) *Item
 
-	cp = func(item *Item, newParentItem *Item, newPath string) *Item {
+	cp = func(item *Item, newParentItem *Item, name string) *Item {
 		newItem := &Item{
-			Metadata: s.copyMetadata(item.Metadata, newPath),
+			Metadata: s.copyMetadata(item.Metadata, newParentItem, name),
 			ParentId: newParentItem.Metadata.Id,
 			Children: []*Item{},
+			Hash:     item.Hash,
 			ChangeID: s.nextChangeID(),
 		}
 		s.itemsByIds[newItem.Metadata.Id] = newItem
 		s.itemsByPaths[newItem.Metadata.PathLower] = newItem
 		newParentItem.Children = append(newParentItem.Children, newItem)
-		copyChildren(item, newItem)
-		return newItem
-	}
-
-	copyChildren = func(parent *Item, newParentItem *Item) {
-		for _, child := range parent.Children {
-			cp(child, newParentItem, gopath.Join(newParentItem.Metadata.PathLower, child.Metadata.Name))
+		s.retainBlob(newItem.Hash)
+		s.journalPut(newItem)
+		for _, child := range item.Children {
+			cp(child, newItem, child.Metadata.Name)
 		}
+		return newItem
 	}
 
-	return cp(item, newParentItem, newPath)
+	return cp(item, newParentItem, name), nil
 }
 
-func (s *Store) Move(item *Item, newParentItem *Item, newPath string) {
+// Move moves item to newPath in newParentItem. A path that only differs in
+// case renames the item in place. The old path is recorded as a single
+// deleted entry and the item and its descendants are listed again at the
+// new path, keeping their ids. If another item exists at newPath, the item
+// is renamed if autorename is set and the move fails otherwise.
+func (s *Store) Move(item *Item, newParentItem *Item, newPath string, autorename bool) (ok bool) {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 
-	newPath = pathutils.NormalizeName(newPath)
-
-	var mv func(item *Item, newParentItem *Item, newPath string)
-	var moveChildren func(item *Item)
+	name, ok := destinationName(newParentItem, pathutils.NormalizeName(newPath), autorename, item)
+	if !ok {
+		return false
+	}
 
-	mv = func(item *Item, newParentItem *Item, newPath string) {
-		if oldParent, ok := s.itemsByIds[item.ParentId]; ok {
-			newChildren := []*Item{}
-			for _, child := range oldParent.Children {
-				if child != item {
-					newChildren = append(newChildren, child)
-				}
-			}
-			oldParent.Children = newChildren
-		}
+	if pathToLower(newParentItem.Metadata.PathLower+"/"+name) != item.Metadata.PathLower {
 		s.deleteMetadata(item.Metadata)
+	}
 
-		delete(s.itemsByPaths, item.Metadata.PathLower)
-		item.Metadata.Name = gopath.Base(newPath)
-		item.Metadata.PathLower = pathToLower(newPath)
+	s.unlink(item)
+	newParentItem.Children = append(newParentItem.Children, item)
+	item.ParentId = newParentItem.Metadata.Id
+	item.Metadata.Name = name
+
+	var relocate func(item *Item, parentItem *Item)
+	relocate = func(item *Item, parentItem *Item) {
+		if s.itemsByPaths[item.Metadata.PathLower] == item {
+			delete(s.itemsByPaths, item.Metadata.PathLower)
+		}
+		item.Metadata.PathLower = pathToLower(parentItem.Metadata.PathLower + "/" + item.Metadata.Name)
+		item.Metadata.PathDisplay = childDisplayPath(parentItem, item.Metadata.Name)
 		if item.Metadata.Tag == dropboxclient.MetadataFile {
 			item.Metadata.ServerModified = s.TimeNow()
 		}
-		item.ParentId = newParentItem.Metadata.Id
 		item.ChangeID = s.nextChangeID()
 		s.itemsByPaths[item.Metadata.PathLower] = item
+		s.journalPut(item)
 
-		newParentItem.Children = append(newParentItem.Children, item)
-
-		moveChildren(item)
-	}
-
-	moveChildren = func(parent *Item) {
-		for _, child := range parent.Children {
-			mv(child, parent, gopath.Join(parent.Metadata.PathLower, child.Metadata.Name))
+		for _, child := range item.Children {
+			relocate(child, item)
 		}
 	}
+	relocate(item, newParentItem)
 
-	mv(item, newParentItem, newPath)
+	return true
 }
 
 func (s *Store) GetItemByPathOrID(path string) (item *Item, ok bool) {
@@ -427,8 +842,45 @@ func (s *Store) GetSession(id string) (session *UploadSession, ok bool) {
 }
 
 func (s *Store) DeleteSession(session *UploadSession) {
-	s.mutex.RLock()
-	defer s.mutex.RUnlock()
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
 
 	delete(s.uploadSessions, session.Id)
+
+	if err := session.Upload.Discard(); err != nil {
+		log.Printf("MockDropbox upload discard error: %s", err)
+	}
+}
+
+// NewUpload returns storage for the content of a new upload session.
+func (s *Store) NewUpload() (Upload, error) {
+	return s.backend.NewUpload()
+}
+
+// CommitUpload stores the content of upload as a blob that is kept until
+// ReleaseBlob is called, e.g. after CreateFile took its own reference.
+func (s *Store) CommitUpload(upload Upload) (*BlobInfo, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	blob, err := upload.Commit()
+	if err != nil {
+		return nil, err
+	}
+	s.retainBlob(blob.Hash)
+
+	return blob, nil
+}
+
+// ReleaseBlob drops the reference taken by CommitUpload.
+func (s *Store) ReleaseBlob(blob *BlobInfo) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.releaseBlob(blob.Hash)
+}
+
+// OpenBlob opens the content of a file.
+func (s *Store) OpenBlob(item *Item) (Blob, error) {
+	return s.backend.OpenBlob(item.Hash)
 }
@@ -0,0 +1,187 @@
+package mockdropbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+)
+
+// Transport returns an http.RoundTripper that serves requests with d in the
+// same process, without a TCP listener. Response bodies are streamed while
+// the handler runs, and a handler aborted with http.ErrAbortHandler ends the
+// body with io.ErrUnexpectedEOF, like a dropped connection.
+func (d *MockDropbox) Transport() http.RoundTripper {
+	return &transport{handler: d}
+}
+
+type transport struct {
+	handler http.Handler
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+
+	// parse the URL like a server would, clients may send opaque URLs
+	requestURI := req.URL.RequestURI()
+	serverURL, err := url.ParseRequestURI(requestURI)
+	if err != nil {
+		return nil, err
+	}
+
+	serverReq := req.Clone(ctx)
+	serverReq.URL = serverURL
+	serverReq.RequestURI = requestURI
+	serverReq.RemoteAddr = "127.0.0.1:0"
+	if serverReq.Body == nil {
+		serverReq.Body = http.NoBody
+	}
+	if serverReq.Host == "" {
+		serverReq.Host = req.URL.Host
+	}
+
+	pr, pw := io.Pipe()
+
+	w := &pipeResponseWriter{
+		header:      http.Header{},
+		pw:          pw,
+		headersSent: make(chan struct{}),
+	}
+
+	go func() {
+		defer func() {
+			if req.Body != nil {
+				req.Body.Close()
+			}
+		}()
+
+		defer func() {
+			if r := recover(); r != nil {
+				err := io.ErrUnexpectedEOF
+				if r != http.ErrAbortHandler {
+					log.Printf("MockDropbox handler panic: %v", r)
+					err = fmt.Errorf("mockdropbox: handler panic: %v", r)
+				}
+				w.abort(err)
+				pw.CloseWithError(err)
+				return
+			}
+			w.sendHeaders()
+			pw.Close()
+		}()
+
+		t.handler.ServeHTTP(w, serverReq)
+	}()
+
+	select {
+	case <-w.headersSent:
+		if w.err != nil {
+			return nil, w.err
+		}
+	case <-ctx.Done():
+		pr.CloseWithError(ctx.Err())
+		return nil, ctx.Err()
+	}
+
+	body := &pipeBody{
+		PipeReader: pr,
+		ctx:        ctx,
+		stop: context.AfterFunc(ctx, func() {
+			pr.CloseWithError(ctx.Err())
+		}),
+	}
+
+	res := &http.Response{
+		Status:        strconv.Itoa(w.status) + " " + http.StatusText(w.status),
+		StatusCode:    w.status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        w.sentHeader,
+		Body:          body,
+		ContentLength: -1,
+		Request:       req,
+	}
+
+	if cl := res.Header.Get("Content-Length"); cl != "" {
+		if n, err := strconv.ParseInt(cl, 10, 64); err == nil {
+			res.ContentLength = n
+		}
+	}
+
+	return res, nil
+}
+
+// pipeResponseWriter writes the response body into a pipe. The headers are
+// snapshotted on the first write, flush or when the handler returns.
+type pipeResponseWriter struct {
+	header      http.Header
+	sentHeader  http.Header
+	status      int
+	pw          *io.PipeWriter
+	headersOnce sync.Once
+	headersSent chan struct{}
+	// err is set if the handler was aborted before sending the headers.
+	err error
+}
+
+func (w *pipeResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *pipeResponseWriter) WriteHeader(status int) {
+	w.headersOnce.Do(func() {
+		w.status = status
+		w.sentHeader = w.header.Clone()
+		close(w.headersSent)
+	})
+}
+
+func (w *pipeResponseWriter) abort(err error) {
+	w.headersOnce.Do(func() {
+		w.err = err
+		close(w.headersSent)
+	})
+}
+
+func (w *pipeResponseWriter) sendHeaders() {
+	w.WriteHeader(http.StatusOK)
+}
+
+func (w *pipeResponseWriter) Write(p []byte) (int, error) {
+	w.sendHeaders()
+	return w.pw.Write(p)
+}
+
+func (w *pipeResponseWriter) Flush() {
+	w.sendHeaders()
+}
+
+// pipeBody is the response body. It fails reads once the request context
+// is done.
+type pipeBody struct {
+	*io.PipeReader
+	ctx  context.Context
+	stop func() bool
+}
+
+func (b *pipeBody) Read(p []byte) (int, error) {
+	if err := b.ctx.Err(); err != nil {
+		return 0, err
+	}
+	n, err := b.PipeReader.Read(p)
+	if err != nil && err != io.EOF && b.ctx.Err() != nil {
+		err = b.ctx.Err()
+	}
+	return n, err
+}
+
+func (b *pipeBody) Close() error {
+	b.stop()
+	return b.PipeReader.CloseWithError(errors.New("mockdropbox: response body closed"))
+}
@@ -0,0 +1,150 @@
+package mockdropbox
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/koofr/go-dropboxclient"
+)
+
+// webhookTimeout limits a notification request, like Dropbox which expects
+// a response within 10 seconds.
+const webhookTimeout = 10 * time.Second
+
+type webhook struct {
+	url       string
+	appSecret string
+	client    *http.Client
+
+	pending      map[string]bool
+	pendingMutex sync.Mutex
+	signal       chan struct{}
+	// ctx is canceled to stop the webhook, aborting a request in flight.
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// RegisterWebhook makes the mock POST signed list_folder notifications to url
+// whenever a change is made in any store. Changes made while a notification
+// is in flight are coalesced into the next one. Registering a new webhook
+// replaces the previous one.
+func (d *MockDropbox) RegisterWebhook(url string, appSecret string) {
+	d.UnregisterWebhook()
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	hook := &webhook{
+		url:       url,
+		appSecret: appSecret,
+		client:    &http.Client{Timeout: webhookTimeout},
+		pending:   map[string]bool{},
+		signal:    make(chan struct{}, 1),
+		ctx:       ctx,
+		cancel:    cancel,
+		done:      make(chan struct{}),
+	}
+
+	go hook.run()
+
+	d.webhookMutex.Lock()
+	d.webhook = hook
+	d.webhookMutex.Unlock()
+}
+
+// UnregisterWebhook stops sending notifications. Pending notifications are
+// dropped and a notification in flight is aborted.
+func (d *MockDropbox) UnregisterWebhook() {
+	d.webhookMutex.Lock()
+	hook := d.webhook
+	d.webhook = nil
+	d.webhookMutex.Unlock()
+
+	if hook != nil {
+		hook.cancel()
+		<-hook.done
+	}
+}
+
+func (d *MockDropbox) notifyWebhook(accountID string) {
+	d.webhookMutex.Lock()
+	hook := d.webhook
+	d.webhookMutex.Unlock()
+
+	if hook != nil {
+		hook.notify(accountID)
+	}
+}
+
+func (h *webhook) notify(accountID string) {
+	h.pendingMutex.Lock()
+	h.pending[accountID] = true
+	h.pendingMutex.Unlock()
+
+	select {
+	case h.signal <- struct{}{}:
+	default:
+	}
+}
+
+func (h *webhook) run() {
+	defer close(h.done)
+
+	for {
+		select {
+		case <-h.ctx.Done():
+			return
+		case <-h.signal:
+		}
+
+		h.pendingMutex.Lock()
+		accounts := make([]string, 0, len(h.pending))
+		for accountID := range h.pending {
+			accounts = append(accounts, accountID)
+		}
+		h.pending = map[string]bool{}
+		h.pendingMutex.Unlock()
+
+		if len(accounts) == 0 {
+			continue
+		}
+
+		sort.Strings(accounts)
+
+		if err := h.send(accounts); err != nil && h.ctx.Err() == nil {
+			log.Printf("MockDropbox webhook error: %s", err)
+		}
+	}
+}
+
+func (h *webhook) send(accounts []string) error {
+	body, err := json.Marshal(&dropboxclient.WebhookNotification{
+		ListFolder: &dropboxclient.WebhookListFolder{
+			Accounts: accounts,
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(h.ctx, "POST", h.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(dropboxclient.WebhookSignatureHeader, dropboxclient.WebhookSignature(h.appSecret, body))
+
+	res, err := h.client.Do(req)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+
+	return nil
+}
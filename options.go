@@ -0,0 +1,174 @@
+package dropboxclient
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/koofr/go-httpclient"
+)
+
+const (
+	DefaultApiBaseURL     = "https://api.dropboxapi.com"
+	DefaultContentBaseURL = "https://content.dropboxapi.com"
+)
+
+// TokenSource returns the access token for a request. It is called for
+// every API and content request, so implementations that refresh tokens
+// should cache them.
+type TokenSource interface {
+	Token(ctx context.Context) (string, error)
+}
+
+// StaticTokenSource always returns the same access token.
+type StaticTokenSource string
+
+func (s StaticTokenSource) Token(ctx context.Context) (string, error) {
+	return string(s), nil
+}
+
+// TokenSourceFunc adapts a function to a TokenSource.
+type TokenSourceFunc func(ctx context.Context) (string, error)
+
+func (f TokenSourceFunc) Token(ctx context.Context) (string, error) {
+	return f(ctx)
+}
+
+type options struct {
+	apiBaseURL     string
+	contentBaseURL string
+	httpClient     *http.Client
+	transport      http.RoundTripper
+	userAgent      string
+	apiTimeout     time.Duration
+	contentTimeout time.Duration
+	tokenSource    TokenSource
+}
+
+type Option func(o *options)
+
+// WithAccessToken authenticates all requests with a fixed access token.
+func WithAccessToken(accessToken string) Option {
+	return WithTokenSource(StaticTokenSource(accessToken))
+}
+
+func WithTokenSource(tokenSource TokenSource) Option {
+	return func(o *options) {
+		o.tokenSource = tokenSource
+	}
+}
+
+// WithBaseURL sends API and content requests to the same server, e.g. a
+// mockdropbox server.
+func WithBaseURL(baseURL string) Option {
+	return func(o *options) {
+		o.apiBaseURL = baseURL
+		o.contentBaseURL = baseURL
+	}
+}
+
+func WithApiBaseURL(baseURL string) Option {
+	return func(o *options) {
+		o.apiBaseURL = baseURL
+	}
+}
+
+func WithContentBaseURL(baseURL string) Option {
+	return func(o *options) {
+		o.contentBaseURL = baseURL
+	}
+}
+
+// WithHTTPClient sets the http.Client used for all requests.
+func WithHTTPClient(client *http.Client) Option {
+	return func(o *options) {
+		o.httpClient = client
+	}
+}
+
+// WithTransport sets the RoundTripper used for all requests. It is applied
+// on top of WithHTTPClient.
+func WithTransport(transport http.RoundTripper) Option {
+	return func(o *options) {
+		o.transport = transport
+	}
+}
+
+func WithUserAgent(userAgent string) Option {
+	return func(o *options) {
+		o.userAgent = userAgent
+	}
+}
+
+// WithApiTimeout limits the duration of API requests.
+func WithApiTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.apiTimeout = timeout
+	}
+}
+
+// WithContentTimeout limits the duration of content requests until the
+// response headers are received. Reading a download body is not limited.
+func WithContentTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.contentTimeout = timeout
+	}
+}
+
+// New creates a Dropbox client configured with opts.
+func New(opts ...Option) (*Dropbox, error) {
+	o := &options{
+		apiBaseURL:     DefaultApiBaseURL,
+		contentBaseURL: DefaultContentBaseURL,
+	}
+
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	httpClient := httpclient.HttpClient
+	if o.httpClient != nil {
+		httpClient = o.httpClient
+	}
+	if o.transport != nil {
+		c := *httpClient
+		c.Transport = o.transport
+		httpClient = &c
+	}
+
+	newClient := func(baseURL string) (*httpclient.HTTPClient, error) {
+		u, err := url.Parse(baseURL)
+		if err != nil {
+			return nil, err
+		}
+
+		client := httpclient.New()
+		client.BaseURL = u
+		client.Client = httpClient
+
+		if o.userAgent != "" {
+			client.Headers.Set("User-Agent", o.userAgent)
+		}
+
+		return client, nil
+	}
+
+	apiClient, err := newClient(o.apiBaseURL)
+	if err != nil {
+		return nil, err
+	}
+
+	contentClient, err := newClient(o.contentBaseURL)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Dropbox{
+		ApiHTTPClient:     apiClient,
+		ContentHTTPClient: contentClient,
+		ApiTimeout:        o.apiTimeout,
+		ContentTimeout:    o.contentTimeout,
+		TokenSource:       o.tokenSource,
+	}, nil
+}
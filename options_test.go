@@ -0,0 +1,117 @@
+package dropboxclient_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	. "github.com/koofr/go-dropboxclient"
+	"github.com/koofr/go-dropboxclient/mockdropbox"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+type recordingTransport struct {
+	mutex    sync.Mutex
+	requests []*http.Request
+}
+
+func (t *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.mutex.Lock()
+	t.requests = append(t.requests, req)
+	t.mutex.Unlock()
+
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+var _ = Describe("New", func() {
+	var mockServer *httptest.Server
+
+	BeforeEach(func() {
+		mockServer = httptest.NewServer(mockdropbox.New())
+	})
+
+	AfterEach(func() {
+		mockServer.Close()
+	})
+
+	It("should use the default endpoints", func() {
+		client, err := New(WithAccessToken("token"))
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(client.ApiHTTPClient.BaseURL.String()).To(Equal(DefaultApiBaseURL))
+		Expect(client.ContentHTTPClient.BaseURL.String()).To(Equal(DefaultContentBaseURL))
+	})
+
+	It("should reject invalid base URLs", func() {
+		_, err := New(WithApiBaseURL("://invalid"))
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should use the transport, user agent and token source", func() {
+		transport := &recordingTransport{}
+		tokens := []string{"first", "second"}
+		calls := 0
+
+		client, err := New(
+			WithBaseURL(mockServer.URL),
+			WithTransport(transport),
+			WithUserAgent("test-agent/1.0"),
+			WithTokenSource(TokenSourceFunc(func(ctx context.Context) (string, error) {
+				token := tokens[calls%len(tokens)]
+				calls++
+				return token, nil
+			})),
+		)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = client.CreateFolder(context.Background(), &CreateFolderArg{Path: "/first"})
+		Expect(err).NotTo(HaveOccurred())
+
+		// the mock keeps a separate store per token
+		_, err = client.GetMetadata(context.Background(), &GetMetadataArg{Path: "/first"})
+		Expect(err).To(HaveOccurred())
+
+		Expect(transport.requests).To(HaveLen(2))
+		Expect(transport.requests[0].Header.Get("User-Agent")).To(Equal("test-agent/1.0"))
+		Expect(transport.requests[0].Header.Get("Authorization")).To(Equal("Bearer first"))
+		Expect(transport.requests[1].Header.Get("Authorization")).To(Equal("Bearer second"))
+	})
+
+	It("should time out slow API requests", func() {
+		slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case <-time.After(time.Second):
+			case <-r.Context().Done():
+			}
+		}))
+		defer slow.Close()
+
+		client, err := New(WithAccessToken("token"), WithBaseURL(slow.URL), WithApiTimeout(50*time.Millisecond))
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = client.GetSpaceUsage(context.Background())
+		Expect(err).To(Equal(ErrRequestTimeout))
+	})
+
+	It("should not limit reading download bodies with the content timeout", func() {
+		client, err := New(WithAccessToken("mock"), WithBaseURL(mockServer.URL), WithContentTimeout(50*time.Millisecond))
+		Expect(err).NotTo(HaveOccurred())
+
+		uploadFile(client, "/file.txt", []byte("data"))
+
+		reader, _, err := client.Download(context.Background(), &DownloadArg{Path: "/file.txt"}, nil)
+		Expect(err).NotTo(HaveOccurred())
+		defer reader.Close()
+
+		time.Sleep(100 * time.Millisecond)
+
+		data, err := io.ReadAll(reader)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(data)).To(Equal("data"))
+	})
+})
@@ -0,0 +1,128 @@
+package dropboxclient_test
+
+import (
+	"context"
+	"strings"
+
+	. "github.com/koofr/go-dropboxclient"
+	"github.com/koofr/go-dropboxclient/mockdropbox"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("MockDropbox quota", func() {
+	ctx := context.Background()
+
+	newClient := func(opts ...mockdropbox.StoreOption) *mockdropbox.MemoryClient {
+		return mockdropbox.NewMemoryClientWithStore(mockdropbox.NewStore(opts...))
+	}
+
+	used := func(client *mockdropbox.MemoryClient) int64 {
+		usage, err := client.GetSpaceUsage(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		return usage.Used
+	}
+
+	overwrite := func(client *mockdropbox.MemoryClient, path string, data string) error {
+		session, err := client.UploadSessionStart(ctx, strings.NewReader(data))
+		Expect(err).NotTo(HaveOccurred())
+		_, err = client.UploadSessionFinish(ctx, &UploadSessionFinishArg{
+			Cursor: &UploadSessionCursor{SessionId: session.SessionId, Offset: int64(len(data))},
+			Commit: &CommitInfo{Path: path, Mode: &WriteMode{Tag: WriteModeOverwrite}},
+		})
+		return err
+	}
+
+	It("should account for created, overwritten, copied and deleted files", func() {
+		client := newClient()
+
+		_, err := client.CreateFolder(ctx, &CreateFolderArg{Path: "/a"})
+		Expect(err).NotTo(HaveOccurred())
+		uploadMemoryFile(client, "/a/file.txt", "12345")
+		Expect(used(client)).To(Equal(int64(5)))
+
+		Expect(overwrite(client, "/a/file.txt", "123")).To(Succeed())
+		Expect(used(client)).To(Equal(int64(3)))
+
+		_, err = client.Copy(ctx, &RelocationArg{FromPath: "/a", ToPath: "/b"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(used(client)).To(Equal(int64(6)))
+
+		_, err = client.Move(ctx, &RelocationArg{FromPath: "/b", ToPath: "/c"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(used(client)).To(Equal(int64(6)))
+
+		_, err = client.Delete(ctx, &DeleteArg{Path: "/a"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(used(client)).To(Equal(int64(3)))
+	})
+
+	It("should reject uploads and copies beyond the quota", func() {
+		client := newClient(mockdropbox.WithSpaceAllocation(SpaceAllocationIndividual, 8))
+
+		uploadMemoryFile(client, "/file.txt", "12345")
+
+		err := overwrite(client, "/other.txt", "1234")
+		dropboxErr, ok := IsDropboxError(err)
+		Expect(ok).To(BeTrue())
+		Expect(dropboxErr.Err.Tag).To(Equal("path"))
+		Expect(dropboxErr.Err.Path.Tag).To(Equal("insufficient_space"))
+
+		_, err = client.Copy(ctx, &RelocationArg{FromPath: "/file.txt", ToPath: "/copy.txt"})
+		dropboxErr, ok = IsDropboxError(err)
+		Expect(ok).To(BeTrue())
+		Expect(dropboxErr.Err.Tag).To(Equal("insufficient_quota"))
+
+		Expect(overwrite(client, "/file.txt", "12345678")).To(Succeed())
+		Expect(used(client)).To(Equal(int64(8)))
+	})
+
+	It("should report the allocation type", func() {
+		client := newClient(mockdropbox.WithSpaceAllocation(SpaceAllocationTeam, 100))
+		uploadMemoryFile(client, "/file.txt", "12345")
+
+		usage, err := client.GetSpaceUsage(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(usage.Used).To(Equal(int64(5)))
+		Expect(usage.Allocation).To(Equal(&SpaceAllocation{
+			Tag:       SpaceAllocationTeam,
+			Used:      5,
+			Allocated: 100,
+		}))
+
+		client.Store.SetSpaceAllocation(SpaceAllocationIndividual, 4)
+		usage, err = client.GetSpaceUsage(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(usage.Allocation).To(Equal(&SpaceAllocation{
+			Tag:       SpaceAllocationIndividual,
+			Allocated: 4,
+		}))
+	})
+
+	It("should restore the used space when the store is reopened", func() {
+		dir := GinkgoT().TempDir()
+
+		backend, err := mockdropbox.NewDiskBackend(dir)
+		Expect(err).NotTo(HaveOccurred())
+		store, err := mockdropbox.NewStoreWithBackend(backend)
+		Expect(err).NotTo(HaveOccurred())
+		client := mockdropbox.NewMemoryClientWithStore(store)
+
+		uploadMemoryFile(client, "/file.txt", "12345")
+		uploadMemoryFile(client, "/other.txt", "123")
+		Expect(overwrite(client, "/file.txt", "1")).To(Succeed())
+		_, err = client.Delete(ctx, &DeleteArg{Path: "/other.txt"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(store.Close()).To(Succeed())
+
+		backend, err = mockdropbox.NewDiskBackend(dir)
+		Expect(err).NotTo(HaveOccurred())
+		store, err = mockdropbox.NewStoreWithBackend(backend)
+		Expect(err).NotTo(HaveOccurred())
+		defer store.Close()
+
+		spaceUsed, _ := store.GetSpaceUsage()
+		Expect(spaceUsed).To(Equal(int64(1)))
+	})
+})
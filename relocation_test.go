@@ -0,0 +1,144 @@
+package dropboxclient_test
+
+import (
+	"context"
+
+	. "github.com/koofr/go-dropboxclient"
+	"github.com/koofr/go-dropboxclient/mockdropbox"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("MockDropbox relocation", func() {
+	ctx := context.Background()
+
+	var client *mockdropbox.MemoryClient
+
+	BeforeEach(func() {
+		client = mockdropbox.NewMemoryClient()
+	})
+
+	createFolder := func(path string) *Metadata {
+		md, err := client.CreateFolder(ctx, &CreateFolderArg{Path: path})
+		Expect(err).NotTo(HaveOccurred())
+		return md
+	}
+
+	changes := func(cursor string) []string {
+		res, err := client.ListFolderContinue(ctx, &ListFolderContinueArg{Cursor: cursor})
+		Expect(err).NotTo(HaveOccurred())
+		entries := []string{}
+		for _, md := range res.Entries {
+			entries = append(entries, md.Tag+" "+md.PathLower)
+		}
+		return entries
+	}
+
+	It("should copy files with new revs and list the copies as changes", func() {
+		createFolder("/a")
+		file := uploadMemoryFile(client, "/a/file.txt", "12345")
+
+		res, err := client.ListFolder(ctx, &ListFolderArg{Path: "", Recursive: true})
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = client.Copy(ctx, &RelocationArg{FromPath: "/a", ToPath: "/b"})
+		Expect(err).NotTo(HaveOccurred())
+
+		md, err := client.GetMetadata(ctx, &GetMetadataArg{Path: "/b/file.txt"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(md.Id).NotTo(Equal(file.Id))
+		Expect(md.Rev).NotTo(BeEmpty())
+		Expect(md.Rev).NotTo(Equal(file.Rev))
+		Expect(md.Size).To(Equal(file.Size))
+		Expect(md.ContentHash).To(Equal(file.ContentHash))
+		Expect(md.ClientModified).To(Equal(file.ClientModified))
+
+		Expect(changes(res.Cursor)).To(Equal([]string{
+			"folder /b",
+			"file /b/file.txt",
+		}))
+	})
+
+	It("should not copy a folder into its descendant", func() {
+		createFolder("/a")
+		createFolder("/a/b")
+
+		_, err := client.Copy(ctx, &RelocationArg{FromPath: "/a", ToPath: "/a/b/c"})
+		dropboxErr, ok := IsDropboxError(err)
+		Expect(ok).To(BeTrue())
+		Expect(dropboxErr.Err.Tag).To(Equal("cant_move_folder_into_itself"))
+
+		_, err = client.Copy(ctx, &RelocationArg{FromPath: "/a/b", ToPath: "/ab"})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("should report the kind of the conflicting item", func() {
+		createFolder("/a")
+		createFolder("/b")
+
+		_, err := client.Copy(ctx, &RelocationArg{FromPath: "/a", ToPath: "/b"})
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(HavePrefix("to/conflict/folder/"))
+		Expect(ErrorTag(err)).To(Equal("to/conflict"))
+		Expect(ErrorTag(nil)).To(BeEmpty())
+	})
+
+	It("should list a moved folder as deleted at the old path and new at the new path", func() {
+		createFolder("/a")
+		createFolder("/a/b")
+		uploadMemoryFile(client, "/a/b/file.txt", "12345")
+
+		res, err := client.ListFolder(ctx, &ListFolderArg{Path: "", Recursive: true})
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = client.Move(ctx, &RelocationArg{FromPath: "/a", ToPath: "/c"})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(changes(res.Cursor)).To(Equal([]string{
+			"deleted /a",
+			"folder /c",
+			"folder /c/b",
+			"file /c/b/file.txt",
+		}))
+	})
+
+	It("should rename in place when only the case changes", func() {
+		folder := createFolder("/Foo")
+		uploadMemoryFile(client, "/Foo/file.txt", "12345")
+
+		res, err := client.ListFolder(ctx, &ListFolderArg{Path: "", Recursive: true})
+		Expect(err).NotTo(HaveOccurred())
+
+		md, err := client.Move(ctx, &RelocationArg{FromPath: "/Foo", ToPath: "/foo"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(md.Id).To(Equal(folder.Id))
+		Expect(md.PathDisplay).To(Equal("/foo"))
+
+		md, err = client.GetMetadata(ctx, &GetMetadataArg{Path: "/FOO/file.txt"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(md.PathDisplay).To(Equal("/foo/file.txt"))
+
+		Expect(changes(res.Cursor)).To(Equal([]string{
+			"folder /foo",
+			"file /foo/file.txt",
+		}))
+	})
+
+	It("should not overwrite the destination of a move", func() {
+		createFolder("/a")
+		uploadMemoryFile(client, "/b", "12345")
+
+		_, err := client.Move(ctx, &RelocationArg{FromPath: "/a", ToPath: "/b"})
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(HavePrefix("to/conflict/file/"))
+
+		md, err := client.GetMetadata(ctx, &GetMetadataArg{Path: "/b"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(md.Tag).To(Equal(MetadataFile))
+
+		md, err = client.Move(ctx, &RelocationArg{FromPath: "/a", ToPath: "/b", Autorename: true})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(md.Name).To(Equal("b (1)"))
+	})
+})
@@ -0,0 +1,249 @@
+package dropboxclient
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/koofr/go-ioutils"
+)
+
+var ErrDownloadChanged = errors.New("dropboxclient: file changed during download")
+
+const DefaultResumableMaxRetries = 5
+const DefaultResumableRetryDelay = 1 * time.Second
+
+type ResumableDownloadOptions struct {
+	// MaxRetries is the number of consecutive reconnects allowed without
+	// receiving any data. Defaults to DefaultResumableMaxRetries.
+	MaxRetries int
+	// RetryDelay is multiplied by the attempt number before reconnecting.
+	// Defaults to DefaultResumableRetryDelay.
+	RetryDelay time.Duration
+	// OnProgress is called after every read with the number of bytes read
+	// so far and the total number of bytes expected.
+	OnProgress func(bytesRead int64, total int64)
+}
+
+// ResumableReader reads a download body and transparently reconnects with a
+// Range header starting at the last received byte when the body fails. The
+// file rev and ETag are checked on every reconnect and ErrDownloadChanged is
+// returned if the file was modified in the meantime.
+type ResumableReader struct {
+	client *Dropbox
+	// ctx is canceled by Close so that a reconnect in progress, which holds
+	// the mutex, stops waiting.
+	ctx    context.Context
+	cancel context.CancelFunc
+	arg    *DownloadArg
+	opts   ResumableDownloadOptions
+
+	start int64
+	total int64
+	read  int64
+
+	rev  string
+	etag string
+
+	body    io.ReadCloser
+	retries int
+	closed  bool
+	mutex   sync.Mutex
+}
+
+func (c *Dropbox) DownloadResumable(ctx context.Context, arg *DownloadArg, span *ioutils.FileSpan, opts *ResumableDownloadOptions) (reader *ResumableReader, result *Metadata, err error) {
+	body, result, err := c.Download(ctx, arg, span)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	readerCtx, cancel := context.WithCancel(ctx)
+
+	reader = &ResumableReader{
+		client: c,
+		ctx:    readerCtx,
+		cancel: cancel,
+		arg:    arg,
+		rev:    result.Rev,
+		etag:   result.ETag,
+		body:   body,
+	}
+
+	if opts != nil {
+		reader.opts = *opts
+	}
+	if reader.opts.MaxRetries <= 0 {
+		reader.opts.MaxRetries = DefaultResumableMaxRetries
+	}
+	if reader.opts.RetryDelay <= 0 {
+		reader.opts.RetryDelay = DefaultResumableRetryDelay
+	}
+
+	if span != nil {
+		reader.start = span.Start
+		reader.total = span.End - span.Start + 1
+	} else {
+		reader.total = result.Size
+	}
+
+	return reader, result, nil
+}
+
+func (r *ResumableReader) Read(p []byte) (n int, err error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.closed {
+		return 0, io.ErrClosedPipe
+	}
+
+	for {
+		if r.read >= r.total {
+			return 0, io.EOF
+		}
+
+		if r.body == nil {
+			if err = r.reconnect(); err != nil {
+				return 0, err
+			}
+		}
+
+		n, err = r.body.Read(p)
+
+		if n > 0 {
+			r.read += int64(n)
+			r.retries = 0
+
+			if r.opts.OnProgress != nil {
+				r.opts.OnProgress(r.read, r.total)
+			}
+		}
+
+		if err == nil {
+			return n, nil
+		}
+
+		if err == io.EOF && r.read >= r.total {
+			return n, io.EOF
+		}
+
+		if ctxErr := r.ctx.Err(); ctxErr != nil {
+			return n, ctxErr
+		}
+
+		r.body.Close()
+		r.body = nil
+
+		r.retries++
+		if r.retries > r.opts.MaxRetries {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return n, err
+		}
+
+		if n > 0 {
+			return n, nil
+		}
+	}
+}
+
+func (r *ResumableReader) reconnect() error {
+	for {
+		delay := r.opts.RetryDelay * time.Duration(r.retries)
+
+		select {
+		case <-time.After(delay):
+		case <-r.ctx.Done():
+			return r.ctx.Err()
+		}
+
+		span := &ioutils.FileSpan{
+			Start: r.start + r.read,
+			End:   r.start + r.total - 1,
+		}
+
+		body, result, err := r.client.Download(withRetry(r.ctx, r.retries), r.arg, span)
+		if err != nil {
+			if ctxErr := r.ctx.Err(); ctxErr != nil {
+				return ctxErr
+			}
+			if !isRetryableError(err) {
+				return err
+			}
+
+			r.retries++
+			if r.retries > r.opts.MaxRetries {
+				return err
+			}
+
+			continue
+		}
+
+		if result.Rev != r.rev || (r.etag != "" && result.ETag != r.etag) {
+			body.Close()
+			return ErrDownloadChanged
+		}
+
+		r.body = body
+
+		return nil
+	}
+}
+
+// BytesRead returns the number of bytes delivered to the caller so far.
+func (r *ResumableReader) BytesRead() int64 {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.read
+}
+
+// Close closes the body. A Read waiting to reconnect is stopped and returns
+// context.Canceled.
+func (r *ResumableReader) Close() error {
+	// cancel before locking, a reconnect holds the mutex until it stops
+	r.cancel()
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.closed {
+		return nil
+	}
+
+	r.closed = true
+
+	if r.body != nil {
+		err := r.body.Close()
+		r.body = nil
+		return err
+	}
+
+	return nil
+}
+
+func isRetryableError(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	if err == ErrDownloadChanged || err == ErrContentHashMismatch {
+		return false
+	}
+
+	if dropboxErr, ok := IsDropboxError(err); ok {
+		if dropboxErr.HttpClientError == nil {
+			return false
+		}
+
+		status := dropboxErr.HttpClientError.Got
+
+		return status == http.StatusTooManyRequests || status >= http.StatusInternalServerError
+	}
+
+	return true
+}
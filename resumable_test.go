@@ -0,0 +1,172 @@
+package dropboxclient_test
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"time"
+
+	. "github.com/koofr/go-dropboxclient"
+	"github.com/koofr/go-dropboxclient/mockdropbox"
+	"github.com/koofr/go-ioutils"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("DownloadResumable", func() {
+	var mock *mockdropbox.MockDropbox
+	var client *Dropbox
+	var stop func()
+
+	BeforeEach(func() {
+		client, mock, stop = startMockClient()
+	})
+
+	AfterEach(func() {
+		stop()
+	})
+
+	upload := func(name string, data []byte) *Metadata {
+		return uploadFile(client, "/"+name, data)
+	}
+
+	randomData := func(size int) []byte {
+		data := make([]byte, size)
+		rand.Read(data)
+		return data
+	}
+
+	opts := func() *ResumableDownloadOptions {
+		return &ResumableDownloadOptions{
+			MaxRetries: 3,
+			RetryDelay: time.Millisecond,
+		}
+	}
+
+	It("should resume a download after the connection drops", func() {
+		name := fmt.Sprintf("new-file-%d", rand.Int())
+		data := randomData(1000)
+		upload(name, data)
+
+		mock.CutDownloadsAfter(64)
+
+		progress := []int64{}
+		o := opts()
+		o.OnProgress = func(bytesRead int64, total int64) {
+			Expect(total).To(Equal(int64(1000)))
+			progress = append(progress, bytesRead)
+		}
+
+		reader, md, err := client.DownloadResumable(context.Background(), &DownloadArg{Path: "/" + name}, nil, o)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(md.Name).To(Equal(name))
+
+		downloaded, err := ioutil.ReadAll(reader)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reader.Close()).To(Succeed())
+
+		Expect(downloaded).To(Equal(data))
+		Expect(reader.BytesRead()).To(Equal(int64(1000)))
+		Expect(len(progress)).To(BeNumerically(">=", 1000/64))
+		Expect(progress[len(progress)-1]).To(Equal(int64(1000)))
+	})
+
+	It("should resume a download of a file range", func() {
+		name := fmt.Sprintf("new-file-%d", rand.Int())
+		data := randomData(1000)
+		upload(name, data)
+
+		mock.CutDownloadsAfter(64)
+
+		reader, _, err := client.DownloadResumable(context.Background(), &DownloadArg{Path: "/" + name}, &ioutils.FileSpan{Start: 100, End: 599}, opts())
+		Expect(err).NotTo(HaveOccurred())
+
+		downloaded, err := ioutil.ReadAll(reader)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reader.Close()).To(Succeed())
+
+		Expect(downloaded).To(Equal(data[100:600]))
+	})
+
+	It("should fail if the file changes between reconnects", func() {
+		name := fmt.Sprintf("new-file-%d", rand.Int())
+		upload(name, randomData(1000))
+
+		mock.CutDownloadsAfter(64)
+
+		reader, _, err := client.DownloadResumable(context.Background(), &DownloadArg{Path: "/" + name}, nil, opts())
+		Expect(err).NotTo(HaveOccurred())
+		defer reader.Close()
+
+		buf := make([]byte, 64)
+		_, err = reader.Read(buf)
+		Expect(err).NotTo(HaveOccurred())
+
+		upload(name, randomData(1000))
+
+		_, err = ioutil.ReadAll(reader)
+		Expect(err).To(Equal(ErrDownloadChanged))
+	})
+
+	It("should stop waiting to reconnect when closed", func() {
+		name := fmt.Sprintf("new-file-%d", rand.Int())
+		upload(name, randomData(1000))
+
+		mock.CutDownloadsAfter(64)
+
+		o := opts()
+		o.RetryDelay = time.Hour
+
+		reader, _, err := client.DownloadResumable(context.Background(), &DownloadArg{Path: "/" + name}, nil, o)
+		Expect(err).NotTo(HaveOccurred())
+
+		buf := make([]byte, 64)
+		_, err = reader.Read(buf)
+		Expect(err).NotTo(HaveOccurred())
+
+		readErr := make(chan error, 1)
+		go func() {
+			_, err := ioutil.ReadAll(reader)
+			readErr <- err
+		}()
+
+		// let the read start waiting to reconnect
+		time.Sleep(50 * time.Millisecond)
+
+		closed := make(chan error, 1)
+		go func() {
+			closed <- reader.Close()
+		}()
+
+		Eventually(closed).Should(Receive(BeNil()))
+		Eventually(readErr).Should(Receive(Equal(context.Canceled)))
+	})
+
+	It("should not retry if the file is gone", func() {
+		name := fmt.Sprintf("new-file-%d", rand.Int())
+		upload(name, randomData(1000))
+
+		mock.CutDownloadsAfter(64)
+
+		reader, _, err := client.DownloadResumable(context.Background(), &DownloadArg{Path: "/" + name}, nil, opts())
+		Expect(err).NotTo(HaveOccurred())
+		defer reader.Close()
+
+		buf := make([]byte, 64)
+		_, err = reader.Read(buf)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = client.Delete(context.Background(), &DeleteArg{Path: "/" + name})
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = ioutil.ReadAll(reader)
+		Expect(err).To(HaveOccurred())
+
+		dropboxErr, ok := IsDropboxError(err)
+		Expect(ok).To(BeTrue())
+		Expect(dropboxErr.Err.Tag).To(Equal("path"))
+		Expect(dropboxErr.Err.Path.Tag).To(Equal("not_found"))
+	})
+})
@@ -0,0 +1,171 @@
+package dropboxclient_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"path/filepath"
+
+	. "github.com/koofr/go-dropboxclient"
+	"github.com/koofr/go-dropboxclient/mockdropbox"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Store snapshots", func() {
+	ctx := context.Background()
+
+	var store *mockdropbox.Store
+	var client *mockdropbox.MemoryClient
+
+	upload := func(client Client, path string, data string) {
+		session, err := client.UploadSessionStart(ctx, bytes.NewReader([]byte(data)))
+		Expect(err).NotTo(HaveOccurred())
+		_, err = client.UploadSessionFinish(ctx, &UploadSessionFinishArg{
+			Cursor: &UploadSessionCursor{SessionId: session.SessionId, Offset: int64(len(data))},
+			Commit: &CommitInfo{Path: path, Mode: &WriteMode{Tag: WriteModeOverwrite}},
+		})
+		Expect(err).NotTo(HaveOccurred())
+	}
+
+	download := func(client Client, path string) string {
+		reader, _, err := client.Download(ctx, &DownloadArg{Path: path}, nil)
+		Expect(err).NotTo(HaveOccurred())
+		defer reader.Close()
+		data, err := io.ReadAll(reader)
+		Expect(err).NotTo(HaveOccurred())
+		return string(data)
+	}
+
+	list := func(client Client) []string {
+		res, err := client.ListFolder(ctx, &ListFolderArg{Path: "", Recursive: true})
+		Expect(err).NotTo(HaveOccurred())
+		paths := []string{}
+		for _, md := range res.Entries {
+			paths = append(paths, md.PathLower)
+		}
+		return paths
+	}
+
+	BeforeEach(func() {
+		store = mockdropbox.NewStore()
+		client = mockdropbox.NewMemoryClientWithStore(store)
+
+		_, err := client.CreateFolder(ctx, &CreateFolderArg{Path: "/dir"})
+		Expect(err).NotTo(HaveOccurred())
+		upload(client, "/dir/a.txt", "a")
+		upload(client, "/b.txt", "b")
+		_, err = client.Delete(ctx, &DeleteArg{Path: "/b.txt"})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("should roll back the store", func() {
+		session, err := client.UploadSessionStart(ctx, bytes.NewReader([]byte("hel")))
+		Expect(err).NotTo(HaveOccurred())
+
+		snapshot, err := store.Snapshot()
+		Expect(err).NotTo(HaveOccurred())
+		paths := list(client)
+		changeID := store.GetCurrentChangeID()
+
+		for i := 0; i < 2; i++ {
+			upload(client, "/dir/a.txt", "changed")
+			upload(client, "/c.txt", "c")
+			_, err = client.Move(ctx, &RelocationArg{FromPath: "/dir", ToPath: "/moved"})
+			Expect(err).NotTo(HaveOccurred())
+			_, err = client.UploadSessionStart(ctx, bytes.NewReader([]byte("other")))
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(store.Restore(snapshot)).To(Succeed())
+
+			Expect(list(client)).To(Equal(paths))
+			Expect(download(client, "/dir/a.txt")).To(Equal("a"))
+			Expect(store.GetCurrentChangeID()).To(BeNumerically(">", changeID))
+			Expect(store.UploadSessions()).To(Equal([]*mockdropbox.UploadSessionInfo{
+				{Id: session.SessionId, Offset: 3},
+			}))
+		}
+
+		err = client.UploadSessionAppend(ctx, &UploadSessionCursor{SessionId: session.SessionId, Offset: 3}, bytes.NewReader([]byte("lo")))
+		Expect(err).NotTo(HaveOccurred())
+		_, err = client.UploadSessionFinish(ctx, &UploadSessionFinishArg{
+			Cursor: &UploadSessionCursor{SessionId: session.SessionId, Offset: 5},
+			Commit: &CommitInfo{Path: "/hello.txt", Mode: &WriteMode{Tag: WriteModeAdd}},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(download(client, "/hello.txt")).To(Equal("hello"))
+	})
+
+	It("should list the deleted entries of the snapshot", func() {
+		res, err := client.ListFolder(ctx, &ListFolderArg{Path: "", Recursive: true})
+		Expect(err).NotTo(HaveOccurred())
+		upload(client, "/dir/d.txt", "d")
+		_, err = client.Delete(ctx, &DeleteArg{Path: "/dir/d.txt"})
+		Expect(err).NotTo(HaveOccurred())
+
+		snapshot, err := store.Snapshot()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(store.Restore(snapshot)).To(Succeed())
+
+		changes, err := client.ListFolderContinue(ctx, &ListFolderContinueArg{Cursor: res.Cursor})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(changes.Entries).To(HaveLen(1))
+		Expect(changes.Entries[0].Tag).To(Equal(MetadataDeleted))
+	})
+
+	It("should reset cursors from after the snapshot", func() {
+		snapshot, err := store.Snapshot()
+		Expect(err).NotTo(HaveOccurred())
+
+		upload(client, "/c.txt", "c")
+		res, err := client.ListFolder(ctx, &ListFolderArg{Path: "", Recursive: true})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(store.Restore(snapshot)).To(Succeed())
+
+		_, err = client.ListFolderContinue(ctx, &ListFolderContinueArg{Cursor: res.Cursor})
+		dropboxErr, ok := IsDropboxError(err)
+		Expect(ok).To(BeTrue())
+		Expect(dropboxErr.Err.Tag).To(Equal("reset"))
+
+		res, err = client.ListFolder(ctx, &ListFolderArg{Path: "", Recursive: true})
+		Expect(err).NotTo(HaveOccurred())
+		upload(client, "/d.txt", "d")
+
+		changes, err := client.ListFolderContinue(ctx, &ListFolderContinueArg{Cursor: res.Cursor})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(changes.Entries).To(HaveLen(1))
+		Expect(changes.Entries[0].PathLower).To(Equal("/d.txt"))
+	})
+
+	It("should save a snapshot to a file", func() {
+		snapshot, err := store.Snapshot()
+		Expect(err).NotTo(HaveOccurred())
+		path := filepath.Join(GinkgoT().TempDir(), "fixture.tar")
+		Expect(store.SaveSnapshot(snapshot, path)).To(Succeed())
+
+		backend, err := mockdropbox.NewDiskBackend(GinkgoT().TempDir())
+		Expect(err).NotTo(HaveOccurred())
+		other, err := mockdropbox.NewStoreWithBackend(backend)
+		Expect(err).NotTo(HaveOccurred())
+		defer other.Close()
+		otherClient := mockdropbox.NewMemoryClientWithStore(other)
+
+		loaded, err := other.LoadSnapshot(path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(loaded).To(Equal(snapshot))
+		Expect(other.Restore(loaded)).To(Succeed())
+
+		Expect(list(otherClient)).To(Equal(list(client)))
+		Expect(download(otherClient, "/dir/a.txt")).To(Equal("a"))
+	})
+
+	It("should not restore a snapshot with missing blobs", func() {
+		snapshot, err := store.Snapshot()
+		Expect(err).NotTo(HaveOccurred())
+
+		other := mockdropbox.NewStore()
+		Expect(other.Restore(snapshot)).NotTo(Succeed())
+	})
+})
@@ -29,11 +29,13 @@ type Metadata struct {
 	Tag            string    `json:".tag"`
 	Name           string    `json:"name"`
 	PathLower      string    `json:"path_lower"`
+	PathDisplay    string    `json:"path_display,omitempty"`
 	ClientModified time.Time `json:"client_modified"`
 	ServerModified time.Time `json:"server_modified"`
 	Rev            string    `json:"rev"`
 	Size           int64     `json:"size"`
 	Id             string    `json:"id"`
+	ContentHash    string    `json:"content_hash,omitempty"`
 
 	ETag          string
 	ContentLength int64
@@ -74,8 +76,9 @@ type DeleteArg struct {
 }
 
 type RelocationArg struct {
-	FromPath string `json:"from_path"`
-	ToPath   string `json:"to_path"`
+	FromPath   string `json:"from_path"`
+	ToPath     string `json:"to_path"`
+	Autorename bool   `json:"autorename,omitempty"`
 }
 
 type UploadSessionStartResult struct {
@@ -119,6 +122,11 @@ type DropboxErrorDetails struct {
 	Tag        string       `json:".tag"`
 	Path       *LookupError `json:"path"`
 	PathLookup *LookupError `json:"path_lookup"`
+	FromLookup *LookupError `json:"from_lookup"`
+	To         *LookupError `json:"to"`
+	// Reason and RetryAfter are set for rate limit (429) errors.
+	Reason     *LookupError `json:"reason,omitempty"`
+	RetryAfter int          `json:"retry_after,omitempty"`
 }
 
 type LookupError struct {
@@ -142,3 +150,33 @@ func IsDropboxError(err error) (dropboxErr *DropboxError, ok bool) {
 		return nil, false
 	}
 }
+
+// ErrorTag returns the tag path of a Dropbox error, e.g. "path/not_found",
+// or an empty string for other errors.
+func ErrorTag(err error) string {
+	dropboxErr, ok := IsDropboxError(err)
+	if !ok || dropboxErr.Err.Tag == "" {
+		return ""
+	}
+
+	details := dropboxErr.Err
+
+	var lookup *LookupError
+
+	switch details.Tag {
+	case "path":
+		lookup = details.Path
+	case "path_lookup":
+		lookup = details.PathLookup
+	case "from_lookup":
+		lookup = details.FromLookup
+	case "to":
+		lookup = details.To
+	}
+
+	if lookup != nil && lookup.Tag != "" {
+		return details.Tag + "/" + lookup.Tag
+	}
+
+	return details.Tag
+}
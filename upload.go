@@ -0,0 +1,140 @@
+package dropboxclient
+
+import (
+	"bytes"
+	"context"
+	"errors"
+)
+
+const DefaultUploadChunkSize = 8 * 1024 * 1024
+
+var ErrUploadWriterClosed = errors.New("dropboxclient: upload writer closed")
+
+// UploadWriter streams written data into an upload session. Data is sent in
+// chunks of ChunkSize bytes and the session is committed on Close.
+type UploadWriter struct {
+	// ChunkSize is the size of upload session start/append requests. It can be
+	// changed before the first Write. Defaults to DefaultUploadChunkSize,
+	// which is also used if it is not positive.
+	ChunkSize int
+
+	client    Client
+	ctx       context.Context
+	commit    *CommitInfo
+	buf       []byte
+	sessionId string
+	offset    int64
+	result    *Metadata
+	err       error
+	closed    bool
+}
+
+func (c *Dropbox) NewUploadWriter(ctx context.Context, commit *CommitInfo) *UploadWriter {
+	return NewUploadWriter(ctx, c, commit)
+}
+
+// NewUploadWriter returns an UploadWriter that uploads with client.
+func NewUploadWriter(ctx context.Context, client Client, commit *CommitInfo) *UploadWriter {
+	return &UploadWriter{
+		ChunkSize: DefaultUploadChunkSize,
+		client:    client,
+		ctx:       ctx,
+		commit:    commit,
+	}
+}
+
+func (w *UploadWriter) Write(p []byte) (n int, err error) {
+	if w.closed {
+		return 0, ErrUploadWriterClosed
+	}
+	if w.err != nil {
+		return 0, w.err
+	}
+
+	chunkSize := w.ChunkSize
+	if chunkSize <= 0 {
+		chunkSize = DefaultUploadChunkSize
+	}
+
+	w.buf = append(w.buf, p...)
+
+	for len(w.buf) >= chunkSize {
+		if err = w.send(w.buf[:chunkSize]); err != nil {
+			w.err = err
+			return 0, err
+		}
+		w.buf = w.buf[chunkSize:]
+	}
+
+	return len(p), nil
+}
+
+func (w *UploadWriter) send(chunk []byte) (err error) {
+	if w.sessionId == "" {
+		res, err := w.client.UploadSessionStart(w.ctx, bytes.NewReader(chunk))
+		if err != nil {
+			return err
+		}
+		w.sessionId = res.SessionId
+	} else {
+		cursor := &UploadSessionCursor{
+			SessionId: w.sessionId,
+			Offset:    w.offset,
+		}
+		if err = w.client.UploadSessionAppend(w.ctx, cursor, bytes.NewReader(chunk)); err != nil {
+			return err
+		}
+	}
+
+	w.offset += int64(len(chunk))
+
+	return nil
+}
+
+// Close sends the remaining data and commits the upload session.
+func (w *UploadWriter) Close() (err error) {
+	if w.closed {
+		return ErrUploadWriterClosed
+	}
+	w.closed = true
+
+	if w.err != nil {
+		return w.err
+	}
+
+	if w.sessionId == "" || len(w.buf) > 0 {
+		if err = w.send(w.buf); err != nil {
+			return err
+		}
+		w.buf = nil
+	}
+
+	w.result, err = w.client.UploadSessionFinish(w.ctx, &UploadSessionFinishArg{
+		Cursor: &UploadSessionCursor{
+			SessionId: w.sessionId,
+			Offset:    w.offset,
+		},
+		Commit: w.commit,
+	})
+
+	return err
+}
+
+// Abort drops the upload session without committing it, e.g. after the
+// source of the data failed. The data sent so far is discarded by Dropbox
+// when the session expires.
+func (w *UploadWriter) Abort() error {
+	if w.closed {
+		return ErrUploadWriterClosed
+	}
+	w.closed = true
+	w.buf = nil
+
+	return nil
+}
+
+// Metadata returns the metadata of the committed file after a successful
+// Close.
+func (w *UploadWriter) Metadata() *Metadata {
+	return w.result
+}
@@ -0,0 +1,46 @@
+package dropboxclient_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	. "github.com/koofr/go-dropboxclient"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("UploadWriter", func() {
+	var client *Dropbox
+	var stop func()
+
+	BeforeEach(func() {
+		client, _, stop = startMockClient()
+	})
+
+	AfterEach(func() {
+		stop()
+	})
+
+	for _, chunkSize := range []int{0, -1} {
+		chunkSize := chunkSize
+
+		It(fmt.Sprintf("should use the default chunk size for chunk size %d", chunkSize), func() {
+			w := client.NewUploadWriter(context.Background(), &CommitInfo{Path: "/file.txt", Mode: &WriteMode{Tag: WriteModeAdd}})
+			w.ChunkSize = chunkSize
+
+			_, err := w.Write([]byte("hello world"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(w.Close()).To(Succeed())
+			Expect(w.Metadata().Size).To(Equal(int64(11)))
+
+			reader, _, err := client.Download(context.Background(), &DownloadArg{Path: "/file.txt"}, nil)
+			Expect(err).NotTo(HaveOccurred())
+			defer reader.Close()
+			data, err := io.ReadAll(reader)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(data)).To(Equal("hello world"))
+		})
+	}
+})
@@ -0,0 +1,279 @@
+package dropboxclient
+
+import (
+	"context"
+	"io/fs"
+	gopath "path"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// WalkFunc is called by Walk for every visited file and folder. It follows
+// the fs.WalkDirFunc contract: returning fs.SkipDir from a folder skips its
+// contents, returning fs.SkipDir from a file skips the remaining entries of
+// its parent folder and returning fs.SkipAll stops the walk.
+//
+// err is non-nil if the root could not be read (md is nil) or if a folder
+// could not be listed (fn is then called a second time for that folder).
+type WalkFunc func(path string, md *Metadata, err error) error
+
+type WalkOptions struct {
+	// Concurrency is the number of folder listings fetched ahead in parallel.
+	// Entries are still delivered in the same order. Zero or one lists
+	// folders sequentially.
+	Concurrency int
+	// Include restricts visited files to those matching at least one glob
+	// pattern. Folders are always traversed.
+	Include []string
+	// Exclude skips files and folders (including their contents) matching
+	// any glob pattern.
+	Exclude []string
+	// MaxDepth limits the walk to entries at most MaxDepth levels below root.
+	// Zero means no limit.
+	MaxDepth int
+}
+
+// Walk walks the tree rooted at root, calling fn for each file and folder,
+// including root. Entries are delivered parent before child, with the
+// entries of every folder sorted by name.
+func (c *Dropbox) Walk(ctx context.Context, root string, fn WalkFunc) error {
+	return Walk(ctx, c, root, fn)
+}
+
+// WalkWithOptions is like Walk but supports parallel listing, filtering and
+// depth limits.
+func (c *Dropbox) WalkWithOptions(ctx context.Context, root string, fn WalkFunc, opts *WalkOptions) error {
+	return WalkWithOptions(ctx, c, root, fn, opts)
+}
+
+// Walk walks the tree rooted at root with client like Dropbox.Walk.
+func Walk(ctx context.Context, client Client, root string, fn WalkFunc) error {
+	return WalkWithOptions(ctx, client, root, fn, nil)
+}
+
+// WalkWithOptions walks the tree rooted at root with client like
+// Dropbox.WalkWithOptions.
+//
+// Include and Exclude patterns use path.Match syntax. Patterns containing a
+// slash are matched against the path relative to root, other patterns are
+// matched against the entry name.
+func WalkWithOptions(ctx context.Context, client Client, root string, fn WalkFunc, opts *WalkOptions) error {
+	w := &walker{
+		client: client,
+		fn:     fn,
+	}
+	if opts != nil {
+		w.opts = *opts
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	w.ctx = ctx
+	w.pending = map[string]*walkListing{}
+	if w.opts.Concurrency > 1 {
+		w.sem = make(chan struct{}, w.opts.Concurrency)
+	}
+
+	if root == "/" {
+		root = ""
+	}
+
+	w.root = root
+
+	var md *Metadata
+	var err error
+
+	if root == "" {
+		md = &Metadata{Tag: MetadataFolder}
+	} else {
+		md, err = client.GetMetadata(ctx, &GetMetadataArg{Path: root})
+	}
+
+	if err != nil {
+		err = fn(root, nil, err)
+	} else {
+		err = w.walk(root, md, 0)
+	}
+
+	if err == fs.SkipDir || err == fs.SkipAll {
+		return nil
+	}
+
+	return err
+}
+
+type walker struct {
+	client Client
+	ctx    context.Context
+	fn     WalkFunc
+	opts   WalkOptions
+	root   string
+
+	sem     chan struct{}
+	pending map[string]*walkListing
+	mutex   sync.Mutex
+}
+
+type walkListing struct {
+	done    chan struct{}
+	entries []*Metadata
+	err     error
+}
+
+func (w *walker) walk(p string, md *Metadata, depth int) error {
+	if err := w.fn(p, md, nil); err != nil || md.Tag != MetadataFolder {
+		return err
+	}
+
+	if w.opts.MaxDepth > 0 && depth >= w.opts.MaxDepth {
+		return nil
+	}
+
+	entries, err := w.list(p)
+	if err != nil {
+		return w.fn(p, md, err)
+	}
+
+	visible := make([]*Metadata, 0, len(entries))
+	for _, entry := range entries {
+		if w.visible(p+"/"+entry.Name, entry) {
+			visible = append(visible, entry)
+		}
+	}
+
+	if w.sem != nil && (w.opts.MaxDepth == 0 || depth+1 < w.opts.MaxDepth) {
+		for _, entry := range visible {
+			if entry.Tag == MetadataFolder {
+				w.prefetch(p + "/" + entry.Name)
+			}
+		}
+	}
+
+	for _, entry := range visible {
+		if err := w.walk(p+"/"+entry.Name, entry, depth+1); err != nil {
+			if err == fs.SkipDir {
+				if entry.Tag == MetadataFolder {
+					continue
+				}
+				return nil
+			}
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (w *walker) relPath(p string) string {
+	return strings.TrimPrefix(strings.TrimPrefix(p, w.root), "/")
+}
+
+func (w *walker) match(patterns []string, p string) bool {
+	rel := w.relPath(p)
+	name := gopath.Base(p)
+
+	for _, pattern := range patterns {
+		subject := name
+		if strings.Contains(pattern, "/") {
+			subject = rel
+		}
+		if ok, _ := gopath.Match(pattern, subject); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (w *walker) visible(p string, md *Metadata) bool {
+	if len(w.opts.Exclude) > 0 && w.match(w.opts.Exclude, p) {
+		return false
+	}
+
+	if len(w.opts.Include) > 0 && md.Tag != MetadataFolder && !w.match(w.opts.Include, p) {
+		return false
+	}
+
+	return true
+}
+
+func (w *walker) prefetch(p string) {
+	key := strings.ToLower(p)
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if _, ok := w.pending[key]; ok {
+		return
+	}
+
+	listing := &walkListing{
+		done: make(chan struct{}),
+	}
+	w.pending[key] = listing
+
+	go func() {
+		defer close(listing.done)
+
+		select {
+		case w.sem <- struct{}{}:
+		case <-w.ctx.Done():
+			listing.err = w.ctx.Err()
+			return
+		}
+		defer func() { <-w.sem }()
+
+		listing.entries, listing.err = listFolderAll(w.ctx, w.client, p)
+	}()
+}
+
+func (w *walker) list(p string) ([]*Metadata, error) {
+	key := strings.ToLower(p)
+
+	w.mutex.Lock()
+	listing, ok := w.pending[key]
+	delete(w.pending, key)
+	w.mutex.Unlock()
+
+	if !ok {
+		return listFolderAll(w.ctx, w.client, p)
+	}
+
+	<-listing.done
+
+	return listing.entries, listing.err
+}
+
+// listFolderAll lists all entries of a folder, following pagination, and
+// returns them sorted by name without deleted entries.
+func listFolderAll(ctx context.Context, client Client, p string) (entries []*Metadata, err error) {
+	result, err := client.ListFolder(ctx, &ListFolderArg{Path: p})
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		for _, md := range result.Entries {
+			if md.Tag != MetadataDeleted {
+				entries = append(entries, md)
+			}
+		}
+
+		if !result.HasMore {
+			break
+		}
+
+		result, err = client.ListFolderContinue(ctx, &ListFolderContinueArg{Cursor: result.Cursor})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name < entries[j].Name
+	})
+
+	return entries, nil
+}
@@ -0,0 +1,176 @@
+package dropboxclient_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math/rand"
+	"strings"
+
+	. "github.com/koofr/go-dropboxclient"
+	"github.com/koofr/go-dropboxclient/mockdropbox"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Walk", func() {
+	var client *Dropbox
+	var stop func()
+	var root string
+
+	BeforeEach(func() {
+		client, _, stop = startMockClient()
+
+		root = fmt.Sprintf("/walk-%d", rand.Int())
+
+		for _, p := range []string{"", "/c", "/a", "/a/sub"} {
+			_, err := client.CreateFolder(context.Background(), &CreateFolderArg{Path: root + p})
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		for _, p := range []string{"/b.txt", "/a/y.go", "/a/x.txt", "/a/sub/z.txt", "/c/w.txt"} {
+			uploadFile(client, root+p, []byte("x"))
+		}
+	})
+
+	AfterEach(func() {
+		stop()
+	})
+
+	walk := func(opts *WalkOptions, fn func(p string, md *Metadata) error) ([]string, error) {
+		paths := []string{}
+		err := client.WalkWithOptions(context.Background(), root, func(p string, md *Metadata, err error) error {
+			if err != nil {
+				return err
+			}
+			paths = append(paths, strings.TrimPrefix(p, root))
+			if fn != nil {
+				return fn(p, md)
+			}
+			return nil
+		}, opts)
+		return paths, err
+	}
+
+	It("should walk parents before children in name order", func() {
+		paths, err := walk(nil, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(paths).To(Equal([]string{
+			"",
+			"/a",
+			"/a/sub",
+			"/a/sub/z.txt",
+			"/a/x.txt",
+			"/a/y.go",
+			"/b.txt",
+			"/c",
+			"/c/w.txt",
+		}))
+	})
+
+	It("should deliver the same order when listing in parallel", func() {
+		expected, err := walk(nil, nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		for i := 0; i < 5; i++ {
+			paths, err := walk(&WalkOptions{Concurrency: 4}, nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(paths).To(Equal(expected))
+		}
+	})
+
+	It("should skip a folder", func() {
+		paths, err := walk(nil, func(p string, md *Metadata) error {
+			if md.Name == "a" {
+				return fs.SkipDir
+			}
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(paths).To(Equal([]string{"", "/a", "/b.txt", "/c", "/c/w.txt"}))
+	})
+
+	It("should skip the rest of a folder when a file returns SkipDir", func() {
+		paths, err := walk(nil, func(p string, md *Metadata) error {
+			if md.Name == "x.txt" {
+				return fs.SkipDir
+			}
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(paths).To(Equal([]string{"", "/a", "/a/sub", "/a/sub/z.txt", "/a/x.txt", "/b.txt", "/c", "/c/w.txt"}))
+	})
+
+	It("should stop on SkipAll", func() {
+		paths, err := walk(&WalkOptions{Concurrency: 2}, func(p string, md *Metadata) error {
+			if md.Name == "sub" {
+				return fs.SkipAll
+			}
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(paths).To(Equal([]string{"", "/a", "/a/sub"}))
+	})
+
+	It("should return errors from the walk function", func() {
+		walkErr := errors.New("walk error")
+		_, err := walk(nil, func(p string, md *Metadata) error {
+			if md.Name == "b.txt" {
+				return walkErr
+			}
+			return nil
+		})
+		Expect(err).To(Equal(walkErr))
+	})
+
+	It("should filter with include and exclude patterns", func() {
+		paths, err := walk(&WalkOptions{Include: []string{"*.txt"}, Exclude: []string{"c", "a/sub/*"}}, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(paths).To(Equal([]string{"", "/a", "/a/sub", "/a/x.txt", "/b.txt"}))
+	})
+
+	It("should limit the depth", func() {
+		paths, err := walk(&WalkOptions{MaxDepth: 1, Concurrency: 2}, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(paths).To(Equal([]string{"", "/a", "/b.txt", "/c"}))
+
+		paths, err = walk(&WalkOptions{MaxDepth: 2}, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(paths).To(Equal([]string{"", "/a", "/a/sub", "/a/x.txt", "/a/y.go", "/b.txt", "/c", "/c/w.txt"}))
+	})
+
+	It("should walk a single file", func() {
+		paths := []string{}
+		err := client.Walk(context.Background(), root+"/b.txt", func(p string, md *Metadata, err error) error {
+			paths = append(paths, p)
+			return err
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(paths).To(Equal([]string{root + "/b.txt"}))
+	})
+
+	It("should report a missing root", func() {
+		err := client.Walk(context.Background(), root+"/missing", func(p string, md *Metadata, err error) error {
+			Expect(md).To(BeNil())
+			return err
+		})
+		Expect(errors.Is(FSError(err), fs.ErrNotExist)).To(BeTrue())
+	})
+
+	It("should walk any Client", func() {
+		memory := mockdropbox.NewMemoryClient()
+		_, err := memory.CreateFolder(context.Background(), &CreateFolderArg{Path: "/dir"})
+		Expect(err).NotTo(HaveOccurred())
+		uploadFile(memory, "/dir/file.txt", []byte("x"))
+
+		paths := []string{}
+		err = Walk(context.Background(), memory, "", func(p string, md *Metadata, err error) error {
+			paths = append(paths, p)
+			return err
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(paths).To(Equal([]string{"", "/dir", "/dir/file.txt"}))
+	})
+})
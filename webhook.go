@@ -0,0 +1,146 @@
+package dropboxclient
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const WebhookSignatureHeader = "X-Dropbox-Signature"
+
+// DefaultWebhookMaxBodySize limits the size of webhook notification bodies.
+const DefaultWebhookMaxBodySize = 1024 * 1024
+
+type WebhookListFolder struct {
+	Accounts []string `json:"accounts"`
+}
+
+type WebhookNotification struct {
+	ListFolder *WebhookListFolder `json:"list_folder"`
+}
+
+// WebhookSignature returns the hex encoded HMAC-SHA256 of body signed with
+// appSecret, as sent in the X-Dropbox-Signature header.
+func WebhookSignature(appSecret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(appSecret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// WebhookHandler receives Dropbox webhooks. It answers the GET verification
+// challenge, verifies the signature of POST notifications and calls OnChange
+// for every notified account. Notifications for an account that arrive
+// within Debounce of the first one are coalesced into a single call.
+type WebhookHandler struct {
+	AppSecret string
+	Debounce  time.Duration
+	OnChange  func(accountID string)
+
+	pending      map[string]*time.Timer
+	pendingMutex sync.Mutex
+}
+
+func NewWebhookHandler(appSecret string, debounce time.Duration, onChange func(accountID string)) *WebhookHandler {
+	return &WebhookHandler{
+		AppSecret: appSecret,
+		Debounce:  debounce,
+		OnChange:  onChange,
+		pending:   map[string]*time.Timer{},
+	}
+}
+
+func (h *WebhookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		h.challenge(w, r)
+	case "POST":
+		h.notification(w, r)
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *WebhookHandler) challenge(w http.ResponseWriter, r *http.Request) {
+	challenge := r.URL.Query().Get("challenge")
+	if challenge == "" {
+		http.Error(w, "Missing challenge", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusOK)
+	io.WriteString(w, challenge)
+}
+
+func (h *WebhookHandler) notification(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, DefaultWebhookMaxBodySize))
+	if err != nil {
+		http.Error(w, "Invalid body", http.StatusBadRequest)
+		return
+	}
+
+	signature := strings.ToLower(r.Header.Get(WebhookSignatureHeader))
+	if !hmac.Equal([]byte(signature), []byte(WebhookSignature(h.AppSecret, body))) {
+		http.Error(w, "Invalid signature", http.StatusForbidden)
+		return
+	}
+
+	notification := &WebhookNotification{}
+	if err := json.Unmarshal(body, notification); err != nil {
+		http.Error(w, "Invalid body", http.StatusBadRequest)
+		return
+	}
+
+	if notification.ListFolder != nil {
+		for _, accountID := range notification.ListFolder.Accounts {
+			h.schedule(accountID)
+		}
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// schedule calls OnChange for accountID after Debounce unless a call is
+// already pending. OnChange never runs on the request goroutine because
+// Dropbox expects webhook responses within a few seconds.
+func (h *WebhookHandler) schedule(accountID string) {
+	h.pendingMutex.Lock()
+	defer h.pendingMutex.Unlock()
+
+	if h.pending == nil {
+		h.pending = map[string]*time.Timer{}
+	}
+
+	if _, ok := h.pending[accountID]; ok {
+		return
+	}
+
+	h.pending[accountID] = time.AfterFunc(h.Debounce, func() {
+		h.pendingMutex.Lock()
+		delete(h.pending, accountID)
+		h.pendingMutex.Unlock()
+
+		if h.OnChange != nil {
+			h.OnChange(accountID)
+		}
+	})
+}
+
+// Close cancels pending OnChange calls.
+func (h *WebhookHandler) Close() {
+	h.pendingMutex.Lock()
+	defer h.pendingMutex.Unlock()
+
+	for accountID, timer := range h.pending {
+		timer.Stop()
+		delete(h.pending, accountID)
+	}
+}
@@ -0,0 +1,126 @@
+package dropboxclient_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/koofr/go-dropboxclient"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("WebhookHandler", func() {
+	var handler *WebhookHandler
+	var server *httptest.Server
+	var notified []string
+	var notifiedMutex sync.Mutex
+
+	getNotified := func() []string {
+		notifiedMutex.Lock()
+		defer notifiedMutex.Unlock()
+		return append([]string{}, notified...)
+	}
+
+	BeforeEach(func() {
+		notified = nil
+
+		handler = NewWebhookHandler("secret", 50*time.Millisecond, func(accountID string) {
+			notifiedMutex.Lock()
+			notified = append(notified, accountID)
+			notifiedMutex.Unlock()
+		})
+		server = httptest.NewServer(handler)
+	})
+
+	AfterEach(func() {
+		server.Close()
+		handler.Close()
+	})
+
+	post := func(body string, signature string) *http.Response {
+		req, err := http.NewRequest("POST", server.URL, strings.NewReader(body))
+		Expect(err).NotTo(HaveOccurred())
+		req.Header.Set(WebhookSignatureHeader, signature)
+		res, err := http.DefaultClient.Do(req)
+		Expect(err).NotTo(HaveOccurred())
+		res.Body.Close()
+		return res
+	}
+
+	It("should echo the verification challenge", func() {
+		res, err := http.Get(server.URL + "?challenge=abc123")
+		Expect(err).NotTo(HaveOccurred())
+		defer res.Body.Close()
+
+		Expect(res.StatusCode).To(Equal(http.StatusOK))
+		Expect(res.Header.Get("X-Content-Type-Options")).To(Equal("nosniff"))
+
+		body, _ := io.ReadAll(res.Body)
+		Expect(string(body)).To(Equal("abc123"))
+	})
+
+	It("should reject notifications with an invalid signature", func() {
+		body := `{"list_folder":{"accounts":["dbid:a"]}}`
+
+		Expect(post(body, WebhookSignature("wrong", []byte(body))).StatusCode).To(Equal(http.StatusForbidden))
+		Expect(post(body, "").StatusCode).To(Equal(http.StatusForbidden))
+
+		Consistently(getNotified, 100*time.Millisecond).Should(BeEmpty())
+	})
+
+	It("should debounce notifications per account", func() {
+		body := `{"list_folder":{"accounts":["dbid:a","dbid:b"]}}`
+		Expect(post(body, WebhookSignature("secret", []byte(body))).StatusCode).To(Equal(http.StatusOK))
+
+		body = `{"list_folder":{"accounts":["dbid:a"]}}`
+		Expect(post(body, WebhookSignature("secret", []byte(body))).StatusCode).To(Equal(http.StatusOK))
+
+		Eventually(getNotified).Should(ConsistOf("dbid:a", "dbid:b"))
+		Consistently(getNotified, 100*time.Millisecond).Should(HaveLen(2))
+	})
+
+	It("should receive notifications from the mock", func() {
+		client, mock, stop := startMockClient()
+		defer stop()
+
+		mock.RegisterWebhook(server.URL, "secret")
+		defer mock.UnregisterWebhook()
+
+		uploadFile(client, "/webhook.txt", []byte("data"))
+
+		Eventually(getNotified).Should(Equal([]string{mock.TokenStore("mock").AccountID()}))
+	})
+
+	It("should abort a notification when the webhook is unregistered", func() {
+		client, mock, stop := startMockClient()
+		defer stop()
+
+		received := make(chan struct{}, 1)
+		release := make(chan struct{})
+		hanging := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			received <- struct{}{}
+			select {
+			case <-release:
+			case <-r.Context().Done():
+			}
+		}))
+		defer hanging.Close()
+		defer close(release)
+
+		mock.RegisterWebhook(hanging.URL, "secret")
+		uploadFile(client, "/webhook.txt", []byte("data"))
+		Eventually(received).Should(Receive())
+
+		unregistered := make(chan struct{})
+		go func() {
+			mock.UnregisterWebhook()
+			close(unregistered)
+		}()
+		Eventually(unregistered).Should(BeClosed())
+	})
+})